@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/demen1n/confetti"
+)
+
+// fileFormat is a file format that confetti convert reads or writes. Both
+// directions report what the conversion could not carry over exactly.
+type fileFormat struct {
+	exts  []string // file extensions, for guessing the format of the input
+	read  func(src []byte, opts confetti.Options) (*confetti.ConfigurationUnit, []confetti.Loss, error)
+	write func(unit *confetti.ConfigurationUnit) ([]byte, []confetti.Loss, error) // nil if the format cannot be written
+}
+
+var formats = map[string]fileFormat{
+	"conf": {
+		exts: []string{".conf"},
+		read: func(src []byte, opts confetti.Options) (*confetti.ConfigurationUnit, []confetti.Loss, error) {
+			unit, err := confetti.ParseWithOptions(string(src), opts)
+			return unit, nil, err
+		},
+		write: func(unit *confetti.ConfigurationUnit) ([]byte, []confetti.Loss, error) {
+			b, err := confetti.Marshal(unit)
+			return b, nil, err
+		},
+	},
+	"json": {
+		exts: []string{".json"},
+		read: func(src []byte, _ confetti.Options) (*confetti.ConfigurationUnit, []confetti.Loss, error) {
+			var unit confetti.ConfigurationUnit
+			if err := json.Unmarshal(src, &unit); err != nil {
+				return nil, nil, err
+			}
+			return &unit, nil, nil
+		},
+		write: func(unit *confetti.ConfigurationUnit) ([]byte, []confetti.Loss, error) {
+			b, err := marshalJSON(unit)
+			return b, nil, err
+		},
+	},
+	"object": {
+		write: func(unit *confetti.ConfigurationUnit) ([]byte, []confetti.Loss, error) {
+			b, err := marshalJSON(unit.Object())
+			return b, nil, err
+		},
+	},
+	"ini": {
+		exts: []string{".ini"},
+		read: func(src []byte, _ confetti.Options) (*confetti.ConfigurationUnit, []confetti.Loss, error) {
+			return confetti.ParseINI(string(src))
+		},
+		write: confetti.MarshalINI,
+	},
+	"toml": {
+		exts: []string{".toml"},
+		read: func(src []byte, _ confetti.Options) (*confetti.ConfigurationUnit, []confetti.Loss, error) {
+			return confetti.ParseTOML(string(src))
+		},
+		write: confetti.MarshalTOML,
+	},
+	"yaml": {
+		exts: []string{".yaml", ".yml"},
+		read: func(src []byte, _ confetti.Options) (*confetti.ConfigurationUnit, []confetti.Loss, error) {
+			return confetti.ParseYAML(string(src))
+		},
+		write: confetti.MarshalYAML,
+	},
+}
+
+// marshalJSON returns v as indented JSON ending with a newline.
+func marshalJSON(v any) ([]byte, error) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// formatNames returns the names of the formats that can be read or, with
+// write, written.
+func formatNames(write bool) string {
+	var names []string
+	for name, f := range formats {
+		if write && f.write != nil || !write && f.read != nil {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return strings.Join(names, ", ")
+}
+
+// guessFormat returns the format of the file name from its extension, or
+// conf.
+func guessFormat(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	for fname, f := range formats {
+		if slices.Contains(f.exts, ext) {
+			return fname
+		}
+	}
+	return "conf"
+}
+
+func runConvert(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("convert", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: confetti convert [flags] [file]")
+		fmt.Fprintln(stderr, "\nConverts a document, read from file or standard input, between Confetti")
+		fmt.Fprintln(stderr, "and other formats. The json format keeps every directive and block; the")
+		fmt.Fprintln(stderr, "object format maps directive names to values for reading, and cannot")
+		fmt.Fprintln(stderr, "be converted back. What the ini, toml and yaml formats cannot represent")
+		fmt.Fprintln(stderr, "exactly is reported on standard error, with the line in the input.")
+		fmt.Fprintln(stderr, "\nFlags:")
+		flags.PrintDefaults()
+	}
+	from := flags.String("from", "", "input format: "+formatNames(false)+" (default: from the file extension, or conf)")
+	to := flags.String("to", "", "output format: "+formatNames(true)+" (default: json for conf input, conf otherwise)")
+	out := flags.String("o", "", "write the result to this file instead of stdout")
+	strict := flags.Bool("strict", false, "exit with status 1, writing nothing, if the conversion loses information")
+	ext := extensionFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+	name := "-"
+	if flags.NArg() == 1 {
+		name = flags.Arg(0)
+	}
+
+	if *from == "" {
+		*from = guessFormat(name)
+	}
+	if *to == "" {
+		*to = "conf"
+		if *from == "conf" {
+			*to = "json"
+		}
+	}
+	in, ok := formats[*from]
+	if !ok || in.read == nil {
+		fmt.Fprintf(stderr, "confetti convert: cannot read format %q; use one of %s\n", *from, formatNames(false))
+		return 2
+	}
+	outFormat, ok := formats[*to]
+	if !ok || outFormat.write == nil {
+		fmt.Fprintf(stderr, "confetti convert: cannot write format %q; use one of %s\n", *to, formatNames(true))
+		return 2
+	}
+
+	src, err := readFile(name, stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "confetti convert: %v\n", err)
+		return 2
+	}
+	if name == "-" {
+		name = "<standard input>"
+	}
+	unit, readLosses, err := in.read(src, ext())
+	if err != nil {
+		fmt.Fprintln(stderr, describe(name, err))
+		return 2
+	}
+	res, writeLosses, err := outFormat.write(unit)
+	if err != nil {
+		fmt.Fprintln(stderr, describe(name, err))
+		return 2
+	}
+	// the lines of the losses on writing refer to the input if it was
+	// Confetti, and are unknown otherwise
+	for _, l := range append(readLosses, writeLosses...) {
+		if l.Line > 0 {
+			fmt.Fprintf(stderr, "%s:%d: %s\n", name, l.Line, l.Msg)
+		} else {
+			fmt.Fprintf(stderr, "%s: %s\n", name, l.Msg)
+		}
+	}
+	if *strict && len(readLosses)+len(writeLosses) > 0 {
+		return 1
+	}
+	if *out == "" {
+		_, err = stdout.Write(res)
+	} else {
+		err = os.WriteFile(*out, res, 0o666)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "confetti convert: %v\n", err)
+		return 2
+	}
+	return 0
+}
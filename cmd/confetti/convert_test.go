@@ -0,0 +1,158 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	conf := "port 8080\nserver api {\n    timeout 30s\n}\nempty {}\n"
+	code, out, errOut := runCmd(t, conf, "convert")
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, errOut)
+	}
+	want := `{
+  "directives": [
+    {
+      "arguments": [
+        "port",
+        "8080"
+      ]
+    },
+    {
+      "arguments": [
+        "server",
+        "api"
+      ],
+      "subdirectives": [
+        {
+          "arguments": [
+            "timeout",
+            "30s"
+          ]
+        }
+      ]
+    },
+    {
+      "arguments": [
+        "empty"
+      ],
+      "subdirectives": []
+    }
+  ]
+}
+`
+	if out != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", out, want)
+	}
+
+	// back, guessing the format from the file name
+	dir := t.TempDir()
+	in := filepath.Join(dir, "app.json")
+	writeFile(t, in, out)
+	code, out, errOut = runCmd(t, "", "convert", in)
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, errOut)
+	}
+	if out != conf {
+		t.Fatalf("got:\n%s\nwant:\n%s", out, conf)
+	}
+
+	code, out, errOut = runCmd(t, conf, "convert", "-to", "object")
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, errOut)
+	}
+	want = "{\n  \"empty\": {},\n  \"port\": \"8080\",\n  \"server\": {\n    \"api\": {\n      \"timeout\": \"30s\"\n    }\n  }\n}\n"
+	if out != want {
+		t.Fatalf("-to object: got:\n%s\nwant:\n%s", out, want)
+	}
+
+	outFile := filepath.Join(dir, "app.conf")
+	if code, _, errOut := runCmd(t, "", "convert", "-o", outFile, in); code != 0 {
+		t.Fatalf("exit code %d: %s", code, errOut)
+	}
+	if got, err := os.ReadFile(outFile); err != nil || string(got) != conf {
+		t.Fatalf("-o wrote %q, %v", got, err)
+	}
+}
+
+func TestConvert_Errors(t *testing.T) {
+	tests := []struct {
+		args  []string
+		input string
+		want  string
+	}{
+		{[]string{"-from", "object"}, "", `cannot read format "object"`},
+		{[]string{"-to", "xml"}, "", `cannot write format "xml"`},
+		{nil, "a {\n", "<standard input>:2:1: "},
+		{[]string{"-from", "json"}, `{"directives":[{"arguments":[]}]}`, "<standard input>: confetti: directive must have at least one argument"},
+		{[]string{"-from", "json"}, `[`, "<standard input>: unexpected end of JSON input"},
+		{[]string{"-from", "json"}, `{"directives":[{"arguments":["a\u0000"]}]}`, `<standard input>: confetti: argument "a\x00": forbidden character U+0000`},
+	}
+	for _, tt := range tests {
+		code, _, errOut := runCmd(t, tt.input, append([]string{"convert"}, tt.args...)...)
+		if code != 2 || !strings.Contains(errOut, tt.want) {
+			t.Errorf("%v: exit code %d, error output %q, want %q", tt.args, code, errOut, tt.want)
+		}
+	}
+}
+
+func TestConvert_WriteError(t *testing.T) {
+	var errOut strings.Builder
+	code := run([]string{"convert", "-to", "json"}, strings.NewReader("a 1\n"), failWriter{}, &errOut)
+	if code != 2 || errOut.String() != "confetti convert: disk full\n" {
+		t.Fatalf("exit code %d, error output %q", code, errOut.String())
+	}
+}
+
+func TestConvert_Formats(t *testing.T) {
+	dir := t.TempDir()
+	ini := filepath.Join(dir, "app.ini")
+	writeFile(t, ini, "; app\nname = demo\n\n[server]\nport = 8080\n")
+
+	code, out, errOut := runCmd(t, "", "convert", ini)
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, errOut)
+	}
+	if want := "name demo\nserver {\n    port 8080\n}\n"; out != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", out, want)
+	}
+	if want := ini + ":1: 1 comment dropped\n"; errOut != want {
+		t.Fatalf("losses %q, want %q", errOut, want)
+	}
+
+	code, out, errOut = runCmd(t, "", "convert", "-to", "toml", ini)
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, errOut)
+	}
+	if want := "name = \"demo\"\n\n[server]\nport = 8080\n"; out != want {
+		t.Fatalf("-to toml: got:\n%s\nwant:\n%s", out, want)
+	}
+
+	code, out, errOut = runCmd(t, "server api {\n    port 80\n}\n", "convert", "-to", "yaml")
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, errOut)
+	}
+	if want := "server:\n  api:\n    port: 80\n"; out != want {
+		t.Fatalf("-to yaml: got:\n%s\nwant:\n%s", out, want)
+	}
+	if want := "<standard input>:1: server: inline arguments written as nested keys\n"; errOut != want {
+		t.Fatalf("losses %q, want %q", errOut, want)
+	}
+
+	code, out, _ = runCmd(t, "", "convert", "-strict", "-to", "yaml", ini)
+	if code != 1 || out != "" {
+		t.Fatalf("-strict: exit code %d, output %q", code, out)
+	}
+	code, _, errOut = runCmd(t, "a: 1\nb:\n- x\n", "convert", "-strict", "-from", "yaml")
+	if code != 0 {
+		t.Fatalf("-strict without losses: exit code %d: %s", code, errOut)
+	}
+
+	code, _, errOut = runCmd(t, "a = 1\na = 2\n", "convert", "-from", "toml")
+	if code != 2 || errOut != "<standard input>:2:1: duplicate key \"a\"\n" {
+		t.Fatalf("exit code %d, error output %q", code, errOut)
+	}
+}
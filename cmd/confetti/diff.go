@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/demen1n/confetti"
+)
+
+func runDiff(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: confetti diff [flags] old new")
+		fmt.Fprintln(stderr, "\nPrints the directives added, removed, changed or reordered between two")
+		fmt.Fprintln(stderr, "files; - names standard input. The exit status is 0 if they are")
+		fmt.Fprintln(stderr, "equivalent, 1 if they differ and 2 on error.")
+		fmt.Fprintln(stderr, "\nFlags:")
+		flags.PrintDefaults()
+	}
+	asJSON := flags.Bool("json", false, "print the changes as a JSON array")
+	ext := extensionFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+	opts := ext()
+
+	var units [2]*confetti.ConfigurationUnit
+	for i, name := range flags.Args() {
+		unit, err := parseFile(name, stdin, opts)
+		if err != nil {
+			fmt.Fprintln(stderr, describe(name, err))
+			return 2
+		}
+		units[i] = unit
+	}
+	changes := confetti.Diff(units[0], units[1])
+
+	oldName, newName := flags.Arg(0), flags.Arg(1)
+	if *asJSON {
+		res := make([]jsonChange, 0, len(changes))
+		for _, c := range changes {
+			res = append(res, jsonChange{
+				Kind: c.Kind.String(),
+				Path: c.Path,
+				Old:  newJSONDirective(oldName, c.Old),
+				New:  newJSONDirective(newName, c.New),
+			})
+		}
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(res); err != nil {
+			fmt.Fprintf(stderr, "confetti diff: %v\n", err)
+			return 2
+		}
+	} else {
+		for _, c := range changes {
+			name, d := newName, c.New
+			if d == nil {
+				name, d = oldName, c.Old
+			}
+			fmt.Fprintf(stdout, "%s:%d:%d: %s\n", name, d.Span.Start.Line, d.Span.Start.Column, c)
+		}
+	}
+	if len(changes) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// parseFile parses the file name, or stdin if name is "-".
+func parseFile(name string, stdin io.Reader, opts confetti.Options) (*confetti.ConfigurationUnit, error) {
+	src, err := readFile(name, stdin)
+	if err != nil {
+		return nil, err
+	}
+	return confetti.ParseWithOptions(string(src), opts)
+}
+
+// readFile reads the file name, or stdin if name is "-".
+func readFile(name string, stdin io.Reader) ([]byte, error) {
+	if name == "-" {
+		return io.ReadAll(stdin)
+	}
+	return os.ReadFile(name)
+}
+
+// jsonChange is a confetti.Change as printed by "confetti diff -json".
+type jsonChange struct {
+	Kind string         `json:"kind"`
+	Path string         `json:"path"`
+	Old  *jsonDirective `json:"old,omitempty"`
+	New  *jsonDirective `json:"new,omitempty"`
+}
+
+// jsonDirective is a directive of a change and where it is.
+type jsonDirective struct {
+	Arguments []string `json:"arguments"`
+	File      string   `json:"file"`
+	Line      int      `json:"line"`
+	Column    int      `json:"column"`
+}
+
+func newJSONDirective(file string, d *confetti.Directive) *jsonDirective {
+	if d == nil {
+		return nil
+	}
+	return &jsonDirective{
+		Arguments: d.Arguments,
+		File:      file,
+		Line:      d.Span.Start.Line,
+		Column:    d.Span.Start.Column,
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "old.conf")
+	new := filepath.Join(dir, "new.conf")
+	writeFile(t, old, "server api {\n    timeout 60\n}\ndebug on\n")
+	writeFile(t, new, "server api {\n    timeout 90\n}\n")
+
+	code, out, errOut := runCmd(t, "", "diff", old, new)
+	if code != 1 {
+		t.Fatalf("exit code %d, want 1: %s", code, errOut)
+	}
+	want := old + ":4:1: debug removed on\n" + new + ":2:5: server[api].timeout changed 60 → 90\n"
+	if out != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", out, want)
+	}
+
+	code, out, errOut = runCmd(t, "", "diff", "-json", old, new)
+	if code != 1 {
+		t.Fatalf("-json exit code %d, want 1: %s", code, errOut)
+	}
+	var changes []jsonChange
+	if err := json.Unmarshal([]byte(out), &changes); err != nil {
+		t.Fatalf("-json printed invalid JSON: %v\n%s", err, out)
+	}
+	if len(changes) != 2 || changes[1].Kind != "changed" || changes[1].Path != "server[api].timeout" ||
+		changes[1].Old.File != old || changes[1].New.Line != 2 || changes[1].New.Arguments[1] != "90" || changes[0].New != nil {
+		t.Fatalf("unexpected -json output:\n%s", out)
+	}
+}
+
+func TestDiff_Equal(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "a.conf")
+	writeFile(t, name, "a 1 # comment\n")
+
+	code, out, errOut := runCmd(t, "a   1\n", "diff", name, "-")
+	if code != 0 || out != "" {
+		t.Fatalf("exit code %d, output %q: %s", code, out, errOut)
+	}
+	code, out, _ = runCmd(t, "a 1\n", "diff", "-json", name, "-")
+	if code != 0 || out != "[]\n" {
+		t.Fatalf("-json exit code %d, output %q", code, out)
+	}
+}
+
+func TestDiff_Errors(t *testing.T) {
+	if code, _, _ := runCmd(t, "", "diff", "only-one.conf"); code != 2 {
+		t.Fatalf("exit code %d with one file, want 2", code)
+	}
+	code, _, errOut := runCmd(t, "a {\n", "diff", "-", "-")
+	if code != 2 || !strings.HasPrefix(errOut, "-:2:1: ") {
+		t.Fatalf("exit code %d, error output %q", code, errOut)
+	}
+}
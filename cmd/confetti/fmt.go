@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/demen1n/confetti"
+)
+
+// fmtCmd holds the flags of "confetti fmt".
+type fmtCmd struct {
+	list, write, diff bool
+	opts              confetti.FormatOptions
+	stdout            io.Writer
+}
+
+func runFmt(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: confetti fmt [flags] [path ...]")
+		fmt.Fprintln(stderr, "\nFormats the named files, or standard input, in canonical style.")
+		fmt.Fprintln(stderr, "Directories are processed recursively for *.conf files.")
+		fmt.Fprintln(stderr, "\nFlags:")
+		flags.PrintDefaults()
+	}
+	c := &fmtCmd{stdout: stdout}
+	flags.BoolVar(&c.list, "l", false, "list files whose formatting differs from confetti fmt's")
+	flags.BoolVar(&c.write, "w", false, "write result to (source) file instead of stdout")
+	flags.BoolVar(&c.diff, "d", false, "display diffs instead of rewriting files")
+	flags.StringVar(&c.opts.Indent, "indent", "    ", "indentation of each nesting level")
+	ext := extensionFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	c.opts.Options = ext()
+
+	if flags.NArg() == 0 {
+		if c.write {
+			fmt.Fprintln(stderr, "confetti fmt: cannot use -w with standard input")
+			return 2
+		}
+		src, err := io.ReadAll(stdin)
+		if err == nil {
+			err = c.format("<standard input>", src, 0)
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, describe("<standard input>", err))
+			return 2
+		}
+		return 0
+	}
+
+	status := 0
+	for _, path := range flags.Args() {
+		err := filepath.WalkDir(path, func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || (name != path && filepath.Ext(name) != ".conf") {
+				return nil
+			}
+			if err := c.formatFile(name); err != nil {
+				fmt.Fprintln(stderr, describe(name, err))
+				status = 2
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(stderr, "confetti fmt: %v\n", err)
+			status = 2
+		}
+	}
+	return status
+}
+
+func (c *fmtCmd) formatFile(name string) error {
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	src, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	return c.format(name, src, info.Mode().Perm())
+}
+
+// format formats src, read from name, and reports or writes the result as
+// the flags ask.
+func (c *fmtCmd) format(name string, src []byte, perm fs.FileMode) error {
+	res, err := confetti.Format(src, c.opts)
+	if err != nil {
+		return err
+	}
+
+	if !c.list && !c.write && !c.diff {
+		_, err := c.stdout.Write(res)
+		return err
+	}
+	if bytes.Equal(src, res) {
+		return nil
+	}
+	if c.list {
+		fmt.Fprintln(c.stdout, name)
+	}
+	if c.write {
+		if err := os.WriteFile(name, res, perm); err != nil {
+			return err
+		}
+	}
+	if c.diff {
+		_, err := io.WriteString(c.stdout, unifiedDiff(name+".orig", name, src, res))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func runCmd(t *testing.T, stdin string, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+	var out, errOut strings.Builder
+	code = run(args, strings.NewReader(stdin), &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+func TestFmt_Stdin(t *testing.T) {
+	code, out, errOut := runCmd(t, "a   1;b{c 2}", "fmt")
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, errOut)
+	}
+	if want := "a 1\nb {\n    c 2\n}\n"; out != want {
+		t.Fatalf("got %q, want %q", out, want)
+	}
+}
+
+func TestFmt_Extensions(t *testing.T) {
+	code, out, errOut := runCmd(t, "x:=1 // c\n", "fmt", "-c", "-p", ":=,=")
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, errOut)
+	}
+	if want := "x := 1 // c\n"; out != want {
+		t.Fatalf("got %q, want %q", out, want)
+	}
+}
+
+func TestFmt_SyntaxError(t *testing.T) {
+	code, _, errOut := runCmd(t, "a {\n", "fmt")
+	if code != 2 {
+		t.Fatalf("exit code %d, want 2", code)
+	}
+	if !strings.HasPrefix(errOut, "<standard input>:2:1: ") {
+		t.Fatalf("unexpected error output %q", errOut)
+	}
+}
+
+func TestFmt_Files(t *testing.T) {
+	dir := t.TempDir()
+	messy := filepath.Join(dir, "messy.conf")
+	clean := filepath.Join(dir, "sub", "clean.conf")
+	other := filepath.Join(dir, "notes.txt")
+	writeFile(t, messy, "a 1;b 2\n")
+	writeFile(t, clean, "a 1\n")
+	writeFile(t, other, "not { confetti\n")
+
+	code, out, errOut := runCmd(t, "", "fmt", "-l", dir)
+	if code != 0 {
+		t.Fatalf("-l exit code %d: %s", code, errOut)
+	}
+	if out != messy+"\n" {
+		t.Fatalf("-l listed %q, want %q", out, messy+"\n")
+	}
+
+	code, out, errOut = runCmd(t, "", "fmt", "-d", messy)
+	if code != 0 {
+		t.Fatalf("-d exit code %d: %s", code, errOut)
+	}
+	wantDiff := "--- " + messy + ".orig\n+++ " + messy + "\n@@ -1 +1,2 @@\n-a 1;b 2\n+a 1\n+b 2\n"
+	if out != wantDiff {
+		t.Fatalf("-d printed:\n%s\nwant:\n%s", out, wantDiff)
+	}
+
+	code, out, errOut = runCmd(t, "", "fmt", "-w", dir)
+	if code != 0 || out != "" {
+		t.Fatalf("-w exit code %d, output %q: %s", code, out, errOut)
+	}
+	if got, _ := os.ReadFile(messy); string(got) != "a 1\nb 2\n" {
+		t.Fatalf("-w wrote %q", got)
+	}
+	if got, _ := os.ReadFile(other); string(got) != "not { confetti\n" {
+		t.Fatalf("-w touched a file without the .conf extension: %q", got)
+	}
+
+	// naming a file explicitly formats it whatever its extension
+	code, _, errOut = runCmd(t, "", "fmt", "-l", other)
+	if code != 2 || !strings.HasPrefix(errOut, other+":") {
+		t.Fatalf("exit code %d, error output %q", code, errOut)
+	}
+}
+
+func TestFmt_WriteStdin(t *testing.T) {
+	if code, _, _ := runCmd(t, "a 1\n", "fmt", "-w"); code != 2 {
+		t.Fatalf("exit code %d, want 2", code)
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	code, _, errOut := runCmd(t, "", "frobnicate")
+	if code != 2 || !strings.Contains(errOut, `unknown command "frobnicate"`) {
+		t.Fatalf("exit code %d, error output %q", code, errOut)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	var a, b []string
+	for i := 1; i <= 20; i++ {
+		a = append(a, "line "+strings.Repeat("x", i)+"\n")
+	}
+	b = append(b, a...)
+	b[1] = "changed\n"
+	b = append(b[:15], b[16:]...)
+	b = append(b, "tail")
+
+	got := unifiedDiff("a", "b", []byte(strings.Join(a, "")), []byte(strings.Join(b, "")))
+	want := `--- a
++++ b
+@@ -1,5 +1,5 @@
+ line x
+-line xx
++changed
+ line xxx
+ line xxxx
+ line xxxxx
+@@ -13,8 +13,8 @@
+ line xxxxxxxxxxxxx
+ line xxxxxxxxxxxxxx
+ line xxxxxxxxxxxxxxx
+-line xxxxxxxxxxxxxxxx
+ line xxxxxxxxxxxxxxxxx
+ line xxxxxxxxxxxxxxxxxx
+ line xxxxxxxxxxxxxxxxxxx
+ line xxxxxxxxxxxxxxxxxxxx
++tail
+\ No newline at end of file
+`
+	if got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if d := unifiedDiff("a", "b", []byte("same\n"), []byte("same\n")); d != "" {
+		t.Fatalf("diff of equal inputs = %q", d)
+	}
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/demen1n/confetti"
+)
+
+func runGen(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("gen", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: confetti gen [flags] [file]")
+		fmt.Fprintln(stderr, "\nWrites Go struct definitions with conf tags that a sample document,")
+		fmt.Fprintln(stderr, "read from file or standard input, decodes into.")
+		fmt.Fprintln(stderr, "\nFlags:")
+		flags.PrintDefaults()
+	}
+	pkg := flags.String("package", "config", "package name of the generated file")
+	typeName := flags.String("type", "Config", "name of the top-level struct type")
+	out := flags.String("o", "", "write the result to this file instead of stdout")
+	ext := extensionFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+	name := "-"
+	if flags.NArg() == 1 {
+		name = flags.Arg(0)
+	}
+
+	unit, err := parseFile(name, stdin, ext())
+	if err != nil {
+		if name == "-" {
+			name = "<standard input>"
+		}
+		fmt.Fprintln(stderr, describe(name, err))
+		return 2
+	}
+	src, skipped, err := generateStructs(unit, *pkg, *typeName)
+	if err != nil {
+		fmt.Fprintf(stderr, "confetti gen: %v\n", err)
+		return 2
+	}
+	for _, n := range skipped {
+		fmt.Fprintf(stderr, "confetti gen: directive %q cannot be named in a conf tag, skipped\n", n)
+	}
+	if *out == "" {
+		_, err = stdout.Write(src)
+	} else {
+		err = os.WriteFile(*out, src, 0o666)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "confetti gen: %v\n", err)
+		return 2
+	}
+	return 0
+}
+
+// genStruct is a struct type inferred from the blocks of a document.
+type genStruct struct {
+	name    string
+	from    string // directive the struct is decoded from, "" for the top level
+	arg     string // type of the ",arg" field, "" if none
+	argName string
+	fields  []genField
+}
+
+// genField is a field of a genStruct.
+type genField struct {
+	name    string // Go name
+	conf    string // directive name
+	typ     string // Go type
+	comment string
+}
+
+// generator infers the struct types of a document.
+type generator struct {
+	structs []*genStruct
+	types   map[string]bool // type names taken
+	imports map[string]bool
+	skipped []string // directive names no conf tag can match
+}
+
+// generateStructs returns Go source declaring a struct type named typeName
+// in package pkg, and the types it needs, that unit decodes into, and the
+// names of the directives left out because no conf tag can match them.
+func generateStructs(unit *confetti.ConfigurationUnit, pkg, typeName string) ([]byte, []string, error) {
+	g := &generator{types: make(map[string]bool), imports: make(map[string]bool)}
+	g.structType(typeName, "", "", [][]confetti.Directive{unit.Directives}, nil)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	if g.imports["time"] {
+		buf.WriteString("import \"time\"\n\n")
+	}
+	for _, s := range g.structs {
+		if s.from == "" {
+			fmt.Fprintf(&buf, "// %s is the top level of the configuration.\n", s.name)
+		} else {
+			fmt.Fprintf(&buf, "// %s is decoded from a %s directive.\n", s.name, s.from)
+		}
+		fmt.Fprintf(&buf, "type %s struct {\n", s.name)
+		if s.arg != "" {
+			fmt.Fprintf(&buf, "%s %s `conf:\",arg\"`\n", s.argName, s.arg)
+		}
+		for _, f := range s.fields {
+			fmt.Fprintf(&buf, "%s %s `conf:%s`", f.name, f.typ, strconv.Quote(f.conf))
+			if f.comment != "" {
+				fmt.Fprintf(&buf, " // %s", f.comment)
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString("}\n\n")
+	}
+	src, err := format.Source(buf.Bytes())
+	return src, g.skipped, err
+}
+
+// structType declares a struct type for the blocks, the blocks of the
+// directives named from within the struct type parent, and returns its name.
+func (g *generator) structType(name, from, parent string, blocks [][]confetti.Directive, inline [][]string) string {
+	s := &genStruct{name: g.typeName(name, parent), from: from}
+	g.structs = append(g.structs, s)
+
+	// group the directives of every block by name, in order of appearance
+	var names []string
+	groups := make(map[string][]confetti.Directive)
+	repeated := make(map[string]bool) // names appearing twice in a block
+	for _, block := range blocks {
+		seen := make(map[string]bool)
+		for _, d := range block {
+			if len(d.Arguments) == 0 {
+				continue
+			}
+			n := d.Arguments[0]
+			if _, ok := groups[n]; !ok {
+				names = append(names, n)
+			}
+			groups[n] = append(groups[n], d)
+			repeated[n] = repeated[n] || seen[n]
+			seen[n] = true
+		}
+	}
+
+	taken := make(map[string]bool)
+	for _, n := range names {
+		if !tagName(n) {
+			if !slices.Contains(g.skipped, n) {
+				g.skipped = append(g.skipped, n)
+			}
+			continue
+		}
+		f := genField{name: uniqueName(goName(n), taken), conf: n}
+		f.typ, f.comment = g.fieldType(n, s.name, groups[n], repeated[n])
+		s.fields = append(s.fields, f)
+	}
+
+	if len(inline) > 0 {
+		s.arg = "string"
+		var values []string
+		for _, args := range inline {
+			if len(args) > 1 {
+				s.arg = "[]string"
+			}
+			values = append(values, args...)
+		}
+		if s.arg == "[]string" {
+			s.arg = "[]" + g.scalarType(values)
+		}
+		s.argName = "Name"
+		if s.arg != "string" {
+			s.argName = "Args"
+		}
+		s.argName = uniqueName(s.argName, taken)
+	}
+	return s.name
+}
+
+// fieldType returns the Go type of the field decoded from dirs, the
+// directives named name found in the blocks of the struct type parent,
+// which may have been repeated within a block, and a comment for the field.
+func (g *generator) fieldType(name, parent string, dirs []confetti.Directive, repeated bool) (string, string) {
+	hasBlock, hasArgs := false, false
+	var subs [][]confetti.Directive
+	var inline [][]string
+	for _, d := range dirs {
+		if d.HasBlock() {
+			hasBlock = true
+			subs = append(subs, d.Subdirectives)
+		}
+		if len(d.Arguments) > 1 {
+			hasArgs = true
+		}
+		inline = append(inline, d.Arguments[1:])
+	}
+
+	if hasBlock {
+		// blocks with inline arguments, or repeated in a block, are elements
+		// of a slice
+		if !hasArgs {
+			inline = nil
+		}
+		typ := g.structType(name, name, parent, subs, inline)
+		if hasArgs || repeated {
+			return "[]" + typ, ""
+		}
+		return typ, ""
+	}
+
+	var comment string
+	if repeated {
+		comment = "repeated in the sample: only the last one is kept"
+	}
+	var values []string
+	single := true
+	for _, args := range inline {
+		if len(args) != 1 {
+			single = false
+		}
+		values = append(values, args...)
+	}
+	if single {
+		return g.scalarType(values), comment
+	}
+	return "[]" + g.scalarType(values), comment
+}
+
+// scalarType returns the Go type that every one of values converts to:
+// int, float64, bool, time.Duration or, failing those, string.
+func (g *generator) scalarType(values []string) string {
+	if len(values) == 0 {
+		return "string"
+	}
+	isInt, isFloat, isBool, isDuration := true, true, true, true
+	for _, v := range values {
+		if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+			isInt = false
+		}
+		if _, err := strconv.ParseFloat(v, 64); err != nil || !strings.ContainsAny(v[:1], "+-.0123456789") {
+			isFloat = false // not inf or nan
+		}
+		if _, err := strconv.ParseBool(v); err != nil {
+			isBool = false
+		}
+		if _, err := time.ParseDuration(v); err != nil {
+			isDuration = false
+		}
+	}
+	switch {
+	case isInt:
+		return "int"
+	case isFloat:
+		return "float64"
+	case isBool:
+		return "bool"
+	case isDuration:
+		g.imports["time"] = true
+		return "time.Duration"
+	}
+	return "string"
+}
+
+// tagName reports whether name can be written as the name in a conf tag:
+// an empty name or "-" would not name the directive, a comma would start
+// the options and a back quote would end the tag.
+func tagName(name string) bool {
+	return name != "" && name != "-" && !strings.ContainsAny(name, ",`")
+}
+
+// typeName returns a type name for the struct decoded from directive name
+// within the struct type parent that is not taken yet.
+func (g *generator) typeName(name, parent string) string {
+	base := goName(name)
+	if parent == "" {
+		base = name
+	} else if g.types[base] {
+		base = parent + base
+	}
+	return uniqueName(base, g.types)
+}
+
+// uniqueName returns name, or name followed by a number if it is in taken,
+// and adds it to taken.
+func uniqueName(name string, taken map[string]bool) string {
+	res := name
+	for i := 2; taken[res]; i++ {
+		res = name + strconv.Itoa(i)
+	}
+	taken[res] = true
+	return res
+}
+
+// initialisms are the words written in upper case in Go names.
+var initialisms = map[string]bool{
+	"acl": true, "api": true, "cpu": true, "dns": true, "html": true, "http": true,
+	"https": true, "id": true, "ip": true, "json": true, "sql": true, "ssh": true,
+	"tcp": true, "tls": true, "ttl": true, "udp": true, "ui": true, "uri": true,
+	"url": true, "uuid": true, "xml": true,
+}
+
+// goName returns an exported Go identifier for the directive name.
+func goName(name string) string {
+	var sb strings.Builder
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		if initialisms[strings.ToLower(w)] {
+			sb.WriteString(strings.ToUpper(w))
+			continue
+		}
+		r := []rune(w)
+		r[0] = unicode.ToUpper(r[0])
+		sb.WriteString(string(r))
+	}
+	res := sb.String()
+	if res == "" {
+		return "Field"
+	}
+	if r := []rune(res)[0]; !unicode.IsLetter(r) || !unicode.IsUpper(r) {
+		return "X" + res
+	}
+	return res
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGen(t *testing.T) {
+	sample := `port 8080
+ratio 0.5
+enabled true
+timeout 30s
+delays 0 1m
+tags a b
+max-conns 10
+level nan
+server web {
+    listen 80 443
+    tls { cert a.pem }
+}
+server api { root /api }
+client { tls { verify false } }
+route GET /x { to api }
+log { level info }
+log { file /var/log/app }
+plugin a
+plugin b
+flag
+`
+	code, out, errOut := runCmd(t, sample, "gen", "-package", "app", "-type", "Settings")
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, errOut)
+	}
+	want := "package app\n\nimport \"time\"\n\n" +
+		"// Settings is the top level of the configuration.\n" +
+		"type Settings struct {\n" +
+		"\tPort     int             `conf:\"port\"`\n" +
+		"\tRatio    float64         `conf:\"ratio\"`\n" +
+		"\tEnabled  bool            `conf:\"enabled\"`\n" +
+		"\tTimeout  time.Duration   `conf:\"timeout\"`\n" +
+		"\tDelays   []time.Duration `conf:\"delays\"`\n" +
+		"\tTags     []string        `conf:\"tags\"`\n" +
+		"\tMaxConns int             `conf:\"max-conns\"`\n" +
+		"\tLevel    string          `conf:\"level\"`\n" +
+		"\tServer   []Server        `conf:\"server\"`\n" +
+		"\tClient   Client          `conf:\"client\"`\n" +
+		"\tRoute    []Route         `conf:\"route\"`\n" +
+		"\tLog      []Log           `conf:\"log\"`\n" +
+		"\tPlugin   string          `conf:\"plugin\"` // repeated in the sample: only the last one is kept\n" +
+		"\tFlag     []string        `conf:\"flag\"`\n" +
+		"}\n"
+	if !strings.HasPrefix(out, want) {
+		t.Fatalf("got:\n%s\nwant prefix:\n%s", out, want)
+	}
+	for _, decl := range []string{
+		"type Server struct {\n\tName   string `conf:\",arg\"`\n\tListen []int  `conf:\"listen\"`\n\tTLS    TLS    `conf:\"tls\"`\n\tRoot   string `conf:\"root\"`\n}",
+		"type TLS struct {\n\tCert string `conf:\"cert\"`\n}",
+		"type ClientTLS struct {\n\tVerify bool `conf:\"verify\"`\n}",
+		"type Route struct {\n\tArgs []string `conf:\",arg\"`\n\tTo   string   `conf:\"to\"`\n}",
+		"type Log struct {\n\tLevel string `conf:\"level\"`\n\tFile  string `conf:\"file\"`\n}",
+	} {
+		if !strings.Contains(out, decl) {
+			t.Errorf("output lacks\n%s\ngot:\n%s", decl, out)
+		}
+	}
+}
+
+func TestGen_File(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "app.conf")
+	out := filepath.Join(dir, "config.go")
+	writeFile(t, in, "name app\n")
+	if code, _, errOut := runCmd(t, "", "gen", "-o", out, in); code != 0 {
+		t.Fatalf("exit code %d: %s", code, errOut)
+	}
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "package config\n\n// Config is the top level of the configuration.\ntype Config struct {\n\tName string `conf:\"name\"`\n}\n"
+	if string(got) != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	code, _, errOut := runCmd(t, "a {\n", "gen")
+	if code != 2 || !strings.HasPrefix(errOut, "<standard input>:2:1: ") {
+		t.Fatalf("exit code %d, error output %q", code, errOut)
+	}
+}
+
+func TestGen_Names(t *testing.T) {
+	code, out, errOut := runCmd(t, "on TRUE\noff f\nmixed yes\n- 1\na,b 2\n\"\" 3\n- 4\n", "gen")
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, errOut)
+	}
+	want := "type Config struct {\n\tOn    bool   `conf:\"on\"`\n\tOff   bool   `conf:\"off\"`\n\tMixed string `conf:\"mixed\"`\n}\n"
+	if !strings.HasSuffix(out, want) {
+		t.Errorf("got:\n%s\nwant suffix:\n%s", out, want)
+	}
+	wantErr := "confetti gen: directive \"-\" cannot be named in a conf tag, skipped\n" +
+		"confetti gen: directive \"a,b\" cannot be named in a conf tag, skipped\n" +
+		"confetti gen: directive \"\" cannot be named in a conf tag, skipped\n"
+	if errOut != wantErr {
+		t.Errorf("error output %q, want %q", errOut, wantErr)
+	}
+}
+
+// failWriter fails every write.
+type failWriter struct{}
+
+func (failWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestGen_WriteError(t *testing.T) {
+	var errOut strings.Builder
+	code := run([]string{"gen"}, strings.NewReader("name app\n"), failWriter{}, &errOut)
+	if code != 2 || errOut.String() != "confetti gen: disk full\n" {
+		t.Fatalf("exit code %d, error output %q", code, errOut.String())
+	}
+}
+
+func TestGoName(t *testing.T) {
+	for in, want := range map[string]string{
+		"max-conns":  "MaxConns",
+		"server_id":  "ServerID",
+		"http.proxy": "HTTPProxy",
+		"2fa":        "X2fa",
+		"-":          "Field",
+		"élan":       "Élan",
+	} {
+		if got := goName(in); got != want {
+			t.Errorf("goName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
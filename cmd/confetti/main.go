@@ -0,0 +1,103 @@
+// Command confetti works with Confetti configuration files.
+//
+// Usage:
+//
+//	confetti <command> [flags] [arguments]
+//
+// The commands are:
+//
+//	fmt     format files in canonical style
+//	diff    compare the directives of two files
+//	gen     generate Go structs from a sample file
+//	convert convert between Confetti, JSON, INI, TOML and YAML
+//
+// Run "confetti <command> -h" for the flags of a command. Every command
+// accepts -c, -x and -p to enable the language extensions.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/demen1n/confetti"
+)
+
+// command is a confetti subcommand. run returns the process exit code.
+type command struct {
+	name  string
+	short string
+	run   func(args []string, stdin io.Reader, stdout, stderr io.Writer) int
+}
+
+var commands = []command{
+	{"fmt", "format files in canonical style", runFmt},
+	{"diff", "compare the directives of two files", runDiff},
+	{"gen", "generate Go structs from a sample file", runGen},
+	{"convert", "convert between Confetti, JSON, INI, TOML and YAML", runConvert},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(args[1:], stdin, stdout, stderr)
+		}
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		usage(stdout)
+		return 0
+	}
+	fmt.Fprintf(stderr, "confetti: unknown command %q\n", args[0])
+	usage(stderr)
+	return 2
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: confetti <command> [flags] [arguments]")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-8s%s\n", c.name, c.short)
+	}
+}
+
+// extensionFlags registers the flags enabling the language extensions on fs
+// and returns a function building the Options once fs has been parsed.
+func extensionFlags(fs *flag.FlagSet) func() confetti.Options {
+	cStyle := fs.Bool("c", false, "enable C-style comments (Annex A)")
+	expr := fs.Bool("x", false, "enable expression arguments (Annex B)")
+	puncts := fs.String("p", "", "comma-separated punctuator arguments (Annex C)")
+	return func() confetti.Options {
+		opts := confetti.Options{CStyleComments: *cStyle, ExpressionArguments: *expr}
+		for _, p := range strings.Split(*puncts, ",") {
+			if p != "" {
+				opts.PunctuatorArguments = append(opts.PunctuatorArguments, p)
+			}
+		}
+		return opts
+	}
+}
+
+// describe formats err for the user, prefixing syntax errors with the file
+// name and position the way compilers do.
+func describe(name string, err error) string {
+	var perr *confetti.ParseError
+	if errors.As(err, &perr) {
+		if perr.File != "" {
+			name = perr.File
+		}
+		return fmt.Sprintf("%s:%d:%d: %s", name, perr.Line, perr.Column, perr.Msg)
+	}
+	return fmt.Sprintf("%s: %v", name, err)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// edit is one line of a line-based diff: kept (' '), removed ('-') or
+// added ('+').
+type edit struct {
+	kind byte
+	line string // including its line terminator, if any
+}
+
+// unifiedDiff returns the differences between a and b in unified format,
+// or "" if they are equal.
+func unifiedDiff(nameA, nameB string, a, b []byte) string {
+	edits := diffLines(splitLines(string(a)), splitLines(string(b)))
+
+	// lineA[i] and lineB[i] count the lines of a and b before edits[i]
+	lineA := make([]int, len(edits)+1)
+	lineB := make([]int, len(edits)+1)
+	for i, e := range edits {
+		lineA[i+1], lineB[i+1] = lineA[i], lineB[i]
+		if e.kind != '+' {
+			lineA[i+1]++
+		}
+		if e.kind != '-' {
+			lineB[i+1]++
+		}
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(edits); {
+		if edits[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// extend the hunk while the next change is close enough to share context
+		last := i
+		for j := i + 1; j < len(edits); j++ {
+			if edits[j].kind != ' ' {
+				if j-last-1 > 2*diffContext {
+					break
+				}
+				last = j
+			}
+		}
+		start := max(i-diffContext, 0)
+		end := min(last+diffContext+1, len(edits))
+
+		if sb.Len() == 0 {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", nameA, nameB)
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n",
+			hunkRange(lineA[start], lineA[end]-lineA[start]),
+			hunkRange(lineB[start], lineB[end]-lineB[start]))
+		for _, e := range edits[start:end] {
+			sb.WriteByte(e.kind)
+			sb.WriteString(e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+	return sb.String()
+}
+
+// hunkRange formats the range of a hunk that starts after line before and
+// spans count lines.
+func hunkRange(before, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", before+1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
+
+// splitLines splits s after each "\n".
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns a shortest edit script turning a into b, computed with
+// Myers' algorithm.
+func diffLines(a, b []string) []edit {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1) // v[offset+k] is the furthest x reached on diagonal k
+	var trace [][]int            // trace[d] is v before step d
+
+	d := 0
+search:
+	for ; ; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1] // move down: insert from b
+			} else {
+				x = v[offset+k-1] + 1 // move right: delete from a
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// walk back from (n, m) to recover the path
+	var edits []edit
+	x, y := n, m
+	for ; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			edits = append(edits, edit{' ', a[x-1]})
+			x, y = x-1, y-1
+		}
+		if x == prevX {
+			edits = append(edits, edit{'+', b[y-1]})
+			y--
+		} else {
+			edits = append(edits, edit{'-', a[x-1]})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		edits = append(edits, edit{' ', a[x-1]})
+		x, y = x-1, y-1
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
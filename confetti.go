@@ -1,5 +1,7 @@
 package confetti
 
+import "io"
+
 // Parse parses a Confetti document with no extensions enabled.
 //
 // Syntax errors are reported as *ParseError with line and column information.
@@ -17,3 +19,15 @@ func ParseWithOptions(input string, opts Options) (*ConfigurationUnit, error) {
 	}
 	return p.Parse()
 }
+
+// ParseReader parses a Confetti document read from r, tokenizing it as it is
+// read rather than loading it into memory first. The result, including
+// positions and errors, is the same as ParseWithOptions would return for
+// the whole text; errors reading from r are returned as is.
+func ParseReader(r io.Reader, opts Options) (*ConfigurationUnit, error) {
+	p, err := newParserFromLexer(NewLexerFromReader(r, opts), opts)
+	if err != nil {
+		return nil, err
+	}
+	return p.Parse()
+}
@@ -2,9 +2,11 @@ package confetti
 
 import (
 	"errors"
+	"io"
 	"reflect"
 	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func TestParse_Basic(t *testing.T) {
@@ -115,6 +117,35 @@ func TestUnmarshalWithOptions(t *testing.T) {
 	}
 }
 
+func TestParseReader(t *testing.T) {
+	src := "# routes\nroute a { via 1 }\nroute b {\n  via \"\"\"two\nlines\"\"\"\n}\n"
+	want, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	got, err := ParseReader(iotest.HalfReader(strings.NewReader(src)), Options{})
+	if err != nil {
+		t.Fatalf("ParseReader error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ParseReader mismatch:\n got: %#v\nwant: %#v", got, want)
+	}
+
+	_, wantErr := Parse("a {\n  b \x01\n}")
+	_, err = ParseReader(strings.NewReader("a {\n  b \x01\n}"), Options{})
+	if !reflect.DeepEqual(err, wantErr) {
+		t.Fatalf("ParseReader error = %v, want %v", err, wantErr)
+	}
+}
+
+func TestParseReader_ReadError(t *testing.T) {
+	boom := errors.New("boom")
+	r := io.MultiReader(strings.NewReader("a 1\nb "), iotest.ErrReader(boom))
+	if _, err := ParseReader(r, Options{AllErrors: true}); err != boom {
+		t.Fatalf("got error %v, want %v", err, boom)
+	}
+}
+
 func TestTokenTypeString(t *testing.T) {
 	tests := []struct {
 		typ  TokenType
@@ -0,0 +1,414 @@
+package confetti
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// A Loss is a construct that converting a document from or to another
+// format could not carry over exactly, as reported by ParseINI, ParseTOML,
+// ParseYAML and their Marshal counterparts.
+type Loss struct {
+	Line int // line of the construct in the source document, 0 if unknown
+	Msg  string
+}
+
+func (l Loss) String() string {
+	if l.Line > 0 {
+		return fmt.Sprintf("line %d: %s", l.Line, l.Msg)
+	}
+	return l.Msg
+}
+
+// valueTable is a mapping read from TOML or YAML, with its keys in order.
+// Values are strings, nil, []any or *valueTable.
+type valueTable struct {
+	keys  []string
+	vals  map[string]any
+	lines map[string]int // line of each key
+}
+
+func newValueTable() *valueTable {
+	return &valueTable{vals: make(map[string]any), lines: make(map[string]int)}
+}
+
+func (t *valueTable) set(key string, v any, line int) {
+	if _, ok := t.vals[key]; !ok {
+		t.keys = append(t.keys, key)
+	}
+	t.vals[key] = v
+	t.lines[key] = line
+}
+
+// forbiddenIn returns a message naming the first string in v, a string,
+// []string, []any or *valueTable read from another format, that holds a
+// forbidden character, which arguments cannot hold, or "" if there is none.
+func forbiddenIn(v any) string {
+	switch v := v.(type) {
+	case string:
+		for _, r := range v {
+			if IsForbidden(r) {
+				return fmt.Sprintf("argument %q: forbidden character %U", v, r)
+			}
+		}
+	case []string:
+		for _, s := range v {
+			if msg := forbiddenIn(s); msg != "" {
+				return msg
+			}
+		}
+	case []any:
+		for _, e := range v {
+			if msg := forbiddenIn(e); msg != "" {
+				return msg
+			}
+		}
+	case *valueTable:
+		for _, k := range v.keys {
+			if msg := forbiddenIn(k); msg != "" {
+				return msg
+			}
+			if msg := forbiddenIn(v.vals[k]); msg != "" {
+				return msg
+			}
+		}
+	}
+	return ""
+}
+
+// importer converts values read from another format into directives,
+// recording what does not map exactly.
+type importer struct {
+	losses   []Loss
+	comments []int // lines holding comments, which directives cannot keep
+}
+
+func (im *importer) lose(line int, format string, args ...any) {
+	im.losses = append(im.losses, Loss{Line: line, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (im *importer) comment(line int) {
+	if !slices.Contains(im.comments, line) {
+		im.comments = append(im.comments, line)
+	}
+}
+
+// report returns the losses in order of lines, comments being reported
+// once, at the first of them.
+func (im *importer) report() []Loss {
+	if n := len(im.comments); n > 0 {
+		msg := "1 comment dropped"
+		if n > 1 {
+			msg = fmt.Sprintf("%d comments dropped", n)
+		}
+		im.losses = append(im.losses, Loss{Line: slices.Min(im.comments), Msg: msg})
+	}
+	slices.SortStableFunc(im.losses, func(a, b Loss) int { return a.Line - b.Line })
+	return im.losses
+}
+
+// directives returns the directives for the entries of t: a table becomes
+// a block, an array of scalars a directive with one argument per element,
+// an array of tables or arrays one directive per element, and null a
+// directive without arguments.
+func (im *importer) directives(t *valueTable) []Directive {
+	dirs := []Directive{}
+	for _, k := range t.keys {
+		dirs = append(dirs, im.entry(k, t.vals[k], t.lines[k])...)
+	}
+	return dirs
+}
+
+// entry returns the directives for the value v of key.
+func (im *importer) entry(key string, v any, line int) []Directive {
+	switch v := v.(type) {
+	case nil:
+		return []Directive{{Arguments: []string{key}}}
+	case string:
+		return []Directive{{Arguments: []string{key, v}}}
+	case *valueTable:
+		return []Directive{{Arguments: []string{key}, Subdirectives: im.directives(v)}}
+	}
+
+	elems := v.([]any)
+	args := []string{key}
+	for _, e := range elems {
+		if s, ok := e.(string); ok {
+			args = append(args, s)
+		}
+	}
+	if len(args) == len(elems)+1 {
+		return []Directive{{Arguments: args}}
+	}
+
+	var dirs []Directive
+	tables, arrays := 0, 0
+	for _, e := range elems {
+		switch e := e.(type) {
+		case *valueTable:
+			tables++
+		case []any:
+			arrays++
+			dirs = append(dirs, Directive{Arguments: append([]string{key}, im.flatten(key, e, line)...)})
+			continue
+		}
+		dirs = append(dirs, im.entry(key, e, line)...)
+	}
+	if tables != len(elems) && arrays != len(elems) {
+		im.lose(line, "%s: array mixing values of different kinds written as repeated directives", key)
+	}
+	return dirs
+}
+
+// flatten returns the scalars of the nested array elems, dropping what has
+// no place in the arguments of a directive.
+func (im *importer) flatten(key string, elems []any, line int) []string {
+	var args []string
+	for _, e := range elems {
+		switch e := e.(type) {
+		case string:
+			args = append(args, e)
+		case []any:
+			im.lose(line, "%s: array nested in an array flattened", key)
+			args = append(args, im.flatten(key, e, line)...)
+		case nil:
+			im.lose(line, "%s: null in a nested array dropped", key)
+		default:
+			im.lose(line, "%s: table in a nested array dropped", key)
+		}
+	}
+	return args
+}
+
+// keyTree is a document arranged by directive name, for formats that map
+// keys to values: a directive without a block becomes a keyLeaf and one
+// with a block a keyTree, nested under its inline arguments.
+type keyTree struct {
+	keys  []string
+	vals  map[string][]any    // keyLeaf and *keyTree values, in order
+	keyed map[string]*keyTree // trees holding the blocks with inline arguments, by name
+}
+
+// keyLeaf holds the arguments after the name of a directive without a block.
+type keyLeaf struct {
+	args []string
+	line int
+}
+
+func newKeyTree() *keyTree {
+	return &keyTree{vals: make(map[string][]any), keyed: make(map[string]*keyTree)}
+}
+
+func (t *keyTree) add(key string, v any) {
+	if _, ok := t.vals[key]; !ok {
+		t.keys = append(t.keys, key)
+	}
+	t.vals[key] = append(t.vals[key], v)
+}
+
+// keyedTree returns the tree under key holding blocks with inline arguments,
+// adding it if needed.
+func (t *keyTree) keyedTree(key string) *keyTree {
+	if k, ok := t.keyed[key]; ok {
+		return k
+	}
+	k := newKeyTree()
+	t.keyed[key] = k
+	t.add(key, k)
+	return k
+}
+
+// split returns the leaves and trees under key.
+func (t *keyTree) split(key string) ([]keyLeaf, []*keyTree) {
+	var leaves []keyLeaf
+	var trees []*keyTree
+	for _, v := range t.vals[key] {
+		switch v := v.(type) {
+		case keyLeaf:
+			leaves = append(leaves, v)
+		case *keyTree:
+			trees = append(trees, v)
+		}
+	}
+	return leaves, trees
+}
+
+// exporter converts directives for another format, recording what does not
+// map exactly.
+type exporter struct {
+	losses []Loss
+}
+
+func (ex *exporter) lose(line int, format string, args ...any) {
+	ex.losses = append(ex.losses, Loss{Line: line, Msg: fmt.Sprintf(format, args...)})
+}
+
+// report returns the losses in order of lines.
+func (ex *exporter) report() []Loss {
+	slices.SortStableFunc(ex.losses, func(a, b Loss) int { return a.Line - b.Line })
+	return ex.losses
+}
+
+// tree arranges dirs by name.
+func (ex *exporter) tree(dirs []Directive) *keyTree {
+	t := newKeyTree()
+	for _, d := range dirs {
+		if len(d.Arguments) == 0 {
+			continue
+		}
+		name, args := d.Arguments[0], d.Arguments[1:]
+		line := d.Span.Start.Line
+		if d.Subdirectives == nil && !d.HasBlock() {
+			t.add(name, keyLeaf{args: args, line: line})
+			continue
+		}
+		sub := ex.tree(d.Subdirectives)
+		if len(args) == 0 {
+			t.add(name, sub)
+			continue
+		}
+		ex.lose(line, "%s: inline arguments written as nested keys", name)
+		k := t.keyedTree(name)
+		for _, arg := range args[:len(args)-1] {
+			k = k.keyedTree(arg)
+		}
+		k.add(args[len(args)-1], sub)
+	}
+	return t
+}
+
+// entries returns the leaves and the trees under key, dropping the leaves if
+// there are both, which formats mapping keys to values cannot hold.
+func (ex *exporter) entries(t *keyTree, key string) ([]keyLeaf, []*keyTree) {
+	leaves, trees := t.split(key)
+	if len(leaves) > 0 && len(trees) > 0 {
+		for _, l := range leaves {
+			ex.lose(l.line, "%s: value dropped, the name also has a block", key)
+		}
+		leaves = nil
+	}
+	if len(leaves) > 1 && singleArgs(leaves) {
+		ex.lose(leaves[1].line, "%s: repeated directive written as an array", key)
+	}
+	return leaves, trees
+}
+
+// singleArgs reports whether every leaf has one argument, which makes the
+// array of the leaves an array of scalars. Otherwise, all the elements are
+// written as arrays, which read back as repeated directives.
+func singleArgs(leaves []keyLeaf) bool {
+	for _, l := range leaves {
+		if len(l.args) != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// movedLeaves reports the leaves of t that follow a block, which formats
+// write before the tables of a level.
+func (ex *exporter) movedLeaves(t *keyTree, what string) {
+	block := false
+	for _, k := range t.keys {
+		leaves, trees := t.split(k)
+		if len(trees) > 0 {
+			block = true
+		} else if block && len(leaves) > 0 {
+			ex.lose(leaves[0].line, "%s: moved before the %s", k, what)
+		}
+	}
+}
+
+var (
+	intPattern   = regexp.MustCompile(`^[+-]?(0|[1-9][0-9]*)$`)
+	floatPattern = regexp.MustCompile(`^[+-]?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+)
+
+// isNumber reports whether s is a decimal number as written the same way in
+// TOML and YAML.
+func isNumber(s string) bool {
+	if intPattern.MatchString(s) {
+		_, err := strconv.ParseInt(s, 10, 64)
+		return err == nil
+	}
+	return floatPattern.MatchString(s)
+}
+
+// quoteEscaped returns s in double quotes, with the escapes TOML and YAML
+// share.
+func quoteEscaped(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\r':
+			sb.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&sb, `\u%04X`, r)
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// unescape returns the rune for the escape sequence at the start of s,
+// which follows a backslash, and its length, for the escapes TOML, YAML and
+// INI share. ok is false for an unknown escape.
+func unescape(s string) (r rune, n int, ok bool) {
+	if s == "" {
+		return 0, 0, false
+	}
+	switch s[0] {
+	case 'b':
+		return '\b', 1, true
+	case 't':
+		return '\t', 1, true
+	case 'n':
+		return '\n', 1, true
+	case 'f':
+		return '\f', 1, true
+	case 'r':
+		return '\r', 1, true
+	case '"':
+		return '"', 1, true
+	case '\\':
+		return '\\', 1, true
+	case 'u', 'U':
+		n := 4
+		if s[0] == 'U' {
+			n = 8
+		}
+		if len(s) < n+1 {
+			return 0, 0, false
+		}
+		var v rune
+		for _, c := range s[1 : n+1] {
+			switch {
+			case '0' <= c && c <= '9':
+				v = v*16 + c - '0'
+			case 'a' <= c && c <= 'f':
+				v = v*16 + c - 'a' + 10
+			case 'A' <= c && c <= 'F':
+				v = v*16 + c - 'A' + 10
+			default:
+				return 0, 0, false
+			}
+		}
+		return v, n + 1, true
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,270 @@
+package confetti
+
+import (
+	"io"
+	"strings"
+)
+
+// CST is a concrete syntax tree: the directives of a document together with
+// every byte of source text between them. Unlike [ConfigurationUnit] it keeps
+// comments, blank lines, indentation, the original quoting of arguments,
+// semicolons and line continuations, so String reproduces the input exactly.
+type CST struct {
+	Directives []*CSTDirective
+	Trailing   []Trivia // text after the last directive up to the end of input
+
+	opts Options // options the document was parsed with, for quoting new arguments
+}
+
+// CSTDirective is a directive in a [CST].
+type CSTDirective struct {
+	// Leading holds the text between the previous directive (or the start of
+	// the enclosing block or document) and the first argument: line breaks,
+	// indentation and comments on their own lines.
+	Leading   []Trivia
+	Arguments []*CSTArgument
+	Block     *CSTBlock // nil if the directive has no block
+
+	// Trailing holds the text after the last argument or closing brace on the
+	// same line: a terminating semicolon and a line-end comment, if any. The
+	// line break itself belongs to what follows.
+	Trailing []Trivia
+}
+
+// CSTArgument is an argument of a [CSTDirective].
+type CSTArgument struct {
+	Leading []Trivia // text separating it from the previous argument; empty for the first
+	Raw     string   // source text as written, including quotes and escapes
+	Value   string   // the argument's value, as in Directive.Arguments
+	Span    Span
+}
+
+// CSTBlock is the { ... } block of a [CSTDirective].
+type CSTBlock struct {
+	Leading    []Trivia // text between the last argument and '{'
+	Directives []*CSTDirective
+	Trailing   []Trivia // text after the last subdirective up to '}'
+	LeftBrace  Span
+	RightBrace Span
+}
+
+// TriviaKind identifies the kind of a [Trivia].
+type TriviaKind int
+
+// Trivia kinds.
+const (
+	TriviaSpace            TriviaKind = iota // whitespace, a byte order mark or a final control-Z
+	TriviaNewline                            // a single line terminator; CRLF counts as one
+	TriviaComment                            // a comment, including its # or // or /* */ delimiters
+	TriviaLineContinuation                   // a backslash, line terminator and following whitespace
+	TriviaSemicolon                          // the ';' terminating a directive
+)
+
+// Trivia is a piece of source text that carries no directive content.
+type Trivia struct {
+	Kind TriviaKind
+	Text string
+}
+
+// ParseCST parses a Confetti document into a lossless [CST]. It accepts
+// exactly the documents [ParseWithOptions] accepts and reports the same
+// errors; since a CST is only built for a valid document, it stops at the
+// first error even when Options.AllErrors is set.
+func ParseCST(input string, opts Options) (*CST, error) {
+	p := &Parser{lexer: NewLexerWithOptions(input, opts), limits: opts.Limits, keepTokens: true}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	unit, err := p.Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	b := &cstBuilder{src: input, toks: p.tokens}
+	t := &CST{opts: opts}
+	t.Directives, t.Trailing = b.directives(unit.Directives, len(input))
+	return t, nil
+}
+
+// String returns the document's source text.
+func (t *CST) String() string {
+	var sb strings.Builder
+	writeCSTDirectives(&sb, t.Directives)
+	writeTrivia(&sb, t.Trailing)
+	return sb.String()
+}
+
+// Bytes returns the document's source text.
+func (t *CST) Bytes() []byte {
+	return []byte(t.String())
+}
+
+// WriteTo writes the document's source text to w.
+func (t *CST) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, t.String())
+	return int64(n), err
+}
+
+// Unit returns the document's directives as a [ConfigurationUnit], as
+// [ParseWithOptions] would have returned them.
+func (t *CST) Unit() *ConfigurationUnit {
+	return &ConfigurationUnit{Directives: cstToDirectives(t.Directives)}
+}
+
+// Directive returns d as a [Directive], including its subdirectives and
+// source positions.
+func (d *CSTDirective) Directive() Directive {
+	var dir Directive
+	for _, arg := range d.Arguments {
+		dir.Arguments = append(dir.Arguments, arg.Value)
+		dir.ArgSpans = append(dir.ArgSpans, arg.Span)
+	}
+	if len(d.Arguments) > 0 {
+		dir.Span = Span{Start: d.Arguments[0].Span.Start, End: d.Arguments[len(d.Arguments)-1].Span.End}
+	}
+	if d.Block != nil {
+		dir.Subdirectives = cstToDirectives(d.Block.Directives)
+		dir.LeftBrace = d.Block.LeftBrace
+		dir.RightBrace = d.Block.RightBrace
+		dir.Span.End = d.Block.RightBrace.End
+	}
+	return dir
+}
+
+func cstToDirectives(nodes []*CSTDirective) []Directive {
+	var dirs []Directive
+	for _, n := range nodes {
+		dirs = append(dirs, n.Directive())
+	}
+	return dirs
+}
+
+func writeCSTDirectives(sb *strings.Builder, nodes []*CSTDirective) {
+	for _, d := range nodes {
+		writeTrivia(sb, d.Leading)
+		for _, arg := range d.Arguments {
+			writeTrivia(sb, arg.Leading)
+			sb.WriteString(arg.Raw)
+		}
+		if d.Block != nil {
+			writeTrivia(sb, d.Block.Leading)
+			sb.WriteByte('{')
+			writeCSTDirectives(sb, d.Block.Directives)
+			writeTrivia(sb, d.Block.Trailing)
+			sb.WriteByte('}')
+		}
+		writeTrivia(sb, d.Trailing)
+	}
+}
+
+func writeTrivia(sb *strings.Builder, ts []Trivia) {
+	for _, t := range ts {
+		sb.WriteString(t.Text)
+	}
+}
+
+// cstBuilder attaches the source text around the directives of a parsed
+// document to build its CST. toks holds every token the parser read, so the
+// text between two tokens is whitespace.
+type cstBuilder struct {
+	src  string
+	toks []Token
+	i    int // index of the first token not yet consumed
+	pos  int // offset of the first byte not yet consumed
+}
+
+// directives builds the CST nodes of dirs, which end before offset end. It
+// returns the nodes and the trivia between the last of them and end.
+func (b *cstBuilder) directives(dirs []Directive, end int) ([]*CSTDirective, []Trivia) {
+	var nodes []*CSTDirective
+	var rest []Trivia
+	for i, d := range dirs {
+		n := &CSTDirective{Leading: append(rest, b.trivia(d.Span.Start.Offset)...)}
+		for j, sp := range d.ArgSpans {
+			arg := &CSTArgument{Value: d.Arguments[j], Span: sp}
+			if j > 0 {
+				arg.Leading = b.trivia(sp.Start.Offset)
+			}
+			arg.Raw = b.take(sp)
+			n.Arguments = append(n.Arguments, arg)
+		}
+		if d.HasBlock() {
+			blk := &CSTBlock{LeftBrace: d.LeftBrace, RightBrace: d.RightBrace}
+			blk.Leading = b.trivia(d.LeftBrace.Start.Offset)
+			b.take(d.LeftBrace)
+			blk.Directives, blk.Trailing = b.directives(d.Subdirectives, d.RightBrace.Start.Offset)
+			b.take(d.RightBrace)
+			n.Block = blk
+		}
+
+		next := end
+		if i+1 < len(dirs) {
+			next = dirs[i+1].Span.Start.Offset
+		}
+		n.Trailing, rest = splitTrailing(b.trivia(next))
+		nodes = append(nodes, n)
+	}
+	return nodes, append(rest, b.trivia(end)...)
+}
+
+// take consumes the token covering sp and returns its source text.
+func (b *cstBuilder) take(sp Span) string {
+	b.pos = sp.End.Offset
+	return b.src[sp.Start.Offset:sp.End.Offset]
+}
+
+// trivia consumes the source text up to offset end and splits it into trivia.
+func (b *cstBuilder) trivia(end int) []Trivia {
+	var ts []Trivia
+	for b.pos < end {
+		for b.i < len(b.toks) && (b.toks[b.i].Offset < b.pos || b.toks[b.i].Type == TokenEOF) {
+			b.i++
+		}
+		if b.i < len(b.toks) && b.toks[b.i].Offset == b.pos {
+			tok := b.toks[b.i]
+			ts = append(ts, Trivia{Kind: triviaKind(tok.Type), Text: b.src[tok.Offset:tok.End.Offset]})
+			b.pos = tok.End.Offset
+			continue
+		}
+		next := end
+		if b.i < len(b.toks) && b.toks[b.i].Offset < next {
+			next = b.toks[b.i].Offset
+		}
+		ts = append(ts, Trivia{Kind: TriviaSpace, Text: b.src[b.pos:next]})
+		b.pos = next
+	}
+	return ts
+}
+
+func triviaKind(typ TokenType) TriviaKind {
+	switch typ {
+	case TokenNewline:
+		return TriviaNewline
+	case TokenComment:
+		return TriviaComment
+	case TokenLineContinuation:
+		return TriviaLineContinuation
+	case TokenSemicolon:
+		return TriviaSemicolon
+	}
+	return TriviaSpace
+}
+
+// splitTrailing splits the trivia following a directive into the part on
+// the directive's own line and the rest, which leads into the next one.
+func splitTrailing(ts []Trivia) (trailing, rest []Trivia) {
+	n := len(ts)
+	for i, t := range ts {
+		if t.Kind == TriviaNewline {
+			n = i
+			break
+		}
+	}
+	for n > 0 && ts[n-1].Kind == TriviaSpace {
+		n--
+	}
+	if n == 0 {
+		return nil, ts
+	}
+	return ts[:n:n], ts[n:]
+}
@@ -0,0 +1,124 @@
+package confetti
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCST_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		opts Options
+	}{
+		{"empty", "", Options{}},
+		{"only comments", "# one\n\n   # two\n", Options{}},
+		{"simple", "listen 80\n", Options{}},
+		{"no final newline", "a b c", Options{}},
+		{"semicolons", "a 1; b 2 ;c 3;\n", Options{}},
+		{"blank lines and indentation", "\n\n  a   1\n\n\n\tb\t2  \n\n", Options{}},
+		{"line-end comments", "a 1 # one\nb 2; # two\n", Options{}},
+		{"quoting", "a \"two words\" plain \"\" \"esc\\\"aped\" un\\{quoted\n", Options{}},
+		{"triple quoted", "text \"\"\"line one\n  line two\"\"\" after\n", Options{}},
+		{"continuation", "a one \\\n    two \\\n  three\n", Options{}},
+		{"quoted continuation", "a \"one \\\ntwo\"\n", Options{}},
+		{"blocks", "server web {\n    # comment\n    listen 80\n\n    loc / { root /var }\n}\n", Options{}},
+		{"brace on next line", "server\n# why not\n{\n  x 1\n}; after 1\n", Options{}},
+		{"empty block", "a {}\nb {\n\n}\n", Options{}},
+		{"comment before closing brace", "a {\n  b 1\n  # last\n}\n", Options{}},
+		{"crlf", "a 1\r\nb {\r\n  c 2\r\n}\r\n", Options{}},
+		{"unicode line terminators", "a 1 b 2\u0085c 3\n", Options{}},
+		{"byte order mark", "\xEF\xBB\xBFa 1\n", Options{}},
+		{"control-Z", "a 1\n\x1A", Options{}},
+		{"c-style comments", "// head\na 1 /* mid */ 2 // tail\n/* multi\nline */ b {\n}\n", Options{CStyleComments: true}},
+		{"expressions", "if (x > (1)) { y }\n", Options{ExpressionArguments: true}},
+		{"punctuators", "user:=smith\nx = 1\n", Options{PunctuatorArguments: []string{":=", "="}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := ParseCST(tt.src, tt.opts)
+			if err != nil {
+				t.Fatalf("ParseCST error: %v", err)
+			}
+			if got := tree.String(); got != tt.src {
+				t.Fatalf("round trip mismatch:\n got: %q\nwant: %q", got, tt.src)
+			}
+
+			want, err := ParseWithOptions(tt.src, tt.opts)
+			if err != nil {
+				t.Fatalf("ParseWithOptions error: %v", err)
+			}
+			if got := tree.Unit(); !reflect.DeepEqual(got, want) {
+				t.Fatalf("Unit mismatch:\n got: %#v\nwant: %#v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseCST_Structure(t *testing.T) {
+	src := "# header\n\nport 80 ; # http\nserver web\n{\n    root \"/var/www\"\n    # end\n}\n# footer\n"
+	tree, err := ParseCST(src, Options{})
+	if err != nil {
+		t.Fatalf("ParseCST error: %v", err)
+	}
+	if len(tree.Directives) != 2 {
+		t.Fatalf("got %d directives, want 2", len(tree.Directives))
+	}
+
+	port := tree.Directives[0]
+	wantLeading := []Trivia{{TriviaComment, "# header"}, {TriviaNewline, "\n"}, {TriviaNewline, "\n"}}
+	if !reflect.DeepEqual(port.Leading, wantLeading) {
+		t.Errorf("port leading = %q, want %q", port.Leading, wantLeading)
+	}
+	wantTrailing := []Trivia{{TriviaSpace, " "}, {TriviaSemicolon, ";"}, {TriviaSpace, " "}, {TriviaComment, "# http"}}
+	if !reflect.DeepEqual(port.Trailing, wantTrailing) {
+		t.Errorf("port trailing = %q, want %q", port.Trailing, wantTrailing)
+	}
+	if arg := port.Arguments[1]; arg.Value != "80" || arg.Raw != "80" || !reflect.DeepEqual(arg.Leading, []Trivia{{TriviaSpace, " "}}) {
+		t.Errorf("unexpected argument %+v", arg)
+	}
+
+	server := tree.Directives[1]
+	if server.Block == nil {
+		t.Fatal("server has no block")
+	}
+	if want := []Trivia{{TriviaNewline, "\n"}}; !reflect.DeepEqual(server.Block.Leading, want) {
+		t.Errorf("block leading = %q, want %q", server.Block.Leading, want)
+	}
+	root := server.Block.Directives[0]
+	if arg := root.Arguments[1]; arg.Value != "/var/www" || arg.Raw != `"/var/www"` {
+		t.Errorf("unexpected argument %+v", arg)
+	}
+	wantBlockTrailing := []Trivia{{TriviaNewline, "\n"}, {TriviaSpace, "    "}, {TriviaComment, "# end"}, {TriviaNewline, "\n"}}
+	if !reflect.DeepEqual(server.Block.Trailing, wantBlockTrailing) {
+		t.Errorf("block trailing = %q, want %q", server.Block.Trailing, wantBlockTrailing)
+	}
+	wantTreeTrailing := []Trivia{{TriviaNewline, "\n"}, {TriviaComment, "# footer"}, {TriviaNewline, "\n"}}
+	if !reflect.DeepEqual(tree.Trailing, wantTreeTrailing) {
+		t.Errorf("tree trailing = %q, want %q", tree.Trailing, wantTreeTrailing)
+	}
+}
+
+func TestParseCST_Errors(t *testing.T) {
+	for _, src := range []string{"a {\n", "}", "a \"open", "\xff"} {
+		_, err := ParseCST(src, Options{})
+		_, want := Parse(src)
+		if err == nil || want == nil || err.Error() != want.Error() {
+			t.Errorf("ParseCST(%q) error = %v, want %v", src, err, want)
+		}
+	}
+}
+
+func TestCST_WriteTo(t *testing.T) {
+	src := "a 1 # c\n"
+	tree, err := ParseCST(src, Options{})
+	if err != nil {
+		t.Fatalf("ParseCST error: %v", err)
+	}
+	var sb strings.Builder
+	n, err := tree.WriteTo(&sb)
+	if err != nil || n != int64(len(src)) || sb.String() != src {
+		t.Fatalf("WriteTo = %d, %v, %q", n, err, sb.String())
+	}
+}
@@ -1,7 +1,10 @@
 package confetti
 
 import (
+	"encoding"
+	"errors"
 	"fmt"
+	"net/url"
 	"reflect"
 	"strconv"
 	"strings"
@@ -11,6 +14,11 @@ import (
 // Decode populates v from an already-parsed *ConfigurationUnit.
 // v must be a non-nil pointer to a struct.
 func Decode(cfg *ConfigurationUnit, v any) error {
+	return DecodeWithOptions(cfg, v, DecodeOptions{})
+}
+
+// DecodeWithOptions is like Decode but applies the given decoding options.
+func DecodeWithOptions(cfg *ConfigurationUnit, v any, opts DecodeOptions) error {
 	if cfg == nil {
 		return fmt.Errorf("confetti: Decode called with nil *ConfigurationUnit")
 	}
@@ -22,7 +30,56 @@ func Decode(cfg *ConfigurationUnit, v any) error {
 	if rv.Kind() != reflect.Struct {
 		return fmt.Errorf("confetti: Decode requires a pointer to a struct, got pointer to %s", rv.Kind())
 	}
-	return decodeStruct(cfg.Directives, rv)
+	if opts.Interpolate != nil {
+		var err error
+		if cfg, err = Interpolate(cfg, *opts.Interpolate); err != nil {
+			return err
+		}
+	}
+	d := &decoder{opts: opts}
+	if err := d.decodeStruct(cfg.Directives, rv, decodePath{}); err != nil {
+		return err
+	}
+	return errors.Join(d.deferred...)
+}
+
+// Unmarshaler is implemented by types that decode themselves from a whole
+// directive. UnmarshalConfetti receives the directive the field was matched
+// with — its name, all of its arguments and its subdirectives — and is
+// called once per matching directive. Types that only need a single
+// argument can implement encoding.TextUnmarshaler instead.
+type Unmarshaler interface {
+	UnmarshalConfetti(d Directive) error
+}
+
+// decoder holds the state of a single Decode call.
+type decoder struct {
+	opts     DecodeOptions
+	deferred []error                 // unknown and missing directives, reported once decoding is done
+	mapKeys  map[string]map[any]bool // keys decoded so far, by Go field path of the map
+}
+
+// reportUnknown records dirs, found in the block at path, as unrecognized
+// directives when the decoder disallows them.
+func (d *decoder) reportUnknown(path decodePath, dirs ...Directive) {
+	if !d.opts.DisallowUnknown {
+		return
+	}
+	for _, dir := range dirs {
+		if len(dir.Arguments) == 0 {
+			continue
+		}
+		name := dir.Arguments[0]
+		d.deferred = append(d.deferred, &DecodeError{
+			Path:     path.directive(name).directives,
+			Field:    path.field,
+			Argument: name,
+			File:     dir.File,
+			Line:     dir.Span.Start.Line,
+			Column:   dir.Span.Start.Column,
+			Err:      ErrUnknownDirective,
+		})
+	}
 }
 
 // Unmarshal parses input with no extensions enabled, then calls Decode.
@@ -41,12 +98,17 @@ func UnmarshalWithOptions(input string, v any, opts Options) error {
 
 // fieldInfo holds metadata about a struct field relevant to decoding.
 type fieldInfo struct {
-	index int
+	index      int
+	name       string
+	required   bool   // ",required": the directive must be present
+	hasDefault bool   // ",default=...": def applies when the directive is absent
+	def        string // default value, in directive argument syntax
 }
 
 // structMeta is the result of inspecting a struct type.
 type structMeta struct {
 	byName      map[string]fieldInfo // confetti-name → field index
+	fields      []fieldInfo          // named fields in declaration order
 	argFieldIdx int                  // index of the ",arg" field, -1 if none
 }
 
@@ -66,7 +128,25 @@ func fieldMap(t reflect.Type) structMeta {
 			continue
 		}
 		name, opts, _ := strings.Cut(tag, ",")
-		isArg := opts == "arg"
+		fi := fieldInfo{index: i}
+		isArg := false
+		for opts != "" {
+			var opt string
+			opt, opts, _ = strings.Cut(opts, ",")
+			switch {
+			case opt == "arg":
+				isArg = true
+			case opt == "required":
+				fi.required = true
+			case strings.HasPrefix(opt, "default="):
+				// the default extends to the end of the tag, commas included
+				fi.def, fi.hasDefault = strings.TrimPrefix(opt, "default="), true
+				if opts != "" {
+					fi.def += "," + opts
+					opts = ""
+				}
+			}
+		}
 
 		if isArg {
 			meta.argFieldIdx = i
@@ -76,106 +156,405 @@ func fieldMap(t reflect.Type) structMeta {
 		if name == "" {
 			name = strings.ToLower(f.Name)
 		}
-		meta.byName[name] = fieldInfo{index: i}
+		fi.name = name
+		meta.byName[name] = fi
+		meta.fields = append(meta.fields, fi)
 	}
 	return meta
 }
 
+// decodePath locates the value being decoded, for error messages.
+type decodePath struct {
+	directives []string // directive names from the top level down
+	field      string   // Go field path, e.g. "Servers[1].Timeout"
+	pos        Position // start of the directive being decoded, zero at the top level
+	file       string   // file the directive being decoded was read from, if known
+}
+
+// directive returns p extended by the directive name.
+func (p decodePath) directive(name string) decodePath {
+	dirs := make([]string, len(p.directives), len(p.directives)+1)
+	copy(dirs, p.directives)
+	p.directives = append(dirs, name)
+	return p
+}
+
+// child returns the path of the field named goName, decoded from directive name.
+func (p decodePath) child(name, goName string) decodePath {
+	field := goName
+	if p.field != "" {
+		field = p.field + "." + goName
+	}
+	p.field = field
+	return p.directive(name)
+}
+
+// key returns the path of the entry keyed by k in the map at p.
+func (p decodePath) key(k string) decodePath {
+	p.field = fmt.Sprintf("%s[%q]", p.field, k)
+	return p
+}
+
+// index returns the path of element i of the slice at p.
+func (p decodePath) index(i int) decodePath {
+	p.field = fmt.Sprintf("%s[%d]", p.field, i)
+	return p
+}
+
 // decodeStruct populates the struct value rv from the given directives.
-func decodeStruct(directives []Directive, rv reflect.Value) error {
+func (d *decoder) decodeStruct(directives []Directive, rv reflect.Value, path decodePath) error {
 	t := rv.Type()
 	meta := fieldMap(t)
+	seen := make(map[string]bool)
 
 	for _, dir := range directives {
 		if len(dir.Arguments) == 0 {
 			continue
 		}
 		key := dir.Arguments[0]
-		extraArgs := dir.Arguments[1:]
 
 		fi, ok := meta.byName[key]
 		if !ok {
-			// unknown directive — silently ignore
+			// unknown directive — ignored unless DisallowUnknown is set
+			d.reportUnknown(path, dir)
 			continue
 		}
+		seen[key] = true
 
 		fv := rv.Field(fi.index)
 		ft := t.Field(fi.index)
+		fieldPath := path.child(key, ft.Name)
+		fieldPath.pos, fieldPath.file = dir.Span.Start, dir.File
+
+		if err := d.decodeField(fv, ft.Type, dir, fieldPath); err != nil {
+			return newDecodeError(dir, fieldPath, err)
+		}
+	}
+	return d.applyDefaults(rv, meta, seen, path, true)
+}
+
+// applyDefaults sets the ",default=" value of every field of struct rv whose
+// directive was not seen and that still holds its zero value, descending into
+// nested struct fields. With checkRequired, absent ",required" fields are
+// reported as a single *DecodeError for the block at path.
+func (d *decoder) applyDefaults(rv reflect.Value, meta structMeta, seen map[string]bool, path decodePath, checkRequired bool) error {
+	var missing []string
+	for _, fi := range meta.fields {
+		if seen[fi.name] {
+			continue
+		}
+		fv := rv.Field(fi.index)
+		fieldPath := path.child(fi.name, rv.Type().Field(fi.index).Name)
 
-		if err := decodeField(fv, ft.Type, extraArgs, dir.Subdirectives); err != nil {
-			return fmt.Errorf("confetti: field %q: %w", key, err)
+		switch {
+		case fi.required:
+			missing = append(missing, strconv.Quote(fi.name))
+		case fi.hasDefault:
+			if err := setDefault(fv, fi.def); err != nil {
+				return &DecodeError{
+					Path:  fieldPath.directives,
+					Field: fieldPath.field,
+					Err:   fmt.Errorf("invalid default %q: %w", fi.def, err),
+				}
+			}
+		case isStructElem(fv.Type()) && fv.Kind() == reflect.Struct:
+			if _, ok := asUnmarshaler(fv); ok {
+				continue
+			}
+			// the block is absent: its fields still get their defaults,
+			// but their requirements only apply when it is present
+			if err := d.applyDefaults(fv, fieldMap(fv.Type()), nil, fieldPath, false); err != nil {
+				return err
+			}
 		}
 	}
+
+	if checkRequired && len(missing) > 0 {
+		d.deferred = append(d.deferred, &DecodeError{
+			Path:   path.directives,
+			Field:  path.field,
+			File:   path.file,
+			Line:   path.pos.Line,
+			Column: path.pos.Column,
+			Err:    fmt.Errorf("%w: %s", ErrMissingRequired, strings.Join(missing, ", ")),
+		})
+	}
 	return nil
 }
 
-// decodeField sets field fv (of type fieldType) from extraArgs and subdirectives.
-func decodeField(fv reflect.Value, fieldType reflect.Type, extraArgs []string, subdirs []Directive) error {
+// setDefault sets fv from the default value def unless fv is already set.
+// Slices take def split into whitespace-separated elements.
+func setDefault(fv reflect.Value, def string) error {
+	if !fv.IsZero() {
+		return nil
+	}
+	switch {
+	case fv.Kind() == reflect.Pointer:
+		elem := reflect.New(fv.Type().Elem())
+		if err := setDefault(elem.Elem(), def); err != nil {
+			return err
+		}
+		fv.Set(elem)
+		return nil
+	case fv.Kind() == reflect.Slice && !isTextScalar(fv.Type()):
+		return setScalarSlice(fv, strings.Fields(def))
+	}
+	return setScalar(fv, def)
+}
+
+// newDecodeError wraps err, returned while decoding dir at path, in a
+// *DecodeError. Errors that already are a *DecodeError come from a nested
+// block and are returned unchanged.
+func newDecodeError(dir Directive, path decodePath, err error) error {
+	var derr *DecodeError
+	if errors.As(err, &derr) {
+		return err
+	}
+	derr = &DecodeError{
+		Path:   path.directives,
+		Field:  path.field,
+		File:   dir.File,
+		Line:   dir.Span.Start.Line,
+		Column: dir.Span.Start.Column,
+		Err:    err,
+	}
+	// point at the offending argument when the error concerns a single one
+	var aerr *argError
+	if errors.As(err, &aerr) {
+		i := aerr.index + 1 // skip the directive name
+		if i < len(dir.Arguments) {
+			derr.Argument = dir.Arguments[i]
+		}
+		if i < len(dir.ArgSpans) {
+			derr.Line = dir.ArgSpans[i].Start.Line
+			derr.Column = dir.ArgSpans[i].Start.Column
+		}
+	}
+	return derr
+}
+
+// argError reports a failure to convert a single argument. index counts the
+// arguments following the directive name; -1 denotes the name itself.
+type argError struct {
+	index int
+	err   error
+}
+
+func (e *argError) Error() string { return e.err.Error() }
+
+func (e *argError) Unwrap() error { return e.err }
+
+// decodeField sets field fv (of type fieldType) from the arguments and
+// subdirectives of dir.
+func (d *decoder) decodeField(fv reflect.Value, fieldType reflect.Type, dir Directive, path decodePath) error {
+	extraArgs, subdirs := dir.Arguments[1:], dir.Subdirectives
+
+	// types implementing Unmarshaler consume the whole directive
+	if u, ok := asUnmarshaler(fv); ok {
+		return u.UnmarshalConfetti(dir)
+	}
+
+	switch {
+	case fieldType.Kind() == reflect.Pointer:
+		if fv.IsNil() {
+			fv.Set(reflect.New(fieldType.Elem()))
+		}
+		return d.decodeField(fv.Elem(), fieldType.Elem(), dir, path)
+
+	case isTextScalar(fieldType):
+		// net.IP, time.Time, ... — a single argument despite their kind
+		return d.decodeScalar(fv, extraArgs, subdirs, path)
+	}
+
 	switch fieldType.Kind() {
 	case reflect.Slice:
 		elemType := fieldType.Elem()
 		// []Struct or []*Struct — append a new element decoded from subdirectives
-		if elemType.Kind() == reflect.Struct ||
-			(elemType.Kind() == reflect.Pointer && elemType.Elem().Kind() == reflect.Struct) {
-			return appendStructElem(fv, elemType, extraArgs, subdirs)
+		if isBlockElem(elemType) {
+			return d.appendBlockElem(fv, elemType, dir, path)
 		}
 		// slice of scalars ([]string, []int, []time.Duration, ...) — collect all extra args
+		d.reportUnknown(path, subdirs...)
 		return setScalarSlice(fv, extraArgs)
 
-	case reflect.Struct:
-		return decodeBlockIntoStruct(fv, extraArgs, subdirs)
+	case reflect.Map:
+		return d.decodeMap(fv, dir, path)
 
-	case reflect.Pointer:
-		if fieldType.Elem().Kind() == reflect.Struct {
-			if fv.IsNil() {
-				fv.Set(reflect.New(fieldType.Elem()))
-			}
-			return decodeBlockIntoStruct(fv.Elem(), extraArgs, subdirs)
-		}
-		return fmt.Errorf("unsupported pointer element type %s", fieldType.Elem().Kind())
+	case reflect.Struct:
+		return d.decodeBlockIntoStruct(fv, extraArgs, subdirs, path)
 
 	default:
-		// scalar
-		if len(extraArgs) == 0 {
-			return fmt.Errorf("no value provided")
-		}
-		return setScalar(fv, extraArgs[0])
+		return d.decodeScalar(fv, extraArgs, subdirs, path)
 	}
 }
 
-// appendStructElem decodes a block directive into a new slice element and appends it.
-func appendStructElem(fv reflect.Value, elemType reflect.Type, extraArgs []string, subdirs []Directive) error {
-	isPtr := elemType.Kind() == reflect.Pointer
-	var structType reflect.Type
-	if isPtr {
-		structType = elemType.Elem()
-	} else {
-		structType = elemType
+// decodeScalar sets scalar field fv from the first of extraArgs.
+func (d *decoder) decodeScalar(fv reflect.Value, extraArgs []string, subdirs []Directive, path decodePath) error {
+	d.reportUnknown(path, subdirs...)
+	if len(extraArgs) == 0 {
+		return fmt.Errorf("no value provided")
 	}
-	if structType.Kind() != reflect.Struct {
-		return fmt.Errorf("unsupported slice element type %s", elemType)
+	if err := setScalar(fv, extraArgs[0]); err != nil {
+		return &argError{index: 0, err: err}
 	}
+	return nil
+}
 
-	newElem := reflect.New(structType).Elem()
-	if err := decodeBlockIntoStruct(newElem, extraArgs, subdirs); err != nil {
+// appendBlockElem decodes a block directive into a new slice element and appends it.
+func (d *decoder) appendBlockElem(fv reflect.Value, elemType reflect.Type, dir Directive, path decodePath) error {
+	newElem, err := d.newBlockElem(elemType, dir, path.index(fv.Len()))
+	if err != nil {
 		return err
 	}
+	fv.Set(reflect.Append(fv, newElem))
+	return nil
+}
+
+// newBlockElem decodes dir into a new value of elemType, for which
+// isBlockElem must report true.
+func (d *decoder) newBlockElem(elemType reflect.Type, dir Directive, path decodePath) (reflect.Value, error) {
+	isPtr := elemType.Kind() == reflect.Pointer
+	baseType := elemType
+	if isPtr {
+		baseType = elemType.Elem()
+	}
 
-	var toAppend reflect.Value
+	ptr := reflect.New(baseType)
+	if err := d.decodeField(ptr.Elem(), baseType, dir, path); err != nil {
+		return reflect.Value{}, err
+	}
 	if isPtr {
-		ptr := reflect.New(structType)
-		ptr.Elem().Set(newElem)
-		toAppend = ptr
+		return ptr, nil
+	}
+	return ptr.Elem(), nil
+}
+
+// isStructElem reports whether t is a struct or pointer to struct type
+// holding fields, as opposed to a text scalar such as time.Time.
+func isStructElem(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && !isTextScalar(t)
+}
+
+// isBlockElem reports whether slice and map elements of type t are decoded
+// from a whole directive rather than from a single argument: structs and
+// types implementing Unmarshaler, or pointers to them.
+func isBlockElem(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return isStructElem(t) || reflect.PointerTo(t).Implements(unmarshalerType)
+}
+
+// asUnmarshaler returns the Unmarshaler implemented by the address of fv, if any.
+func asUnmarshaler(fv reflect.Value) (Unmarshaler, bool) {
+	if !fv.CanAddr() {
+		return nil, false
+	}
+	u, ok := fv.Addr().Interface().(Unmarshaler)
+	return u, ok
+}
+
+// isTextScalar reports whether values of type t are decoded from a single
+// argument by setScalar although their kind is not a scalar one.
+func isTextScalar(t reflect.Type) bool {
+	return t == urlType || reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+// decodeMap adds entries to map field fv. A map with struct (or pointer to
+// struct) values gets one entry per directive, keyed by its first inline
+// argument and decoded from its block. Any other map gets one entry per
+// subdirective, keyed by the subdirective's name: a slice value takes all of
+// its arguments, a scalar value the first one.
+func (d *decoder) decodeMap(fv reflect.Value, dir Directive, path decodePath) error {
+	extraArgs, subdirs := dir.Arguments[1:], dir.Subdirectives
+	if fv.IsNil() {
+		fv.Set(reflect.MakeMap(fv.Type()))
+	}
+	elemType := fv.Type().Elem()
+
+	if isBlockElem(elemType) {
+		if len(extraArgs) == 0 {
+			return fmt.Errorf("map entry needs an inline argument as its key")
+		}
+		key, err := d.mapKey(fv, extraArgs[0], path)
+		if err != nil {
+			return &argError{index: 0, err: err}
+		}
+		elem, err := d.newBlockElem(elemType, dir, path.key(extraArgs[0]))
+		if err != nil {
+			return err
+		}
+		fv.SetMapIndex(key, elem)
+		return nil
+	}
+
+	for _, sub := range subdirs {
+		if len(sub.Arguments) == 0 {
+			continue
+		}
+		name := sub.Arguments[0]
+		entryPath := path.key(name).directive(name)
+		if err := d.setMapEntry(fv, sub, path, entryPath); err != nil {
+			return newDecodeError(sub, entryPath, err)
+		}
+	}
+	return nil
+}
+
+// setMapEntry adds the entry described by directive sub to map fv at mapPath.
+func (d *decoder) setMapEntry(fv reflect.Value, sub Directive, mapPath, entryPath decodePath) error {
+	key, err := d.mapKey(fv, sub.Arguments[0], mapPath)
+	if err != nil {
+		return &argError{index: -1, err: err} // the key is the directive name
+	}
+	d.reportUnknown(entryPath, sub.Subdirectives...)
+
+	elem := reflect.New(fv.Type().Elem()).Elem()
+	args := sub.Arguments[1:]
+	if elem.Kind() == reflect.Slice && !isTextScalar(elem.Type()) {
+		if err := setScalarSlice(elem, args); err != nil {
+			return err
+		}
 	} else {
-		toAppend = newElem
+		if len(args) == 0 {
+			return fmt.Errorf("no value provided")
+		}
+		if err := setScalar(elem, args[0]); err != nil {
+			return &argError{index: 0, err: err}
+		}
 	}
-	fv.Set(reflect.Append(fv, toAppend))
+	fv.SetMapIndex(key, elem)
 	return nil
 }
 
+// mapKey converts s to the key type of map fv, rejecting keys already
+// decoded into the map at path by this decoder.
+func (d *decoder) mapKey(fv reflect.Value, s string, path decodePath) (reflect.Value, error) {
+	key := reflect.New(fv.Type().Key()).Elem()
+	if err := setScalar(key, s); err != nil {
+		return reflect.Value{}, fmt.Errorf("map key: %w", err)
+	}
+	if d.mapKeys == nil {
+		d.mapKeys = make(map[string]map[any]bool)
+	}
+	seen := d.mapKeys[path.field]
+	if seen == nil {
+		seen = make(map[any]bool)
+		d.mapKeys[path.field] = seen
+	}
+	if seen[key.Interface()] {
+		return reflect.Value{}, fmt.Errorf("duplicate map key %q", s)
+	}
+	seen[key.Interface()] = true
+	return key, nil
+}
+
 // decodeBlockIntoStruct decodes subdirectives into sv (a struct Value) and sets
 // the ",arg" field (if any) from extraArgs.
-func decodeBlockIntoStruct(sv reflect.Value, extraArgs []string, subdirs []Directive) error {
+func (d *decoder) decodeBlockIntoStruct(sv reflect.Value, extraArgs []string, subdirs []Directive, path decodePath) error {
 	meta := fieldMap(sv.Type())
 
 	// set inline args
@@ -184,7 +563,7 @@ func decodeBlockIntoStruct(sv reflect.Value, extraArgs []string, subdirs []Direc
 	}
 
 	// recurse into subdirectives
-	return decodeStruct(subdirs, sv)
+	return d.decodeStruct(subdirs, sv, path)
 }
 
 // setArgField populates the ",arg" field at argIdx in rv from args.
@@ -213,16 +592,22 @@ func setScalarSlice(fv reflect.Value, args []string) error {
 	sv := reflect.MakeSlice(fv.Type(), len(args), len(args))
 	for i, a := range args {
 		if err := setScalar(sv.Index(i), a); err != nil {
-			return fmt.Errorf("element %d: %w", i, err)
+			return &argError{index: i, err: fmt.Errorf("element %d: %w", i, err)}
 		}
 	}
 	fv.Set(sv)
 	return nil
 }
 
-var durationType = reflect.TypeOf(time.Duration(0))
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	urlType             = reflect.TypeOf(url.URL{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	unmarshalerType     = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+)
 
 // setScalar converts string s to the kind of rv and sets it.
+// Types implementing encoding.TextUnmarshaler parse s themselves.
 func setScalar(rv reflect.Value, s string) error {
 	if rv.Type() == durationType {
 		d, err := time.ParseDuration(s)
@@ -232,6 +617,22 @@ func setScalar(rv reflect.Value, s string) error {
 		rv.SetInt(int64(d))
 		return nil
 	}
+	if rv.Type() == urlType {
+		u, err := url.Parse(s)
+		if err != nil {
+			return fmt.Errorf("cannot parse %q as URL: %w", s, err)
+		}
+		rv.Set(reflect.ValueOf(*u))
+		return nil
+	}
+	if rv.CanAddr() {
+		if tu, ok := rv.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			if err := tu.UnmarshalText([]byte(s)); err != nil {
+				return fmt.Errorf("cannot parse %q as %s: %w", s, rv.Type(), err)
+			}
+			return nil
+		}
+	}
 	switch rv.Kind() {
 	case reflect.String:
 		rv.SetString(s)
@@ -1,6 +1,11 @@
 package confetti
 
 import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
 	"reflect"
 	"strings"
 	"testing"
@@ -353,3 +358,546 @@ func TestDecode_ArgFieldIntSlice(t *testing.T) {
 		t.Fatalf("got %+v, want %+v", got, want)
 	}
 }
+
+func TestDecode_DecodeErrorPosition(t *testing.T) {
+	type Credentials struct {
+		User string `conf:"user"`
+		Port int    `conf:"port"`
+	}
+	type Database struct {
+		Credentials Credentials `conf:"credentials"`
+	}
+	type Config struct {
+		Database Database `conf:"database"`
+	}
+	src := "database {\n  credentials {\n    user admin\n    port abc\n  }\n}\n"
+	var got Config
+	err := Unmarshal(src, &got)
+
+	var derr *DecodeError
+	if !errors.As(err, &derr) {
+		t.Fatalf("error %v (%T) is not a *DecodeError", err, err)
+	}
+	if want := []string{"database", "credentials", "port"}; !reflect.DeepEqual(derr.Path, want) {
+		t.Errorf("Path = %v, want %v", derr.Path, want)
+	}
+	if want := "Database.Credentials.Port"; derr.Field != want {
+		t.Errorf("Field = %q, want %q", derr.Field, want)
+	}
+	if derr.Argument != "abc" || derr.Line != 4 || derr.Column != 10 {
+		t.Errorf("got argument %q at %d:%d, want \"abc\" at 4:10", derr.Argument, derr.Line, derr.Column)
+	}
+	want := `confetti: database > credentials > port (field Database.Credentials.Port): cannot parse "abc" as int`
+	if !strings.HasPrefix(err.Error(), want) || !strings.HasSuffix(err.Error(), "at line 4, column 10") {
+		t.Errorf("Error() = %q", err.Error())
+	}
+}
+
+func TestDecode_DecodeErrorSliceElements(t *testing.T) {
+	type Server struct {
+		Name  string `conf:",arg"`
+		Ports []int  `conf:"ports"`
+	}
+	type Config struct {
+		Servers []Server `conf:"server"`
+	}
+	src := "server web {\n  ports 80\n}\nserver api {\n  ports 80 443 x\n}\n"
+	var got Config
+	err := Unmarshal(src, &got)
+
+	var derr *DecodeError
+	if !errors.As(err, &derr) {
+		t.Fatalf("error %v (%T) is not a *DecodeError", err, err)
+	}
+	if want := "Servers[1].Ports"; derr.Field != want {
+		t.Errorf("Field = %q, want %q", derr.Field, want)
+	}
+	if derr.Argument != "x" || derr.Line != 5 || derr.Column != 16 {
+		t.Errorf("got argument %q at %d:%d, want \"x\" at 5:16", derr.Argument, derr.Line, derr.Column)
+	}
+}
+
+func TestDecode_DecodeErrorWholeDirective(t *testing.T) {
+	type Config struct {
+		Port int `conf:"port"`
+	}
+	var got Config
+	err := Unmarshal("\n  port\n", &got)
+
+	var derr *DecodeError
+	if !errors.As(err, &derr) {
+		t.Fatalf("error %v (%T) is not a *DecodeError", err, err)
+	}
+	if derr.Argument != "" || derr.Line != 2 || derr.Column != 3 {
+		t.Errorf("got argument %q at %d:%d, want directive at 2:3", derr.Argument, derr.Line, derr.Column)
+	}
+
+	// hand-built documents carry no positions
+	cfg := &ConfigurationUnit{Directives: []Directive{{Arguments: []string{"port", "x"}}}}
+	err = Decode(cfg, &got)
+	if !errors.As(err, &derr) {
+		t.Fatalf("error %v (%T) is not a *DecodeError", err, err)
+	}
+	if derr.Line != 0 || strings.Contains(err.Error(), "line") {
+		t.Errorf("unexpected position in %q", err.Error())
+	}
+}
+
+func TestDecodeWithOptions_DisallowUnknown(t *testing.T) {
+	type Location struct {
+		Path string `conf:",arg"`
+		Root string `conf:"root"`
+	}
+	type Server struct {
+		Name      string     `conf:",arg"`
+		Port      int        `conf:"port"`
+		Locations []Location `conf:"location"`
+	}
+	type Config struct {
+		Host    string   `conf:"host"`
+		Servers []Server `conf:"server"`
+	}
+	src := `host example.com
+prot 8080
+server web {
+    port 80
+    location / {
+        rot /var/www
+    }
+}
+server api {
+    port 81 {
+        nested yes
+    }
+    timeout 30
+}
+`
+	cfg := parseOK(t, src)
+
+	// unknown directives are still ignored by default
+	var lenient Config
+	if err := Decode(cfg, &lenient); err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+
+	var got Config
+	err := DecodeWithOptions(cfg, &got, DecodeOptions{DisallowUnknown: true})
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if !errors.Is(err, ErrUnknownDirective) {
+		t.Errorf("error %v does not wrap ErrUnknownDirective", err)
+	}
+
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("error %T does not unwrap to multiple errors", err)
+	}
+	want := []struct {
+		path      string
+		field     string
+		line, col int
+	}{
+		{"prot", "", 2, 1},
+		{"server > location > rot", "Servers[0].Locations[0]", 6, 9},
+		{"server > port > nested", "Servers[1].Port", 11, 9},
+		{"server > timeout", "Servers[1]", 13, 5},
+	}
+	errs := joined.Unwrap()
+	if len(errs) != len(want) {
+		t.Fatalf("got %d errors, want %d: %v", len(errs), len(want), err)
+	}
+	for i, w := range want {
+		var derr *DecodeError
+		if !errors.As(errs[i], &derr) {
+			t.Fatalf("error %d: %v (%T) is not a *DecodeError", i, errs[i], errs[i])
+		}
+		if got := strings.Join(derr.Path, " > "); got != w.path {
+			t.Errorf("error %d: path %q, want %q", i, got, w.path)
+		}
+		if derr.Field != w.field {
+			t.Errorf("error %d: field %q, want %q", i, derr.Field, w.field)
+		}
+		if derr.Line != w.line || derr.Column != w.col {
+			t.Errorf("error %d: at %d:%d, want %d:%d", i, derr.Line, derr.Column, w.line, w.col)
+		}
+	}
+
+	// everything known is still decoded
+	if got.Host != "example.com" || len(got.Servers) != 2 || got.Servers[0].Locations[0].Path != "/" {
+		t.Errorf("unexpected decoded value %+v", got)
+	}
+}
+
+func TestDecode_Maps(t *testing.T) {
+	type Server struct {
+		Name    string `conf:",arg"`
+		Timeout int    `conf:"timeout"`
+	}
+	type Config struct {
+		Env     map[string]string   `conf:"env"`
+		Lists   map[string][]string `conf:"lists"`
+		Codes   map[int]string      `conf:"codes"`
+		Servers map[string]Server   `conf:"server"`
+		Ptrs    map[string]*Server  `conf:"ptr"`
+	}
+	src := `
+env {
+    KEY value
+    OTHER "two words"
+}
+env { THIRD 3 }
+lists {
+    hosts a b c
+    none
+}
+codes { 404 "not found"; 500 error }
+server web { timeout 30 }
+server api { timeout 60 }
+ptr web { timeout 5 }
+`
+	var got Config
+	decodeOK(t, src, &got)
+	want := Config{
+		Env:     map[string]string{"KEY": "value", "OTHER": "two words", "THIRD": "3"},
+		Lists:   map[string][]string{"hosts": {"a", "b", "c"}, "none": {}},
+		Codes:   map[int]string{404: "not found", 500: "error"},
+		Servers: map[string]Server{"web": {Name: "web", Timeout: 30}, "api": {Name: "api", Timeout: 60}},
+		Ptrs:    map[string]*Server{"web": {Name: "web", Timeout: 5}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestDecode_MapErrors(t *testing.T) {
+	type Server struct {
+		Timeout int `conf:"timeout"`
+	}
+	type Config struct {
+		Env     map[string]string `conf:"env"`
+		Ports   map[string]int    `conf:"ports"`
+		Codes   map[int]string    `conf:"codes"`
+		Servers map[string]Server `conf:"server"`
+	}
+	tests := []struct {
+		name      string
+		src       string
+		wantMsg   string
+		wantField string
+		wantArg   string
+		line, col int
+	}{
+		{"duplicate scalar key", "env {\n  A 1\n}\nenv {\n  A 2\n}\n", `duplicate map key "A"`, `Env["A"]`, "A", 5, 3},
+		{"duplicate struct key", "server web {}\nserver web {}\n", `duplicate map key "web"`, "Servers", "web", 2, 8},
+		{"missing struct key", "server {}\n", "needs an inline argument", "Servers", "", 1, 1},
+		{"missing value", "env {\n  A\n}\n", "no value provided", `Env["A"]`, "", 2, 3},
+		{"bad value", "ports {\n  http x\n}\n", `cannot parse "x"`, `Ports["http"]`, "x", 2, 8},
+		{"bad key", "codes {\n  x y\n}\n", "map key", `Codes["x"]`, "x", 2, 3},
+		{"nested field error", "server web {\n  timeout x\n}\n", `cannot parse "x"`, `Servers["web"].Timeout`, "x", 2, 11},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Config
+			err := Unmarshal(tt.src, &got)
+			var derr *DecodeError
+			if !errors.As(err, &derr) {
+				t.Fatalf("error %v (%T) is not a *DecodeError", err, err)
+			}
+			if !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("error %q does not contain %q", err.Error(), tt.wantMsg)
+			}
+			if derr.Field != tt.wantField || derr.Argument != tt.wantArg {
+				t.Errorf("got field %s argument %q, want field %s argument %q", derr.Field, derr.Argument, tt.wantField, tt.wantArg)
+			}
+			if derr.Line != tt.line || derr.Column != tt.col {
+				t.Errorf("got position %d:%d, want %d:%d", derr.Line, derr.Column, tt.line, tt.col)
+			}
+		})
+	}
+}
+
+func TestDecode_MapPrepopulatedIsNotDuplicate(t *testing.T) {
+	type Config struct {
+		Env map[string]string `conf:"env"`
+	}
+	got := Config{Env: map[string]string{"A": "default", "B": "kept"}}
+	decodeOK(t, "env { A override }\n", &got)
+	want := map[string]string{"A": "override", "B": "kept"}
+	if !reflect.DeepEqual(got.Env, want) {
+		t.Fatalf("got %v, want %v", got.Env, want)
+	}
+}
+
+// level is a TextUnmarshaler enum used by the tests below.
+type level int
+
+func (l *level) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "debug":
+		*l = 1
+	case "info":
+		*l = 2
+	default:
+		return errors.New("unknown level")
+	}
+	return nil
+}
+
+func (l level) MarshalText() ([]byte, error) {
+	return []byte(map[level]string{1: "debug", 2: "info"}[l]), nil
+}
+
+// upstream consumes its whole directive via Unmarshaler.
+type upstream struct {
+	Name    string
+	Servers []string
+}
+
+func (u *upstream) UnmarshalConfetti(d Directive) error {
+	if len(d.Arguments) != 2 {
+		return errors.New("upstream needs exactly one name")
+	}
+	u.Name = d.Arguments[1]
+	for _, sub := range d.Subdirectives {
+		if sub.Arguments[0] != "server" {
+			return fmt.Errorf("unexpected %q in upstream", sub.Arguments[0])
+		}
+		u.Servers = append(u.Servers, sub.Arguments[1:]...)
+	}
+	return nil
+}
+
+func TestDecode_TextUnmarshaler(t *testing.T) {
+	type Config struct {
+		IP      net.IP            `conf:"ip"`
+		Allow   []net.IP          `conf:"allow"`
+		Addr    netip.AddrPort    `conf:"addr"`
+		Since   time.Time         `conf:"since"`
+		Level   level             `conf:"level"`
+		Levels  map[string]level  `conf:"levels"`
+		URL     *url.URL          `conf:"url"`
+		Mirror  url.URL           `conf:"mirror"`
+		Retries *int              `conf:"retries"`
+		Times   map[string]net.IP `conf:"hosts"`
+	}
+	src := `
+ip 10.0.0.1
+allow 127.0.0.1 ::1
+addr 192.168.1.1:8080
+since 2024-05-01T10:00:00Z
+level debug
+levels { web info; api debug }
+url "https://example.com/path?q=1"
+mirror http://mirror.local
+retries 3
+hosts { db 10.0.0.2 }
+`
+	var got Config
+	decodeOK(t, src, &got)
+
+	retries := 3
+	want := Config{
+		IP:      net.ParseIP("10.0.0.1"),
+		Allow:   []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
+		Addr:    netip.MustParseAddrPort("192.168.1.1:8080"),
+		Since:   time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		Level:   1,
+		Levels:  map[string]level{"web": 2, "api": 1},
+		URL:     &url.URL{Scheme: "https", Host: "example.com", Path: "/path", RawQuery: "q=1"},
+		Mirror:  url.URL{Scheme: "http", Host: "mirror.local"},
+		Retries: &retries,
+		Times:   map[string]net.IP{"db": net.ParseIP("10.0.0.2")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	out := marshalOK(t, got)
+	var back Config
+	if err := Unmarshal(out, &back); err != nil {
+		t.Fatalf("Unmarshal(Marshal(x)) error: %v\n%s", err, out)
+	}
+	if !reflect.DeepEqual(back, want) {
+		t.Fatalf("round trip mismatch:\n got: %+v\nwant: %+v\ntext:\n%s", back, want, out)
+	}
+}
+
+func TestDecode_TextUnmarshalerError(t *testing.T) {
+	type Config struct {
+		Level level `conf:"level"`
+	}
+	var got Config
+	err := Unmarshal("level loud\n", &got)
+	var derr *DecodeError
+	if !errors.As(err, &derr) {
+		t.Fatalf("error %v (%T) is not a *DecodeError", err, err)
+	}
+	if derr.Argument != "loud" || !strings.Contains(err.Error(), "unknown level") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestDecode_Unmarshaler(t *testing.T) {
+	type Config struct {
+		Main      upstream            `conf:"main"`
+		Upstreams []upstream          `conf:"upstream"`
+		ByName    map[string]upstream `conf:"named"`
+		Optional  *upstream           `conf:"optional"`
+	}
+	src := `
+main primary {
+    server a b
+}
+upstream one { server x }
+upstream two { server y; server z }
+named n1 { server q }
+optional o {}
+`
+	var got Config
+	decodeOK(t, src, &got)
+	want := Config{
+		Main:      upstream{Name: "primary", Servers: []string{"a", "b"}},
+		Upstreams: []upstream{{Name: "one", Servers: []string{"x"}}, {Name: "two", Servers: []string{"y", "z"}}},
+		ByName:    map[string]upstream{"n1": {Name: "n1", Servers: []string{"q"}}},
+		Optional:  &upstream{Name: "o"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestDecode_UnmarshalerError(t *testing.T) {
+	type Config struct {
+		Upstreams []upstream `conf:"upstream"`
+	}
+	var got Config
+	err := Unmarshal("upstream one {}\nupstream two {\n  client x\n}\n", &got)
+	var derr *DecodeError
+	if !errors.As(err, &derr) {
+		t.Fatalf("error %v (%T) is not a *DecodeError", err, err)
+	}
+	if derr.Field != "Upstreams" || derr.Line != 2 || !strings.Contains(err.Error(), `unexpected "client"`) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestDecode_Defaults(t *testing.T) {
+	type Limits struct {
+		Max   int    `conf:"max,default=100"`
+		Label string `conf:"label,default=a, b"`
+	}
+	type Server struct {
+		Name    string        `conf:",arg"`
+		Timeout time.Duration `conf:"timeout,default=30s"`
+		Tags    []string      `conf:"tags,default=web public"`
+		Level   level         `conf:"level,default=info"`
+		Retries *int          `conf:"retries,default=3"`
+	}
+	type Config struct {
+		Host    string   `conf:"host,default=localhost"`
+		Port    int      `conf:"port,default=8080"`
+		Limits  Limits   `conf:"limits"`
+		Servers []Server `conf:"server"`
+		Absent  *Server  `conf:"absent"`
+	}
+	src := "port 9090\nserver web {\n  timeout 5s\n}\nserver api {\n  tags internal\n}\n"
+	var got Config
+	decodeOK(t, src, &got)
+
+	three := 3
+	want := Config{
+		Host:   "localhost",
+		Port:   9090,
+		Limits: Limits{Max: 100, Label: "a, b"},
+		Servers: []Server{
+			{Name: "web", Timeout: 5 * time.Second, Tags: []string{"web", "public"}, Level: 2, Retries: &three},
+			{Name: "api", Timeout: 30 * time.Second, Tags: []string{"internal"}, Level: 2, Retries: &three},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestDecode_DefaultsKeepPrepopulated(t *testing.T) {
+	type Config struct {
+		Host string `conf:"host,default=localhost"`
+	}
+	got := Config{Host: "preset"}
+	decodeOK(t, "", &got)
+	if got.Host != "preset" {
+		t.Fatalf("default overwrote a pre-populated value: got %q", got.Host)
+	}
+}
+
+func TestDecode_InvalidDefault(t *testing.T) {
+	type Config struct {
+		Port int `conf:"port,default=eighty"`
+	}
+	var got Config
+	err := Unmarshal("", &got)
+	var derr *DecodeError
+	if !errors.As(err, &derr) {
+		t.Fatalf("error %v (%T) is not a *DecodeError", err, err)
+	}
+	if derr.Field != "Port" || !strings.Contains(err.Error(), `invalid default "eighty"`) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestDecode_Required(t *testing.T) {
+	type Credentials struct {
+		User     string `conf:"user,required"`
+		Password string `conf:"password,required"`
+	}
+	type Server struct {
+		Name string `conf:",arg"`
+		Port int    `conf:"port,required"`
+	}
+	type Config struct {
+		Host        string       `conf:"host,required"`
+		Mode        string       `conf:"mode,required"`
+		Servers     []Server     `conf:"server"`
+		Credentials *Credentials `conf:"credentials"`
+		Optional    Credentials  `conf:"optional"`
+	}
+	src := "server web {\n  port 80\n}\nserver api {\n}\ncredentials {\n  user admin\n}\n"
+	var got Config
+	err := Unmarshal(src, &got)
+	if !errors.Is(err, ErrMissingRequired) {
+		t.Fatalf("error %v does not wrap ErrMissingRequired", err)
+	}
+
+	want := []struct {
+		msg       string
+		field     string
+		line, col int
+	}{
+		// blocks report in the order they finish decoding
+		{`server (field Servers[1]): missing required directive: "port" at line 4, column 1`, "Servers[1]", 4, 1},
+		{`credentials (field Credentials): missing required directive: "password" at line 6, column 1`, "Credentials", 6, 1},
+		{`confetti: missing required directive: "host", "mode"`, "", 0, 0},
+	}
+	errs := err.(interface{ Unwrap() []error }).Unwrap()
+	if len(errs) != len(want) {
+		t.Fatalf("got %d errors, want %d: %v", len(errs), len(want), err)
+	}
+	for i, w := range want {
+		var derr *DecodeError
+		if !errors.As(errs[i], &derr) {
+			t.Fatalf("error %d: %v (%T) is not a *DecodeError", i, errs[i], errs[i])
+		}
+		if !strings.HasSuffix(derr.Error(), w.msg) {
+			t.Errorf("error %d: %q does not end with %q", i, derr.Error(), w.msg)
+		}
+		if derr.Field != w.field || derr.Line != w.line || derr.Column != w.col {
+			t.Errorf("error %d: got %s at %d:%d, want %s at %d:%d", i, derr.Field, derr.Line, derr.Column, w.field, w.line, w.col)
+		}
+	}
+
+	// everything else is still decoded
+	if got.Servers[0].Port != 80 || got.Credentials.User != "admin" {
+		t.Errorf("unexpected decoded value %+v", got)
+	}
+}
@@ -0,0 +1,234 @@
+package confetti
+
+import (
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ChangeKind identifies the kind of a [Change].
+type ChangeKind int
+
+// Change kinds.
+const (
+	ChangeAdded     ChangeKind = iota + 1 // a directive of b has no counterpart in a
+	ChangeRemoved                         // a directive of a has no counterpart in b
+	ChangeModified                        // a directive has different arguments in b
+	ChangeReordered                       // a directive has moved relative to its siblings
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeModified:
+		return "changed"
+	case ChangeReordered:
+		return "reordered"
+	}
+	return "ChangeKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Change is a difference between two configurations reported by [Diff].
+type Change struct {
+	Kind ChangeKind
+
+	// Path identifies the directive in the selector syntax of
+	// [ConfigurationUnit.Query], such as server[api].timeout: each step is
+	// a directive name, with the inline arguments of directives that have a
+	// block in brackets.
+	Path string
+
+	Old *Directive // the directive in a, nil if Kind is ChangeAdded
+	New *Directive // the directive in b, nil if Kind is ChangeRemoved
+}
+
+// String describes c on one line, as in
+//
+//	server[api].timeout changed 60 → 90
+func (c Change) String() string {
+	var sb strings.Builder
+	sb.WriteString(c.Path)
+	sb.WriteByte(' ')
+	sb.WriteString(c.Kind.String())
+	switch c.Kind {
+	case ChangeAdded:
+		writeValue(&sb, c.New)
+	case ChangeRemoved:
+		writeValue(&sb, c.Old)
+	case ChangeModified:
+		writeValue(&sb, c.Old)
+		sb.WriteString(" →")
+		writeValue(&sb, c.New)
+	}
+	return sb.String()
+}
+
+// writeValue writes the arguments of d after its name, unless they are
+// part of its path.
+func writeValue(sb *strings.Builder, d *Directive) {
+	if d.HasBlock() {
+		return
+	}
+	for _, arg := range d.Arguments[min(1, len(d.Arguments)):] {
+		sb.WriteByte(' ')
+		q, err := quoteArgument(arg)
+		if err != nil {
+			q = strconv.Quote(arg)
+		}
+		sb.WriteString(q)
+	}
+}
+
+// Diff returns the differences between the configurations a and b.
+//
+// Directives are aligned level by level. A directive of a and one of b at
+// the same level correspond if they have the same arguments, or, for
+// directives without a block, the same name; the arguments of the latter
+// are their value, which may have changed. Directives with a block are
+// thus identified by their name and inline arguments, as server api { }
+// is, and their blocks are compared in turn. Several directives with the
+// same identity correspond in the order they appear.
+//
+// A directive is reported as added or removed if it has no counterpart,
+// as changed if its arguments differ, and as reordered if it is not in
+// the same order relative to the other directives of its level that
+// have counterparts. The changes of each level come in the order of b,
+// after the directives removed from it; those within a block follow the
+// change of the directive, if any.
+func Diff(a, b *ConfigurationUnit) []Change {
+	return diffDirectives(a.Directives, b.Directives, "", nil)
+}
+
+// diffDirectives appends to res the differences between the directives
+// as and bs, found at path.
+func diffDirectives(as, bs []Directive, path string, res []Change) []Change {
+	match := alignDirectives(as, bs)
+	matched := make([]bool, len(as))
+	for _, i := range match {
+		if i >= 0 {
+			matched[i] = true
+		}
+	}
+	for i := range as {
+		if !matched[i] {
+			res = append(res, Change{Kind: ChangeRemoved, Path: diffPath(path, &as[i]), Old: &as[i]})
+		}
+	}
+
+	inOrder := increasingSubsequence(match)
+	for j := range bs {
+		nd := &bs[j]
+		if match[j] < 0 {
+			res = append(res, Change{Kind: ChangeAdded, Path: diffPath(path, nd), New: nd})
+			continue
+		}
+		od := &as[match[j]]
+		p := diffPath(path, od)
+		if !od.HasBlock() {
+			p = diffPath(path, nd) // for subdirectives if nd has gained a block
+		}
+		if !slices.Equal(od.Arguments, nd.Arguments) {
+			res = append(res, Change{Kind: ChangeModified, Path: p, Old: od, New: nd})
+		}
+		if !inOrder[j] {
+			res = append(res, Change{Kind: ChangeReordered, Path: p, Old: od, New: nd})
+		}
+		res = diffDirectives(od.Subdirectives, nd.Subdirectives, p, res)
+	}
+	return res
+}
+
+// alignDirectives returns, for each directive of bs, the index of the
+// corresponding directive of as, or -1.
+func alignDirectives(as, bs []Directive) []int {
+	match := make([]int, len(bs))
+	for j := range match {
+		match[j] = -1
+	}
+	matched := make([]bool, len(as))
+	pair := func(key func(d *Directive) (string, bool)) {
+		queues := make(map[string][]int)
+		for i := range as {
+			if k, ok := key(&as[i]); ok && !matched[i] {
+				queues[k] = append(queues[k], i)
+			}
+		}
+		for j := range bs {
+			k, ok := key(&bs[j])
+			if !ok || match[j] >= 0 || len(queues[k]) == 0 {
+				continue
+			}
+			match[j], queues[k] = queues[k][0], queues[k][1:]
+			matched[match[j]] = true
+		}
+	}
+	pair(func(d *Directive) (string, bool) {
+		return strings.Join(d.Arguments, "\x00"), true
+	})
+	pair(func(d *Directive) (string, bool) {
+		if d.HasBlock() || len(d.Arguments) == 0 {
+			return "", false
+		}
+		return d.Arguments[0], true
+	})
+	return match
+}
+
+// increasingSubsequence reports, for each element of match, whether it
+// belongs to a longest increasing subsequence of its non-negative
+// elements.
+func increasingSubsequence(match []int) []bool {
+	// tails[k] is the index in match of the smallest last element of the
+	// increasing subsequences of length k+1 found so far
+	var tails []int
+	prev := make([]int, len(match))
+	for j, i := range match {
+		if i < 0 {
+			continue
+		}
+		k := sort.Search(len(tails), func(k int) bool { return match[tails[k]] >= i })
+		prev[j] = -1
+		if k > 0 {
+			prev[j] = tails[k-1]
+		}
+		if k == len(tails) {
+			tails = append(tails, j)
+		} else {
+			tails[k] = j
+		}
+	}
+	res := make([]bool, len(match))
+	if len(tails) > 0 {
+		for j := tails[len(tails)-1]; j >= 0; j = prev[j] {
+			res[j] = true
+		}
+	}
+	return res
+}
+
+// diffPath returns the path of d, found at path.
+func diffPath(path string, d *Directive) string {
+	var sb strings.Builder
+	if path != "" {
+		sb.WriteString(path)
+		sb.WriteByte('.')
+	}
+	if len(d.Arguments) > 0 {
+		sb.WriteString(escapeSelector(d.Arguments[0]))
+	}
+	if d.HasBlock() && len(d.Arguments) > 1 {
+		sb.WriteByte('[')
+		for i, arg := range d.Arguments[1:] {
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			sb.WriteString(escapeSelector(arg))
+		}
+		sb.WriteByte(']')
+	}
+	return sb.String()
+}
@@ -0,0 +1,102 @@
+package confetti
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []string
+	}{
+		{"equal", "a 1\nb { c 2 }\n", "a 1\nb { c 2 }\n", nil},
+		{"changed value", "timeout 60\n", "timeout 90\n", []string{"timeout changed 60 → 90"}},
+		{
+			"nested by inline arguments",
+			"server web { timeout 30 }\nserver api { timeout 60 }\n",
+			"server web { timeout 30 }\nserver api { timeout 90 }\n",
+			[]string{"server[api].timeout changed 60 → 90"},
+		},
+		{
+			"added and removed",
+			"a 1\nb 2\nserver web { }\n",
+			"a 1\nc 3\nserver api { }\n",
+			[]string{"b removed 2", "server[web] removed", "c added 3", "server[api] added"},
+		},
+		{
+			"reordered",
+			"a 1\nb 2\nc 3\n",
+			"b 2\nc 3\na 1\n",
+			[]string{"a reordered"},
+		},
+		{
+			"reordered and changed",
+			"a 1\nb 2\n",
+			"b 2\na 5\n",
+			[]string{"b reordered", "a changed 1 → 5"},
+		},
+		{
+			"repeated directives",
+			"listen 80\nlisten 443\n",
+			"listen 443\nlisten 8443\n",
+			[]string{"listen reordered", "listen changed 80 → 8443"},
+		},
+		{
+			"leaf gains a block",
+			"log stdout\n",
+			"log stdout { level debug }\n",
+			[]string{"log[stdout].level added debug"},
+		},
+		{
+			"block with different arguments",
+			"tls on\n",
+			"tls { cert x }\n",
+			[]string{"tls removed on", "tls added"},
+		},
+		{
+			"quoting and escaping",
+			"\"a.b\" x\nm \"hello world\"\n",
+			"\"a.b\" y\nm \"\"\n",
+			[]string{`a\.b changed x → y`, `m changed "hello world" → ""`},
+		},
+	}
+	for _, tt := range tests {
+		a, err := Parse(tt.a)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		b, err := Parse(tt.b)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var got []string
+		for _, c := range Diff(a, b) {
+			got = append(got, c.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s:\n got: %q\nwant: %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDiff_PathQuery(t *testing.T) {
+	a, _ := Parse("server \"my site\" { route /a.b { limit 1 } }\n")
+	b, _ := Parse("server \"my site\" { route /a.b { limit 2 } }\n")
+	changes := Diff(a, b)
+	if len(changes) != 1 {
+		t.Fatalf("got %d changes, want 1", len(changes))
+	}
+	c := changes[0]
+	if c.Kind != ChangeModified || c.Old.Span.Start.Line != 1 || c.New.Arguments[1] != "2" {
+		t.Errorf("unexpected change %+v", c)
+	}
+	matches, err := b.Query(c.Path)
+	if err != nil {
+		t.Fatalf("Query(%q): %v", c.Path, err)
+	}
+	if len(matches) != 1 || matches[0].Directive != c.New {
+		t.Errorf("Query(%q) = %v, want the changed directive", c.Path, matches)
+	}
+}
@@ -24,6 +24,12 @@
 //		fmt.Println(d.Arguments, len(d.Subdirectives))
 //	}
 //
+// Each parsed [Directive] records the source [Span] of the whole directive,
+// of every argument and of its block's braces. [ParseReader] parses from an
+// io.Reader, tokenizing the input as it is read, and [Decoder] goes further,
+// returning the document as a stream of [Event] values without building the
+// tree at all.
+//
 // # Decoding into structs
 //
 // [Unmarshal] populates a struct from a document, similar to encoding/json.
@@ -39,9 +45,99 @@
 //	var cfg Config
 //	err := confetti.Unmarshal(input, &cfg)
 //
+// Maps are decoded from blocks: `env { KEY value }` fills a map[string]string,
+// while each `server web { ... }` directive adds an entry keyed "web" to a
+// map[string]Server.
+//
+// Fields whose type implements encoding.TextUnmarshaler (net.IP, time.Time,
+// ...) are decoded from a single argument; types implementing [Unmarshaler]
+// receive the whole directive.
+//
 // The tag `conf:",arg"` captures the inline arguments of a block directive,
-// and `conf:"-"` skips a field. See [Decode] for decoding an already-parsed
-// [ConfigurationUnit].
+// and `conf:"-"` skips a field. The options `conf:"name,required"` and
+// `conf:"name,default=30s"` mark a directive as mandatory or give the value
+// used when it is absent; missing required directives are reported together
+// as a [*DecodeError] wrapping [ErrMissingRequired]. See [Decode] for
+// decoding an already-parsed [ConfigurationUnit]. Directives that match no field are ignored, unless
+// [DecodeOptions].DisallowUnknown is set with [DecodeWithOptions].
+//
+// # Encoding
+//
+// [Marshal] is the reverse of [Unmarshal]: it writes a struct (or a parsed
+// [ConfigurationUnit]) back out as Confetti text, following the same tag
+// rules and quoting arguments only where needed. [Encoder] does the same
+// for an io.Writer.
+//
+// # Syntax trees
+//
+// [ParseCST] returns a lossless [CST] that keeps comments, blank lines,
+// indentation, quoting, semicolons and line continuations alongside the
+// directives; printing it reproduces the input byte for byte, which makes it
+// the starting point for tools that rewrite configuration files. [Format]
+// uses it to print a document in canonical style with its comments intact;
+// the confetti command (cmd/confetti) provides it as "confetti fmt".
+//
+// # Editing
+//
+// Directives are addressed for editing by index, their position at each
+// nesting level, as reported in [Match].Index. [ConfigurationUnit.Insert],
+// [ConfigurationUnit.Remove], [ConfigurationUnit.Replace] and
+// [ConfigurationUnit.Move] edit a parsed document, and methods of the same
+// names on [CST] edit a syntax tree while keeping the comments and layout of
+// the rest of the file, so that a tool can change one value in place.
+// [Diff] compares two documents directive by directive, reporting the
+// directives added, removed, changed or reordered; "confetti diff" prints
+// the result.
+//
+// # Includes
+//
+// [ParseFS] reads a document from an fs.FS and, when [Options].Include is
+// set, replaces include directives with the directives of the files they
+// name, resolving globs and relative paths and reporting include cycles.
+// Directives and errors record the file they come from.
+//
+// # Queries
+//
+// [ConfigurationUnit.Find], [ConfigurationUnit.FindAll] and
+// [ConfigurationUnit.Query] look directives up by path, the latter with
+// selectors such as server[web].timeout that also match inline arguments.
+// [Get] and getters such as [ConfigurationUnit.GetInt] convert the value of
+// a directive found by path, without declaring a struct.
+//
+// # Interpolation
+//
+// [Interpolate] substitutes ${NAME} and ${NAME:-default} in the arguments of
+// a parsed document, from other directives referred to by path, such as
+// ${database.host}, or from a lookup function that reads the environment by
+// default. [DecodeOptions].Interpolate does the same while decoding.
+//
+// # Schemas
+//
+// [ParseSchema] reads a schema, written in Confetti, that declares the
+// directives allowed in each block with their argument counts and types
+// and whether they are required or repeatable. [Validate] checks a document
+// against it and reports each violation with its position. [SchemaOf] and
+// [Template] generate a schema and a commented sample configuration from
+// the structs given to Decode; "confetti gen" does the reverse, inferring
+// struct types from a sample document.
+//
+// # Other formats
+//
+// [ConfigurationUnit] and [Directive] implement json.Marshaler and
+// json.Unmarshaler losslessly, as arrays of arguments and subdirectives.
+// [ConfigurationUnit.Object] projects a document onto nested maps keyed by
+// directive name, for reading. [ParseINI], [ParseTOML] and [ParseYAML]
+// import documents from those formats, and [MarshalINI], [MarshalTOML] and
+// [MarshalYAML] export them, each reporting what could not be converted
+// exactly as a [Loss]. "confetti convert" converts files between all of
+// them.
+//
+// # Merging
+//
+// [Merge] applies an overlay configuration on top of a base one, replacing,
+// appending to or deep-merging directives by name, with an optional marker
+// directive that deletes base directives. [DecodeMerged] merges several
+// layers in order and decodes the result.
 //
 // # Extensions
 //
@@ -53,5 +149,13 @@
 // # Errors
 //
 // Syntax errors are reported as [*ParseError] carrying the 1-based line and
-// column of the offending input; retrieve it with errors.As.
+// column of the offending input; retrieve it with errors.As. With
+// [Options].AllErrors the parser recovers from errors and reports all of
+// them at once as an [ErrorList], alongside the directives it could parse. Decoding
+// failures are reported as [*DecodeError], which additionally carries the
+// directive path (e.g. database > credentials > port) and the Go field path.
+//
+// [Options].Limits bounds the input size, nesting depth, argument count,
+// directive count and argument length of documents from untrusted sources;
+// exceeding one is a [*ParseError] wrapping a sentinel such as [ErrMaxDepth].
 package confetti
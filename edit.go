@@ -0,0 +1,662 @@
+package confetti
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Directives are edited in place by position. An index, as in Match.Index,
+// holds the position of a directive within the top level, then within the
+// block of each enclosing directive: []int{2, 0} is the first subdirective
+// of the third top-level directive.
+
+// SetArguments replaces the arguments that follow d's name with args.
+// Arguments that keep their value at the same position keep their source
+// positions; the others get zero spans. If d has no name, as a zero
+// Directive, args become all its arguments, the first being the name.
+func (d *Directive) SetArguments(args ...string) {
+	if len(d.Arguments) == 0 {
+		d.Arguments = slices.Clone(args)
+		d.ArgSpans = make([]Span, len(args))
+		return
+	}
+	spans := make([]Span, 1+len(args))
+	for i, arg := range args {
+		if i+1 < len(d.Arguments) && i+1 < len(d.ArgSpans) && d.Arguments[i+1] == arg {
+			spans[i+1] = d.ArgSpans[i+1]
+		}
+	}
+	if len(d.ArgSpans) > 0 {
+		spans[0] = d.ArgSpans[0]
+	}
+	d.Arguments = append(d.Arguments[:1:1], args...)
+	d.ArgSpans = spans
+}
+
+// Append adds subs at the end of d's block.
+func (d *Directive) Append(subs ...Directive) {
+	d.Subdirectives = append(d.Subdirectives, subs...)
+}
+
+// At returns the directive at index, or nil if there is none.
+func (cf *ConfigurationUnit) At(index ...int) *Directive {
+	list, i, err := cf.list(index, false)
+	if err != nil {
+		return nil
+	}
+	return &(*list)[i]
+}
+
+// list returns the list holding the directive at index and its position in
+// it. With insert, the position may be one past the end of the list.
+func (cf *ConfigurationUnit) list(index []int, insert bool) (*[]Directive, int, error) {
+	if len(index) == 0 {
+		return nil, 0, indexError(index)
+	}
+	list := &cf.Directives
+	for _, i := range index[:len(index)-1] {
+		if i < 0 || i >= len(*list) {
+			return nil, 0, indexError(index)
+		}
+		list = &(*list)[i].Subdirectives
+	}
+	i := index[len(index)-1]
+	if i < 0 || i > len(*list) || (i == len(*list) && !insert) {
+		return nil, 0, indexError(index)
+	}
+	return list, i, nil
+}
+
+func indexError(index []int) error {
+	return fmt.Errorf("confetti: no directive at index %v", index)
+}
+
+// Insert inserts dirs before the directive at index. The last element of
+// index may be the length of the list, to append; inserting into a
+// directive without a block gives it one.
+func (cf *ConfigurationUnit) Insert(index []int, dirs ...Directive) error {
+	list, i, err := cf.list(index, true)
+	if err != nil {
+		return err
+	}
+	*list = slices.Insert(*list, i, dirs...)
+	return nil
+}
+
+// Remove removes the directive at index and returns it.
+func (cf *ConfigurationUnit) Remove(index []int) (Directive, error) {
+	list, i, err := cf.list(index, false)
+	if err != nil {
+		return Directive{}, err
+	}
+	d := (*list)[i]
+	*list = slices.Delete(*list, i, i+1)
+	return d, nil
+}
+
+// Replace replaces the directive at index with d.
+func (cf *ConfigurationUnit) Replace(index []int, d Directive) error {
+	list, i, err := cf.list(index, false)
+	if err != nil {
+		return err
+	}
+	(*list)[i] = d
+	return nil
+}
+
+// Move moves the directive at from to before the directive at to, both
+// indexes denoting positions before the move. The last element of to may
+// be the length of its list, to move the directive to the end.
+func (cf *ConfigurationUnit) Move(from, to []int) error {
+	if _, _, err := cf.list(to, true); err != nil {
+		return err
+	}
+	to, err := moveTarget(from, to)
+	if err != nil {
+		return err
+	}
+	d, err := cf.Remove(from)
+	if err != nil {
+		return err
+	}
+	return cf.Insert(to, d)
+}
+
+// moveTarget returns the index to, given before from is removed, as it is
+// once from is removed.
+func moveTarget(from, to []int) ([]int, error) {
+	n := len(from)
+	if n == 0 {
+		return nil, indexError(from)
+	}
+	if len(to) > n && slices.Equal(from, to[:n]) {
+		return nil, fmt.Errorf("confetti: cannot move directive %v into itself", from)
+	}
+	to = slices.Clone(to)
+	if len(to) >= n && slices.Equal(from[:n-1], to[:n-1]) && to[n-1] > from[n-1] {
+		to[n-1]--
+	}
+	return to, nil
+}
+
+// NewDirective returns d as a CST directive, with its arguments quoted where
+// needed and its block, if any, laid out one subdirective per line, ready to
+// be added with Insert, Append or Replace. Its indentation is adjusted to
+// where it is added.
+func (t *CST) NewDirective(d Directive) (*CSTDirective, error) {
+	return t.newDirective(d, "")
+}
+
+func (t *CST) newDirective(d Directive, indent string) (*CSTDirective, error) {
+	if len(d.Arguments) == 0 {
+		return nil, fmt.Errorf("confetti: directive must have at least one argument")
+	}
+	n := &CSTDirective{}
+	for i, arg := range d.Arguments {
+		a, err := t.newArgument(arg)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			a.Leading = []Trivia{{TriviaSpace, " "}}
+		}
+		n.Arguments = append(n.Arguments, a)
+	}
+	if d.HasBlock() {
+		n.Block = &CSTBlock{Leading: []Trivia{{TriviaSpace, " "}}}
+		for _, sub := range d.Subdirectives {
+			s, err := t.newDirective(sub, indent+defaultIndent)
+			if err != nil {
+				return nil, err
+			}
+			s.Leading = lineStart(indent + defaultIndent)
+			n.Block.Directives = append(n.Block.Directives, s)
+		}
+		if len(d.Subdirectives) > 0 {
+			n.Block.Trailing = lineStart(indent)
+		}
+	}
+	return n, nil
+}
+
+func (t *CST) newArgument(value string) (*CSTArgument, error) {
+	raw, err := quoteArgumentWith(value, t.opts)
+	if err != nil {
+		return nil, fmt.Errorf("confetti: cannot write argument %q: %w", value, err)
+	}
+	return &CSTArgument{Raw: raw, Value: value}, nil
+}
+
+// lineStart returns the trivia starting a new line indented by indent.
+func lineStart(indent string) []Trivia {
+	if indent == "" {
+		return []Trivia{{TriviaNewline, "\n"}}
+	}
+	return []Trivia{{TriviaNewline, "\n"}, {TriviaSpace, indent}}
+}
+
+// At returns the directive at index, or nil if there is none.
+func (t *CST) At(index ...int) *CSTDirective {
+	list, _, i, err := t.list(index, false)
+	if err != nil {
+		return nil
+	}
+	return (*list)[i]
+}
+
+// list returns the list holding the directive at index, the directive whose
+// block it is (nil at the top level) and the position in the list. With
+// insert, the position may be one past the end of the list, and the list
+// may be the missing block of a directive.
+func (t *CST) list(index []int, insert bool) (*[]*CSTDirective, *CSTDirective, int, error) {
+	if len(index) == 0 {
+		return nil, nil, 0, indexError(index)
+	}
+	list := &t.Directives
+	var parent *CSTDirective
+	for _, i := range index[:len(index)-1] {
+		if i < 0 || i >= len(*list) {
+			return nil, nil, 0, indexError(index)
+		}
+		parent = (*list)[i]
+		if parent.Block == nil {
+			if !insert || index[len(index)-1] != 0 {
+				return nil, nil, 0, indexError(index)
+			}
+			list = new([]*CSTDirective)
+			continue
+		}
+		list = &parent.Block.Directives
+	}
+	i := index[len(index)-1]
+	if i < 0 || i > len(*list) || (i == len(*list) && !insert) {
+		return nil, nil, 0, indexError(index)
+	}
+	return list, parent, i, nil
+}
+
+// SetArguments replaces the arguments that follow the name of the directive
+// at index with args. Arguments that keep their value keep their source
+// text; new ones are quoted where needed and separated by a space.
+func (t *CST) SetArguments(index []int, args ...string) error {
+	d := t.At(index...)
+	if d == nil {
+		return indexError(index)
+	}
+	if len(d.Arguments) == 0 {
+		return fmt.Errorf("confetti: directive must have at least one argument")
+	}
+	res := d.Arguments[:1:1]
+	for i, arg := range args {
+		if i+1 < len(d.Arguments) && d.Arguments[i+1].Value == arg {
+			res = append(res, d.Arguments[i+1])
+			continue
+		}
+		a, err := t.newArgument(arg)
+		if err != nil {
+			return err
+		}
+		a.Leading = []Trivia{{TriviaSpace, " "}}
+		if i+1 < len(d.Arguments) && len(d.Arguments[i+1].Leading) > 0 {
+			a.Leading = d.Arguments[i+1].Leading
+		}
+		if next := i + 2; next < len(d.Arguments) && len(d.Arguments[next].Leading) == 0 {
+			// the next argument touched the one replaced
+			d.Arguments[next].Leading = []Trivia{{TriviaSpace, " "}}
+		}
+		res = append(res, a)
+	}
+	d.Arguments = res
+	if len(d.Trailing) > 0 && d.Trailing[0].Kind == TriviaLineContinuation {
+		// the backslash may follow a new last argument
+		d.Trailing = append([]Trivia{{TriviaSpace, " "}}, d.Trailing...)
+	}
+	return nil
+}
+
+// Insert inserts dirs before the directive at index, as
+// [ConfigurationUnit.Insert] does. Each is given a line of its own, with the
+// indentation of its neighbours and its block indented like the others in
+// the document, or is separated by semicolons in a block written on a
+// single line; comments on the lines before a directive move with it. The
+// rest of the document is left as it is.
+func (t *CST) Insert(index []int, dirs ...*CSTDirective) error {
+	list, parent, i, err := t.list(index, true)
+	if err != nil {
+		return err
+	}
+	if parent != nil && parent.Block == nil {
+		parent.Block = &CSTBlock{Leading: []Trivia{{TriviaSpace, " "}}}
+		parent.Trailing = lineEnd(parent.Trailing, true)
+		list = &parent.Block.Directives
+		if siblings, _, j, _ := t.list(index[:len(index)-1], false); j+1 < len(*siblings) {
+			separate(parent, (*siblings)[j+1])
+		}
+	}
+	for k, d := range dirs {
+		t.place(list, parent, i+k, d)
+	}
+	return nil
+}
+
+// Append adds dirs at the end of the block of the directive at index, or
+// at the top level if index is empty, giving the directive a block if it
+// has none.
+func (t *CST) Append(index []int, dirs ...*CSTDirective) error {
+	n := len(t.Directives)
+	if len(index) > 0 {
+		d := t.At(index...)
+		if d == nil {
+			return indexError(index)
+		}
+		n = 0
+		if d.Block != nil {
+			n = len(d.Block.Directives)
+		}
+	}
+	return t.Insert(append(slices.Clone(index), n), dirs...)
+}
+
+// Remove removes the directive at index, with its comments, and returns it.
+func (t *CST) Remove(index []int) (*CSTDirective, error) {
+	list, _, i, err := t.list(index, false)
+	if err != nil {
+		return nil, err
+	}
+	d := (*list)[i]
+	if i+1 < len(*list) {
+		// the next directive takes the place of d on its line
+		next := (*list)[i+1]
+		switch {
+		case !startsLine(d.Leading):
+			rest := dropLineBreak(next.Leading)
+			next.Leading = append(leadingSpace(d.Leading), rest[len(leadingSpace(rest)):]...)
+		case !hasNewline(next.Leading):
+			next.Leading = lineStart(indentOf(d.Leading))
+		}
+	}
+	*list = slices.Delete(*list, i, i+1)
+	return d, nil
+}
+
+// Replace replaces the directive at index with d, which takes over its
+// comments, indentation and line-end text.
+func (t *CST) Replace(index []int, d *CSTDirective) error {
+	list, parent, i, err := t.list(index, false)
+	if err != nil {
+		return err
+	}
+	old := (*list)[i]
+	reindent(d, indentOf(d.Leading), indentOf(old.Leading), blockStep(d), t.indentStep(parent))
+	d.Leading = old.Leading
+	d.Trailing = lineEnd(old.Trailing, d.Block != nil)
+	if d.Block == nil && !hasSemicolon(d.Trailing) && i+1 < len(*list) && !hasNewline((*list)[i+1].Leading) {
+		// the next directive follows on the same line
+		d.Trailing = append([]Trivia{{TriviaSemicolon, ";"}}, d.Trailing...)
+	}
+	if i+1 < len(*list) {
+		separate(d, (*list)[i+1])
+	}
+	(*list)[i] = d
+	return nil
+}
+
+// separate puts a space before next, which follows d, if nothing would
+// separate it from the brace ending the block of d.
+func separate(d, next *CSTDirective) {
+	if len(d.Trailing) == 0 && len(next.Leading) == 0 {
+		next.Leading = []Trivia{{TriviaSpace, " "}}
+	}
+}
+
+// lineEnd returns the trailing trivia ts of a directive for a directive
+// that ends in a block if block is set: without line continuations, which
+// may touch the last argument, or semicolons, which a block takes none of.
+func lineEnd(ts []Trivia, block bool) []Trivia {
+	ts = slices.DeleteFunc(slices.Clone(ts), func(tr Trivia) bool {
+		return tr.Kind == TriviaLineContinuation || (block && tr.Kind == TriviaSemicolon)
+	})
+	if len(ts) > 0 && ts[0].Kind == TriviaComment {
+		ts = append([]Trivia{{TriviaSpace, " "}}, ts...)
+	}
+	return ts
+}
+
+// Move moves the directive at from, with its comments, to before the
+// directive at to, as [ConfigurationUnit.Move] does.
+func (t *CST) Move(from, to []int) error {
+	if _, _, _, err := t.list(to, true); err != nil {
+		return err
+	}
+	to, err := moveTarget(from, to)
+	if err != nil {
+		return err
+	}
+	d, err := t.Remove(from)
+	if err != nil {
+		return err
+	}
+	return t.Insert(to, d)
+}
+
+// place inserts d at position i of list, the block of parent or the top
+// level if parent is nil, laying it out like its neighbours.
+func (t *CST) place(list *[]*CSTDirective, parent *CSTDirective, i int, d *CSTDirective) {
+	dirs := *list
+	oldIndent := indentOf(d.Leading)
+	comments := commentLines(d.Leading)
+	step := t.indentStep(parent)
+
+	inline, indent := false, ""
+	var head []Trivia // text after the brace of an empty block, kept on its line
+	switch {
+	case len(dirs) > 0:
+		// follow the layout of the next directive, or of the last one;
+		// the first directive of the document need not start a line
+		ref := min(i, len(dirs)-1)
+		indent = indentOf(dirs[ref].Leading)
+		inline = !hasNewline(dirs[ref].Leading) && (parent != nil || ref > 0)
+		if inline && i == len(dirs) && hasLineComment(dirs[ref].Trailing) {
+			// the comment ends the line, so start a new one with the
+			// indentation of its first directive
+			inline = false
+			j := ref
+			for j > 0 && !hasNewline(dirs[j].Leading) {
+				j--
+			}
+			indent = indentOf(dirs[j].Leading)
+			if parent != nil && !hasNewline(dirs[j].Leading) {
+				indent = indentOf(parent.Leading) + step
+			}
+		}
+	case parent != nil:
+		indent = indentOf(parent.Leading) + step
+		trailing := parent.Block.Trailing
+		k := len(trailing)
+		for k > 0 && trailing[k-1].Kind != TriviaNewline {
+			k--
+		}
+		if k == 0 {
+			head, parent.Block.Trailing = trailing, lineStart(indentOf(parent.Leading))
+		} else {
+			head, parent.Block.Trailing = trailing[:k-1], trailing[k-1:]
+		}
+		for len(head) > 0 && head[len(head)-1].Kind == TriviaSpace {
+			head = head[:len(head)-1]
+		}
+	}
+	reindent(d, oldIndent, indent, blockStep(d), step)
+
+	switch {
+	case inline:
+		d.Leading = []Trivia{{TriviaSpace, " "}}
+		d.Trailing = slices.DeleteFunc(d.Trailing, func(tr Trivia) bool { return tr.Kind == TriviaComment })
+		if i < len(dirs) {
+			if d.Block == nil && !hasSemicolon(d.Trailing) {
+				d.Trailing = append([]Trivia{{TriviaSemicolon, ";"}}, d.Trailing...)
+			}
+		} else if prev := dirs[i-1]; prev.Block == nil && !hasSemicolon(prev.Trailing) {
+			prev.Trailing = append([]Trivia{{TriviaSemicolon, ";"}}, prev.Trailing...)
+		}
+
+	case parent == nil && i == 0:
+		// the new first directive of the document
+		d.Leading = nil
+		for _, c := range comments {
+			d.Leading = append(d.Leading, c, Trivia{TriviaNewline, "\n"})
+		}
+		if len(dirs) == 0 {
+			// comments in an otherwise empty document stay first
+			if hasComment(t.Trailing) {
+				d.Leading = append(slices.Clone(t.Trailing), d.Leading...)
+				if t.Trailing[len(t.Trailing)-1].Kind != TriviaNewline {
+					d.Leading = slices.Insert(d.Leading, len(t.Trailing), Trivia{TriviaNewline, "\n"})
+				}
+			}
+			t.Trailing = lineStart("")
+		} else if !startsLine(dirs[0].Leading) {
+			dirs[0].Leading = append(lineStart(""), dirs[0].Leading...)
+		}
+
+	default:
+		d.Leading = append(slices.Clone(head), lineStart(indent)...)
+		for _, c := range comments {
+			d.Leading = append(d.Leading, c)
+			d.Leading = append(d.Leading, lineStart(indent)...)
+		}
+	}
+	if i < len(dirs) {
+		separate(d, dirs[i])
+	}
+	*list = slices.Insert(dirs, i, d)
+}
+
+// indentStep returns the indentation a block adds to the lines of its
+// subdirectives: that of the block of parent, or else of the first block
+// in the document with a subdirective on a line of its own, or
+// defaultIndent.
+func (t *CST) indentStep(parent *CSTDirective) string {
+	if parent != nil {
+		if step := blockStep(parent); step != "" {
+			return step
+		}
+	}
+	for _, d := range t.Directives {
+		if step := blockStep(d); step != "" {
+			return step
+		}
+	}
+	return defaultIndent
+}
+
+// blockStep returns the indentation the block of d, or of the first of its
+// subdirectives to tell, adds to the lines of its subdirectives, or "" if
+// none starts a line indented further than its parent.
+func blockStep(d *CSTDirective) string {
+	if d.Block == nil {
+		return ""
+	}
+	base := indentOf(d.Leading)
+	for _, sub := range d.Block.Directives {
+		if indent := indentOf(sub.Leading); hasNewline(sub.Leading) && len(indent) > len(base) && strings.HasPrefix(indent, base) {
+			return indent[len(base):]
+		}
+		if step := blockStep(sub); step != "" {
+			return step
+		}
+	}
+	return ""
+}
+
+// hasNewline reports whether ts holds a line break.
+func hasNewline(ts []Trivia) bool {
+	for _, t := range ts {
+		if t.Kind == TriviaNewline {
+			return true
+		}
+	}
+	return false
+}
+
+// hasLineComment reports whether ts holds a comment that runs to the end of
+// the line.
+func hasLineComment(ts []Trivia) bool {
+	for _, t := range ts {
+		if t.Kind == TriviaComment && !strings.HasPrefix(t.Text, "/*") {
+			return true
+		}
+	}
+	return false
+}
+
+// hasSemicolon reports whether ts holds a semicolon.
+func hasSemicolon(ts []Trivia) bool {
+	for _, t := range ts {
+		if t.Kind == TriviaSemicolon {
+			return true
+		}
+	}
+	return false
+}
+
+// startsLine reports whether the leading trivia ts start with a line break,
+// after any whitespace.
+func startsLine(ts []Trivia) bool {
+	for _, t := range ts {
+		if t.Kind != TriviaSpace {
+			return t.Kind == TriviaNewline
+		}
+	}
+	return false
+}
+
+// leadingSpace returns the whitespace at the start of ts.
+func leadingSpace(ts []Trivia) []Trivia {
+	n := 0
+	for n < len(ts) && ts[n].Kind == TriviaSpace {
+		n++
+	}
+	return slices.Clone(ts[:n])
+}
+
+// dropLineBreak removes the whitespace and line break at the start of ts,
+// with the indentation that follows it.
+func dropLineBreak(ts []Trivia) []Trivia {
+	if !startsLine(ts) {
+		return ts
+	}
+	n := len(leadingSpace(ts)) + 1
+	for n < len(ts) && ts[n].Kind == TriviaSpace {
+		n++
+	}
+	return ts[n:]
+}
+
+// indentOf returns the indentation of the last line of the leading trivia
+// ts, that is, of the line the directive they precede starts on.
+func indentOf(ts []Trivia) string {
+	indent := ""
+	for _, t := range ts {
+		switch t.Kind {
+		case TriviaNewline:
+			indent = ""
+		case TriviaSpace:
+			indent += t.Text
+		default:
+			indent = ""
+		}
+	}
+	return indent
+}
+
+// commentLines returns the comments of the leading trivia ts.
+func commentLines(ts []Trivia) []Trivia {
+	var res []Trivia
+	for _, t := range ts {
+		if t.Kind == TriviaComment {
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+// reindent changes the indentation of the lines within d, its block and
+// subdirectives, from old to new, and each step of indentation that follows
+// from oldStep to newStep.
+func reindent(d *CSTDirective, old, new, oldStep, newStep string) {
+	if (old == new && oldStep == newStep) || d.Block == nil {
+		return
+	}
+	d.Block.Leading = reindentTrivia(d.Block.Leading, old, new, oldStep, newStep)
+	for _, sub := range d.Block.Directives {
+		sub.Leading = reindentTrivia(sub.Leading, old, new, oldStep, newStep)
+		reindent(sub, old, new, oldStep, newStep)
+	}
+	d.Block.Trailing = reindentTrivia(d.Block.Trailing, old, new, oldStep, newStep)
+}
+
+// reindentTrivia changes the indentation following each line break in ts
+// from old to new, and the steps of oldStep that follow to steps of
+// newStep. Blank lines are left empty.
+func reindentTrivia(ts []Trivia, old, new, oldStep, newStep string) []Trivia {
+	var res []Trivia
+	for i := 0; i < len(ts); i++ {
+		res = append(res, ts[i])
+		if ts[i].Kind != TriviaNewline {
+			continue
+		}
+		switch {
+		case i+1 < len(ts) && ts[i+1].Kind == TriviaSpace:
+			i++
+			rest, steps := strings.TrimPrefix(ts[i].Text, old), 0
+			for oldStep != "" && strings.HasPrefix(rest, oldStep) {
+				rest, steps = rest[len(oldStep):], steps+1
+			}
+			res = append(res, Trivia{TriviaSpace, new + strings.Repeat(newStep, steps) + rest})
+		case new != "" && (i+1 == len(ts) || ts[i+1].Kind != TriviaNewline):
+			res = append(res, Trivia{TriviaSpace, new})
+		}
+	}
+	return res
+}
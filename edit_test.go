@@ -0,0 +1,427 @@
+package confetti
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestConfigurationUnit_Edit(t *testing.T) {
+	cfg, err := Parse("a 1\nb {\n    c 2\n}\nd 3\n")
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	cfg.At(0).SetArguments("1", "x")
+	if got := cfg.At(0).Arguments; !reflect.DeepEqual(got, []string{"a", "1", "x"}) {
+		t.Errorf("SetArguments: %q", got)
+	}
+	if sp := cfg.At(0).ArgSpans; len(sp) != 3 || !sp[1].Start.IsValid() || sp[2].Start.IsValid() {
+		t.Errorf("SetArguments spans: %v", sp)
+	}
+
+	steps := []struct {
+		name string
+		do   func() error
+		want string
+	}{
+		{"insert", func() error {
+			return cfg.Insert([]int{1}, Directive{Arguments: []string{"n", "0"}})
+		}, "<a> <1> <x>\n<n> <0>\n<b> [\n    <c> <2>\n]\n<d> <3>\n"},
+		{"insert into block", func() error {
+			return cfg.Insert([]int{2, 1}, Directive{Arguments: []string{"e"}})
+		}, "<a> <1> <x>\n<n> <0>\n<b> [\n    <c> <2>\n    <e>\n]\n<d> <3>\n"},
+		{"append to new block", func() error {
+			cfg.At(3).Append(Directive{Arguments: []string{"f", "4"}})
+			return nil
+		}, "<a> <1> <x>\n<n> <0>\n<b> [\n    <c> <2>\n    <e>\n]\n<d> <3> [\n    <f> <4>\n]\n"},
+		{"replace", func() error {
+			return cfg.Replace([]int{0}, Directive{Arguments: []string{"z"}})
+		}, "<z>\n<n> <0>\n<b> [\n    <c> <2>\n    <e>\n]\n<d> <3> [\n    <f> <4>\n]\n"},
+		{"move forward", func() error {
+			return cfg.Move([]int{0}, []int{2, 1})
+		}, "<n> <0>\n<b> [\n    <c> <2>\n    <z>\n    <e>\n]\n<d> <3> [\n    <f> <4>\n]\n"},
+		{"move to the end", func() error {
+			return cfg.Move([]int{1, 0}, []int{3})
+		}, "<n> <0>\n<b> [\n    <z>\n    <e>\n]\n<d> <3> [\n    <f> <4>\n]\n<c> <2>\n"},
+		{"remove", func() error {
+			_, err := cfg.Remove([]int{2, 0})
+			return err
+		}, "<n> <0>\n<b> [\n    <z>\n    <e>\n]\n<d> <3>\n<c> <2>\n"},
+	}
+	for _, st := range steps {
+		if err := st.do(); err != nil {
+			t.Fatalf("%s: %v", st.name, err)
+		}
+		if got := cfg.String(); got != st.want {
+			t.Fatalf("%s:\n got: %q\nwant: %q", st.name, got, st.want)
+		}
+	}
+
+	for _, bad := range []func() error{
+		func() error { return cfg.Insert(nil) },
+		func() error { return cfg.Insert([]int{5}) },
+		func() error { return cfg.Replace([]int{4}, Directive{}) },
+		func() error { _, err := cfg.Remove([]int{0, 0}); return err },
+		func() error { return cfg.Move([]int{1}, []int{1, 0}) },
+		func() error { return cfg.Move([]int{1}, []int{9}) },
+	} {
+		if err := bad(); err == nil {
+			t.Errorf("invalid edit succeeded")
+		}
+	}
+	var d Directive
+	d.SetArguments("name", "1")
+	if !reflect.DeepEqual(d.Arguments, []string{"name", "1"}) || len(d.ArgSpans) != 2 {
+		t.Errorf("SetArguments on a zero Directive: %q, %v", d.Arguments, d.ArgSpans)
+	}
+
+	if cfg.At(9) != nil || cfg.At() != nil {
+		t.Errorf("At out of range returned a directive")
+	}
+}
+
+func TestCST_Edit(t *testing.T) {
+	src := `# header
+port 8080 # the port
+server web {
+    # listen on all interfaces
+    listen 0.0.0.0
+
+    root /srv
+}
+inline { a 1; b 2 }
+`
+	tests := []struct {
+		name string
+		edit func(*testing.T, *CST) error
+		want string
+	}{
+		{"set arguments", func(t *testing.T, c *CST) error {
+			return c.SetArguments([]int{0}, "9090")
+		}, "# header\nport 9090 # the port\nserver web {\n    # listen on all interfaces\n    listen 0.0.0.0\n\n    root /srv\n}\ninline { a 1; b 2 }\n"},
+		{"set quoted arguments", func(t *testing.T, c *CST) error {
+			return c.SetArguments([]int{1, 1}, "/srv", "my dir", "")
+		}, "# header\nport 8080 # the port\nserver web {\n    # listen on all interfaces\n    listen 0.0.0.0\n\n    root /srv \"my dir\" \"\"\n}\ninline { a 1; b 2 }\n"},
+		{"insert first", func(t *testing.T, c *CST) error {
+			return c.Insert([]int{0}, mustNew(t, c, Directive{Arguments: []string{"x", "1"}}))
+		}, "x 1\n# header\nport 8080 # the port\nserver web {\n    # listen on all interfaces\n    listen 0.0.0.0\n\n    root /srv\n}\ninline { a 1; b 2 }\n"},
+		{"insert in block", func(t *testing.T, c *CST) error {
+			return c.Insert([]int{1, 1}, mustNew(t, c, Directive{Arguments: []string{"gzip", "on"}}))
+		}, "# header\nport 8080 # the port\nserver web {\n    # listen on all interfaces\n    listen 0.0.0.0\n    gzip on\n\n    root /srv\n}\ninline { a 1; b 2 }\n"},
+		{"append block", func(t *testing.T, c *CST) error {
+			d := Directive{Arguments: []string{"server", "api"}, Subdirectives: []Directive{
+				{Arguments: []string{"listen", "8081"}},
+				{Arguments: []string{"tls"}, Subdirectives: []Directive{{Arguments: []string{"cert", "a b.pem"}}}},
+			}}
+			return c.Append(nil, mustNew(t, c, d))
+		}, "# header\nport 8080 # the port\nserver web {\n    # listen on all interfaces\n    listen 0.0.0.0\n\n    root /srv\n}\ninline { a 1; b 2 }\nserver api {\n    listen 8081\n    tls {\n        cert \"a b.pem\"\n    }\n}\n"},
+		{"append nested", func(t *testing.T, c *CST) error {
+			return c.Append([]int{1}, mustNew(t, c, Directive{Arguments: []string{"x", "{"}}))
+		}, "# header\nport 8080 # the port\nserver web {\n    # listen on all interfaces\n    listen 0.0.0.0\n\n    root /srv\n    x \"{\"\n}\ninline { a 1; b 2 }\n"},
+		{"append to directive without block", func(t *testing.T, c *CST) error {
+			return c.Append([]int{0}, mustNew(t, c, Directive{Arguments: []string{"x"}}))
+		}, "# header\nport 8080 {\n    x\n} # the port\nserver web {\n    # listen on all interfaces\n    listen 0.0.0.0\n\n    root /srv\n}\ninline { a 1; b 2 }\n"},
+		{"append inline", func(t *testing.T, c *CST) error {
+			return c.Append([]int{2}, mustNew(t, c, Directive{Arguments: []string{"c", "3"}}))
+		}, "# header\nport 8080 # the port\nserver web {\n    # listen on all interfaces\n    listen 0.0.0.0\n\n    root /srv\n}\ninline { a 1; b 2; c 3 }\n"},
+		{"insert inline", func(t *testing.T, c *CST) error {
+			return c.Insert([]int{2, 0}, mustNew(t, c, Directive{Arguments: []string{"c", "3"}}))
+		}, "# header\nport 8080 # the port\nserver web {\n    # listen on all interfaces\n    listen 0.0.0.0\n\n    root /srv\n}\ninline { c 3; a 1; b 2 }\n"},
+		{"remove first", func(t *testing.T, c *CST) error {
+			_, err := c.Remove([]int{0})
+			return err
+		}, "server web {\n    # listen on all interfaces\n    listen 0.0.0.0\n\n    root /srv\n}\ninline { a 1; b 2 }\n"},
+		{"remove with comment", func(t *testing.T, c *CST) error {
+			_, err := c.Remove([]int{1, 0})
+			return err
+		}, "# header\nport 8080 # the port\nserver web {\n\n    root /srv\n}\ninline { a 1; b 2 }\n"},
+		{"remove inline", func(t *testing.T, c *CST) error {
+			_, err := c.Remove([]int{2, 0})
+			return err
+		}, "# header\nport 8080 # the port\nserver web {\n    # listen on all interfaces\n    listen 0.0.0.0\n\n    root /srv\n}\ninline { b 2 }\n"},
+		{"replace", func(t *testing.T, c *CST) error {
+			return c.Replace([]int{0}, mustNew(t, c, Directive{Arguments: []string{"port", "1"}}))
+		}, "# header\nport 1 # the port\nserver web {\n    # listen on all interfaces\n    listen 0.0.0.0\n\n    root /srv\n}\ninline { a 1; b 2 }\n"},
+		{"move with comment", func(t *testing.T, c *CST) error {
+			return c.Move([]int{1, 0}, []int{3})
+		}, "# header\nport 8080 # the port\nserver web {\n\n    root /srv\n}\ninline { a 1; b 2 }\n# listen on all interfaces\nlisten 0.0.0.0\n"},
+		{"move block into block", func(t *testing.T, c *CST) error {
+			return c.Move([]int{2}, []int{1, 2})
+		}, "# header\nport 8080 # the port\nserver web {\n    # listen on all interfaces\n    listen 0.0.0.0\n\n    root /srv\n    inline { a 1; b 2 }\n}\n"},
+	}
+	for _, tt := range tests {
+		c, err := ParseCST(src, Options{})
+		if err != nil {
+			t.Fatalf("ParseCST error: %v", err)
+		}
+		if err := tt.edit(t, c); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		got := c.String()
+		if got != tt.want {
+			t.Errorf("%s:\n got: %q\nwant: %q", tt.name, got, tt.want)
+			continue
+		}
+		// the edited text parses to the edited tree
+		unit, err := Parse(got)
+		if err != nil {
+			t.Errorf("%s: result does not parse: %v", tt.name, err)
+			continue
+		}
+		if a, b := unit.String(), c.Unit().String(); a != b {
+			t.Errorf("%s: text and tree differ:\ntext: %q\ntree: %q", tt.name, a, b)
+		}
+	}
+}
+
+func TestCST_EditEmpty(t *testing.T) {
+	for _, src := range []string{"", "# only a comment", "# only a comment\n\n"} {
+		c, err := ParseCST(src, Options{})
+		if err != nil {
+			t.Fatalf("ParseCST error: %v", err)
+		}
+		if err := c.Append(nil, mustNew(t, c, Directive{Arguments: []string{"a", "1"}})); err != nil {
+			t.Fatalf("Append error: %v", err)
+		}
+		if err := c.Append(nil, mustNew(t, c, Directive{Arguments: []string{"b", "2"}})); err != nil {
+			t.Fatalf("Append error: %v", err)
+		}
+		want := src + "a 1\nb 2\n"
+		if src != "" && !strings.HasSuffix(src, "\n") {
+			want = src + "\n" + "a 1\nb 2\n"
+		}
+		if got := c.String(); got != want {
+			t.Errorf("%q: got %q, want %q", src, got, want)
+		}
+	}
+}
+
+func TestCST_NewDirectiveExtensions(t *testing.T) {
+	c, err := ParseCST("a 1\n", Options{CStyleComments: true})
+	if err != nil {
+		t.Fatalf("ParseCST error: %v", err)
+	}
+	if err := c.SetArguments([]int{0}, "http://x"); err != nil {
+		t.Fatalf("SetArguments error: %v", err)
+	}
+	if got, want := c.String(), "a \"http://x\"\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if err := c.SetArguments([]int{0}, "bad\x00"); err == nil {
+		t.Errorf("SetArguments with a forbidden character succeeded")
+	}
+
+	// directives without a name are rejected rather than panicking
+	if _, err := c.NewDirective(Directive{}); err == nil {
+		t.Errorf("NewDirective without arguments succeeded")
+	}
+	if err := c.Insert([]int{0}, &CSTDirective{}); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	if err := c.SetArguments([]int{0}, "x"); err == nil {
+		t.Errorf("SetArguments on a directive without a name succeeded")
+	}
+}
+
+func TestCST_EditLayout(t *testing.T) {
+	tests := []struct {
+		src  string
+		edit func(*testing.T, *CST) error
+		want string
+	}{
+		{"host a; port 80 # web port\n", func(t *testing.T, c *CST) error {
+			return c.Append(nil, mustNew(t, c, Directive{Arguments: []string{"tls", "on"}}))
+		}, "host a; port 80 # web port\ntls on\n"},
+		{"b { x 1; y 2 # two\n}\n", func(t *testing.T, c *CST) error {
+			return c.Append([]int{0}, mustNew(t, c, Directive{Arguments: []string{"z", "3"}}))
+		}, "b { x 1; y 2 # two\n    z 3\n}\n"},
+		{"b\"x y\"\n", func(t *testing.T, c *CST) error {
+			return c.SetArguments([]int{0}, "z", "q r")
+		}, "b z \"q r\"\n"},
+		{"a\"x\"\"y\"\n", func(t *testing.T, c *CST) error {
+			return c.SetArguments([]int{0}, "z", "y")
+		}, "a z \"y\"\n"},
+		{"\"x y\"\\\n;\n", func(t *testing.T, c *CST) error {
+			return c.Replace([]int{0}, mustNew(t, c, Directive{Arguments: []string{"z"}}))
+		}, "z;\n"},
+		{"a 1; b 2\n", func(t *testing.T, c *CST) error {
+			return c.Replace([]int{0}, mustNew(t, c, Directive{Arguments: []string{"a"}, Subdirectives: []Directive{{Arguments: []string{"x"}}}}))
+		}, "a {\n    x\n} b 2\n"},
+		{"a { # c\n}\n", func(t *testing.T, c *CST) error {
+			return c.Append([]int{0}, mustNew(t, c, Directive{Arguments: []string{"x"}}))
+		}, "a { # c\n    x\n}\n"},
+		{"a { }\n", func(t *testing.T, c *CST) error {
+			return c.Append([]int{0}, mustNew(t, c, Directive{Arguments: []string{"x"}}))
+		}, "a {\n    x\n}\n"},
+		{"p {\n  y\n}\n", func(t *testing.T, c *CST) error {
+			d := Directive{Arguments: []string{"q"}, Subdirectives: []Directive{{Arguments: []string{"z"}}}}
+			return c.Append([]int{0}, mustNew(t, c, d))
+		}, "p {\n  y\n  q {\n    z\n  }\n}\n"},
+		{"p {\n\tq {}\n}\n", func(t *testing.T, c *CST) error {
+			return c.Append([]int{0, 0}, mustNew(t, c, Directive{Arguments: []string{"z"}}))
+		}, "p {\n\tq {\n\t\tz\n\t}\n}\n"},
+		{"p {\n  y\n}\nr 1\n", func(t *testing.T, c *CST) error {
+			d := Directive{Arguments: []string{"r"}, Subdirectives: []Directive{{Arguments: []string{"s"}, Subdirectives: []Directive{{Arguments: []string{"z"}}}}}}
+			return c.Replace([]int{1}, mustNew(t, c, d))
+		}, "p {\n  y\n}\nr {\n  s {\n    z\n  }\n}\n"},
+		{"a;b\n", func(t *testing.T, c *CST) error {
+			return c.Append([]int{0}, mustNew(t, c, Directive{Arguments: []string{"x"}}))
+		}, "a {\n    x\n} b\n"},
+		{"x { a;b }\ny {}\n", func(t *testing.T, c *CST) error {
+			return c.Move([]int{1}, []int{0, 1})
+		}, "x { a; y {} b }\n"},
+	}
+	for _, tt := range tests {
+		c, err := ParseCST(tt.src, Options{})
+		if err != nil {
+			t.Fatalf("%q: ParseCST error: %v", tt.src, err)
+		}
+		if err := tt.edit(t, c); err != nil {
+			t.Errorf("%q: %v", tt.src, err)
+			continue
+		}
+		if got := c.String(); got != tt.want {
+			t.Errorf("%q:\n got: %q\nwant: %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+// TestCST_EditRandom applies random edits to a CST and to the tree parsed
+// from the same source, and checks that the edited text parses to the
+// edited tree.
+func TestCST_EditRandom(t *testing.T) {
+	sources := []string{
+		"host a; port 80 # web port\n",
+		"b\"x y\"\n",
+		"\"x y\"\\\n;\n",
+		"a {b 1;c 2}\nd\n",
+		"a { b 1 # one\n}\n",
+		"  x 1\n  y { z; w \"q\"\"r\" }\n",
+		"# header\nport 8080 # the port\nserver web {\n    # listen\n    listen 0.0.0.0\n\n    root /srv\n}\n",
+		"a 1; /* one */ b 2 // two\nc { d /* three */ }\n",
+		"a { # one\n}\nb;c\nd { /* two */ }\n",
+		"p {\n  q {\n    r\n  }\n}\n",
+		"",
+	}
+	opts := Options{CStyleComments: true}
+	pool := []string{"x", "y z", "", "{", "#c", "q\"", "1"}
+	rng := rand.New(rand.NewSource(1))
+	var newDir func(depth int) Directive
+	newDir = func(depth int) Directive {
+		var d Directive
+		for n := 1 + rng.Intn(3); n > 0; n-- {
+			d.Arguments = append(d.Arguments, pool[rng.Intn(len(pool))])
+		}
+		if depth < 2 && rng.Intn(4) == 0 {
+			for n := 1 + rng.Intn(2); n > 0; n-- {
+				d.Subdirectives = append(d.Subdirectives, newDir(depth+1))
+			}
+		}
+		return d
+	}
+
+	for iter := 0; iter < 2000; iter++ {
+		src := sources[iter%len(sources)]
+		c, err := ParseCST(src, opts)
+		if err != nil {
+			t.Fatalf("%q: ParseCST error: %v", src, err)
+		}
+		ast, err := ParseWithOptions(src, opts)
+		if err != nil {
+			t.Fatalf("%q: Parse error: %v", src, err)
+		}
+		var log []string
+		for step := 0; step < 8; step++ {
+			paths := indexPaths(ast.Directives, nil)
+			at := func() []int {
+				if len(paths) == 0 {
+					return []int{0}
+				}
+				return paths[rng.Intn(len(paths))]
+			}
+			// a position to insert at: before a directive, at the end of
+			// its list or at the start of its block
+			to := func() []int {
+				p := slices.Clone(at())
+				switch rng.Intn(3) {
+				case 1:
+					p[len(p)-1]++
+				case 2:
+					if len(paths) > 0 {
+						p = append(p, 0)
+					}
+				}
+				return p
+			}
+
+			var errAST, errCST error
+			switch op := rng.Intn(5); {
+			case op == 0 && len(paths) > 0:
+				p := at()
+				var args []string
+				for n := rng.Intn(3); n > 0; n-- {
+					args = append(args, pool[rng.Intn(len(pool))])
+				}
+				log = append(log, fmt.Sprintf("SetArguments(%v, %q)", p, args))
+				ast.At(p...).SetArguments(args...)
+				errCST = c.SetArguments(p, args...)
+			case op == 1:
+				p, d := to(), newDir(0)
+				log = append(log, fmt.Sprintf("Insert(%v, %v)", p, d.Arguments))
+				errAST = ast.Insert(p, d)
+				errCST = c.Insert(p, mustNew(t, c, d))
+			case op == 2 && len(paths) > 0:
+				p := at()
+				log = append(log, fmt.Sprintf("Remove(%v)", p))
+				_, errAST = ast.Remove(p)
+				_, errCST = c.Remove(p)
+			case op == 3 && len(paths) > 0:
+				p, d := at(), newDir(0)
+				log = append(log, fmt.Sprintf("Replace(%v, %v)", p, d.Arguments))
+				errAST = ast.Replace(p, d)
+				errCST = c.Replace(p, mustNew(t, c, d))
+			case op == 4 && len(paths) > 0:
+				from, to := at(), to()
+				log = append(log, fmt.Sprintf("Move(%v, %v)", from, to))
+				errAST = ast.Move(from, to)
+				errCST = c.Move(from, to)
+			default:
+				continue
+			}
+			if (errAST == nil) != (errCST == nil) {
+				t.Fatalf("%q: %s: errors differ: %v, %v", src, strings.Join(log, "; "), errAST, errCST)
+			}
+			got, err := ParseWithOptions(c.String(), opts)
+			if err != nil {
+				t.Fatalf("%q: %s: result %q does not parse: %v", src, strings.Join(log, "; "), c.String(), err)
+			}
+			if a, b := got.String(), ast.String(); a != b {
+				t.Fatalf("%q: %s: result %q:\n got: %q\nwant: %q", src, strings.Join(log, "; "), c.String(), a, b)
+			}
+		}
+	}
+}
+
+// indexPaths returns the indexes of dirs and of their subdirectives.
+func indexPaths(dirs []Directive, prefix []int) [][]int {
+	var res [][]int
+	for i, d := range dirs {
+		p := append(slices.Clone(prefix), i)
+		res = append(res, p)
+		res = append(res, indexPaths(d.Subdirectives, p)...)
+	}
+	return res
+}
+
+func mustNew(t *testing.T, c *CST, d Directive) *CSTDirective {
+	t.Helper()
+	n, err := c.NewDirective(d)
+	if err != nil {
+		t.Fatalf("NewDirective error: %v", err)
+	}
+	return n
+}
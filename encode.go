@@ -0,0 +1,469 @@
+package confetti
+
+import (
+	"bytes"
+	"encoding"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Marshal returns the Confetti encoding of v.
+//
+// v must be a struct, a non-nil pointer to a struct, or a *ConfigurationUnit.
+// Struct fields follow the same "conf" tag rules as Decode, so that
+// Unmarshal(Marshal(x)) reproduces x. See Encoder.Encode for details.
+func Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// defaultIndent is the indentation written for each nesting level unless
+// configured otherwise.
+const defaultIndent = "    "
+
+// Encoder writes Confetti documents to an output stream.
+type Encoder struct {
+	w      io.Writer
+	indent string
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, indent: defaultIndent}
+}
+
+// SetIndent sets the string written once per nesting level in front of
+// subdirectives. The default is four spaces.
+func (e *Encoder) SetIndent(indent string) {
+	e.indent = indent
+}
+
+// Encode writes the Confetti encoding of v to the stream.
+//
+// Each field becomes one directive named after the field: scalars are
+// written as a single argument, scalar slices as one argument per element,
+// structs and pointers to structs as block directives, and each element of
+// a []Struct as its own block directive. The ",arg" field of a struct is
+// written as the block's inline arguments. time.Duration values are written
+// with their String method and types implementing encoding.TextMarshaler
+// with MarshalText. Pointers are written as the value they point to. A map
+// with struct values is written as one block directive per entry with the
+// key as first inline argument; any other map as a block with one
+// subdirective per entry, named after the key. Nil pointers and empty
+// slices and maps are omitted.
+//
+// Arguments are quoted only when they would otherwise not be read back as a
+// single argument. The output uses core syntax only: it is not guaranteed to
+// round-trip when parsed with Annex extensions enabled.
+func (e *Encoder) Encode(v any) error {
+	dirs, err := marshalDirectives(v)
+	if err != nil {
+		return err
+	}
+	var sb strings.Builder
+	if err := writeDirectives(&sb, dirs, 0, e.indent); err != nil {
+		return err
+	}
+	_, err = io.WriteString(e.w, sb.String())
+	return err
+}
+
+// marshalDirectives converts v into the directives that Encode writes.
+func marshalDirectives(v any) ([]Directive, error) {
+	switch u := v.(type) {
+	case *ConfigurationUnit:
+		if u == nil {
+			return nil, fmt.Errorf("confetti: Marshal called with nil *ConfigurationUnit")
+		}
+		return u.Directives, nil
+	case ConfigurationUnit:
+		return u.Directives, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("confetti: Marshal called with nil %T", v)
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("confetti: Marshal requires a struct or pointer to a struct, got %T", v)
+	}
+	dirs, err := encodeStruct(rv)
+	if err != nil {
+		return nil, fmt.Errorf("confetti: %w", err)
+	}
+	return dirs, nil
+}
+
+// encodeStruct returns the directives for the named fields of struct value rv.
+func encodeStruct(rv reflect.Value) ([]Directive, error) {
+	meta := fieldMap(rv.Type())
+
+	var dirs []Directive
+	for _, fi := range meta.fields {
+		fieldDirs, err := encodeField(fi.name, rv.Field(fi.index))
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", fi.name, err)
+		}
+		dirs = append(dirs, fieldDirs...)
+	}
+	return dirs, nil
+}
+
+// encodeField returns the directives named name that encode field fv.
+func encodeField(name string, fv reflect.Value) ([]Directive, error) {
+	if isTextScalar(fv.Type()) {
+		s, err := formatScalar(fv)
+		if err != nil {
+			return nil, err
+		}
+		return []Directive{{Arguments: []string{name, s}}}, nil
+	}
+
+	switch fv.Kind() {
+	case reflect.Slice:
+		elemType := fv.Type().Elem()
+		// []Struct or []*Struct — one block directive per element
+		if isStructElem(elemType) {
+			var dirs []Directive
+			for i := 0; i < fv.Len(); i++ {
+				elem := fv.Index(i)
+				if elem.Kind() == reflect.Pointer {
+					if elem.IsNil() {
+						continue
+					}
+					elem = elem.Elem()
+				}
+				dir, err := encodeBlock(name, elem)
+				if err != nil {
+					return nil, fmt.Errorf("element %d: %w", i, err)
+				}
+				dirs = append(dirs, dir)
+			}
+			return dirs, nil
+		}
+		// slice of scalars — all elements as arguments
+		if fv.Len() == 0 {
+			return nil, nil
+		}
+		args, err := formatScalarSlice(fv)
+		if err != nil {
+			return nil, err
+		}
+		return []Directive{{Arguments: append([]string{name}, args...)}}, nil
+
+	case reflect.Map:
+		return encodeMap(name, fv)
+
+	case reflect.Struct:
+		dir, err := encodeBlock(name, fv)
+		if err != nil {
+			return nil, err
+		}
+		return []Directive{dir}, nil
+
+	case reflect.Pointer:
+		if fv.IsNil() {
+			return nil, nil
+		}
+		return encodeField(name, fv.Elem())
+
+	default:
+		s, err := formatScalar(fv)
+		if err != nil {
+			return nil, err
+		}
+		return []Directive{{Arguments: []string{name, s}}}, nil
+	}
+}
+
+// encodeMap returns the directives named name that encode map fv, the
+// reverse of decodeMap. Entries are written in order of their keys.
+func encodeMap(name string, fv reflect.Value) ([]Directive, error) {
+	if fv.Len() == 0 {
+		return nil, nil
+	}
+	keys := make([]string, 0, fv.Len())
+	values := make(map[string]reflect.Value, fv.Len())
+	iter := fv.MapRange()
+	for iter.Next() {
+		k, err := formatScalar(iter.Key())
+		if err != nil {
+			return nil, fmt.Errorf("map key: %w", err)
+		}
+		keys = append(keys, k)
+		values[k] = iter.Value()
+	}
+	sort.Strings(keys)
+
+	// struct values — one block directive per entry, keyed by its first inline argument
+	if isStructElem(fv.Type().Elem()) {
+		var dirs []Directive
+		for _, k := range keys {
+			elem := values[k]
+			if elem.Kind() == reflect.Pointer {
+				if elem.IsNil() {
+					continue
+				}
+				elem = elem.Elem()
+			}
+			dir, err := encodeBlock(name, elem)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", k, err)
+			}
+			if len(dir.Arguments) < 2 || dir.Arguments[1] != k {
+				dir.Arguments = append([]string{name, k}, dir.Arguments[1:]...)
+			}
+			dirs = append(dirs, dir)
+		}
+		return dirs, nil
+	}
+
+	// other values — one subdirective per entry, named after its key
+	subdirs := make([]Directive, 0, len(keys))
+	for _, k := range keys {
+		elem := values[k]
+		var args []string
+		var err error
+		if elem.Kind() == reflect.Slice && !isTextScalar(elem.Type()) {
+			args, err = formatScalarSlice(elem)
+		} else {
+			var s string
+			s, err = formatScalar(elem)
+			args = []string{s}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k, err)
+		}
+		subdirs = append(subdirs, Directive{Arguments: append([]string{k}, args...)})
+	}
+	return []Directive{{Arguments: []string{name}, Subdirectives: subdirs}}, nil
+}
+
+// encodeBlock returns a block directive named name for struct value sv,
+// taking its inline arguments from the ",arg" field (if any).
+func encodeBlock(name string, sv reflect.Value) (Directive, error) {
+	meta := fieldMap(sv.Type())
+
+	args := []string{name}
+	if meta.argFieldIdx >= 0 {
+		fv := sv.Field(meta.argFieldIdx)
+		switch fv.Kind() {
+		case reflect.String:
+			if fv.String() != "" {
+				args = append(args, fv.String())
+			}
+		case reflect.Slice:
+			inline, err := formatScalarSlice(fv)
+			if err != nil {
+				return Directive{}, fmt.Errorf(",arg field: %w", err)
+			}
+			args = append(args, inline...)
+		default:
+			return Directive{}, fmt.Errorf("unsupported ,arg field type %s", fv.Kind())
+		}
+	}
+
+	subdirs, err := encodeStruct(sv)
+	if err != nil {
+		return Directive{}, err
+	}
+	if subdirs == nil {
+		subdirs = []Directive{} // non-nil marks a block, even an empty one
+	}
+	return Directive{Arguments: args, Subdirectives: subdirs}, nil
+}
+
+// formatScalarSlice formats each element of slice value fv with formatScalar.
+func formatScalarSlice(fv reflect.Value) ([]string, error) {
+	args := make([]string, fv.Len())
+	for i := range args {
+		s, err := formatScalar(fv.Index(i))
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		args[i] = s
+	}
+	return args, nil
+}
+
+// formatScalar converts rv to the string that setScalar parses back into it.
+// Types implementing encoding.TextMarshaler format themselves.
+func formatScalar(rv reflect.Value) (string, error) {
+	if rv.Type() == durationType {
+		return time.Duration(rv.Int()).String(), nil
+	}
+	if rv.Type() == urlType {
+		u := rv.Interface().(url.URL)
+		return u.String(), nil
+	}
+	if tm, ok := asTextMarshaler(rv); ok {
+		text, err := tm.MarshalText()
+		if err != nil {
+			return "", err
+		}
+		return string(text), nil
+	}
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'g', -1, rv.Type().Bits()), nil
+	}
+	return "", fmt.Errorf("unsupported type %s", rv.Kind())
+}
+
+// asTextMarshaler returns the encoding.TextMarshaler implemented by rv or
+// its address, if any.
+func asTextMarshaler(rv reflect.Value) (encoding.TextMarshaler, bool) {
+	if tm, ok := rv.Interface().(encoding.TextMarshaler); ok {
+		return tm, true
+	}
+	if rv.CanAddr() {
+		tm, ok := rv.Addr().Interface().(encoding.TextMarshaler)
+		return tm, ok
+	}
+	return nil, false
+}
+
+// writeDirectives writes directives in Confetti syntax, one per line,
+// indenting each nesting level with indent. A directive is written as a
+// block when it has one (see Directive.HasBlock) or when its Subdirectives
+// slice is non-nil.
+func writeDirectives(sb *strings.Builder, directives []Directive, depth int, indent string) error {
+	for _, dir := range directives {
+		if len(dir.Arguments) == 0 {
+			return fmt.Errorf("confetti: directive must have at least one argument")
+		}
+
+		for i := 0; i < depth; i++ {
+			sb.WriteString(indent)
+		}
+		for i, arg := range dir.Arguments {
+			quoted, err := quoteArgument(arg)
+			if err != nil {
+				return fmt.Errorf("confetti: argument %q: %w", arg, err)
+			}
+			if sb.Len() == 0 {
+				quoted = quoteBOM(quoted)
+			}
+			if i > 0 {
+				sb.WriteString(" ")
+			}
+			sb.WriteString(quoted)
+		}
+
+		if dir.Subdirectives != nil || dir.HasBlock() {
+			if len(dir.Subdirectives) == 0 {
+				sb.WriteString(" {}")
+			} else {
+				sb.WriteString(" {\n")
+				if err := writeDirectives(sb, dir.Subdirectives, depth+1, indent); err != nil {
+					return err
+				}
+				for i := 0; i < depth; i++ {
+					sb.WriteString(indent)
+				}
+				sb.WriteString("}")
+			}
+		}
+
+		sb.WriteString("\n")
+	}
+	return nil
+}
+
+// quoteArgument returns s in a form the lexer reads back as a single argument
+// with value s. Arguments made only of IsArgumentChar characters are returned
+// unchanged; anything else is quoted, using a triple-quoted string when s
+// contains line terminators.
+func quoteArgument(s string) (string, error) {
+	return quoteArgumentWith(s, Options{})
+}
+
+// quoteBOM returns text, the unquoted or quoted form of an argument written
+// at the very start of the output, quoted if it begins with U+FEFF, which
+// the parser would otherwise drop as a byte order mark.
+func quoteBOM(text string) string {
+	if strings.HasPrefix(text, "\uFEFF") {
+		return `"` + text + `"`
+	}
+	return text
+}
+
+// quoteArgumentWith is like quoteArgument, but also quotes arguments that
+// the extensions enabled in opts would split: ones containing a C-style
+// comment opener, an opening parenthesis or a punctuator argument.
+func quoteArgumentWith(s string, opts Options) (string, error) {
+	if !utf8.ValidString(s) {
+		return "", fmt.Errorf("malformed UTF-8")
+	}
+	if s == "" {
+		return `""`, nil
+	}
+
+	plain, multiline := true, false
+	for _, r := range s {
+		switch {
+		case IsLineTerminator(r):
+			plain, multiline = false, true
+		case IsForbidden(r):
+			return "", fmt.Errorf("forbidden character %U", r)
+		case r == '\\' || !IsArgumentChar(r):
+			plain = false
+		}
+	}
+	if plain && !splitByExtensions(s, opts) {
+		return s, nil
+	}
+
+	delim := `"`
+	if multiline {
+		delim = `"""`
+	}
+	var sb strings.Builder
+	sb.WriteString(delim)
+	for _, r := range s {
+		if r == '\\' || r == '"' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	sb.WriteString(delim)
+	return sb.String(), nil
+}
+
+// splitByExtensions reports whether the lexer, with the extensions in opts,
+// would not read the unquoted s as a single simple argument.
+func splitByExtensions(s string, opts Options) bool {
+	if opts.CStyleComments && (strings.Contains(s, "//") || strings.Contains(s, "/*")) {
+		return true
+	}
+	if opts.ExpressionArguments && strings.Contains(s, "(") {
+		return true
+	}
+	for _, p := range opts.PunctuatorArguments {
+		if p != "" && strings.Contains(s, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,303 @@
+package confetti
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// marshalOK marshals v; fails the test on any error.
+func marshalOK(t *testing.T, v any) string {
+	t.Helper()
+	out, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	return string(out)
+}
+
+func TestMarshal_Scalars(t *testing.T) {
+	type Config struct {
+		Host    string        `conf:"host"`
+		Port    int           `conf:"port"`
+		Debug   bool          `conf:"debug"`
+		Ratio   float64       `conf:"ratio"`
+		Timeout time.Duration `conf:"timeout"`
+		Skipped string        `conf:"-"`
+	}
+	got := marshalOK(t, Config{Host: "example.com", Port: 8080, Debug: true, Ratio: 1.5, Timeout: 90 * time.Second, Skipped: "x"})
+	want := "host example.com\nport 8080\ndebug true\nratio 1.5\ntimeout 1m30s\n"
+	if got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMarshal_Blocks(t *testing.T) {
+	type Server struct {
+		Name    string `conf:",arg"`
+		Timeout int    `conf:"timeout"`
+	}
+	type TLS struct {
+		Cert string `conf:"cert"`
+	}
+	type Config struct {
+		Tags    []string  `conf:"tags"`
+		TLS     *TLS      `conf:"tls"`
+		Servers []*Server `conf:"server"`
+	}
+	cfg := Config{
+		Tags:    []string{"a", "b"},
+		TLS:     &TLS{Cert: "/etc/cert.pem"},
+		Servers: []*Server{{Name: "web", Timeout: 30}, nil, {Name: "api", Timeout: 60}},
+	}
+	got := marshalOK(t, &cfg)
+	want := `tags a b
+tls {
+    cert /etc/cert.pem
+}
+server web {
+    timeout 30
+}
+server api {
+    timeout 60
+}
+`
+	if got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMarshal_OmitsNilAndEmpty(t *testing.T) {
+	type TLS struct{}
+	type Config struct {
+		Tags  []string `conf:"tags"`
+		TLS   *TLS     `conf:"tls"`
+		Empty TLS      `conf:"empty"`
+	}
+	if got, want := marshalOK(t, Config{}), "empty {}\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestMarshal_RoundTrip(t *testing.T) {
+	type Location struct {
+		Path    []string `conf:",arg"`
+		Root    string   `conf:"root"`
+		Headers []string `conf:"headers"`
+	}
+	type Server struct {
+		Name      string        `conf:",arg"`
+		Timeout   time.Duration `conf:"timeout"`
+		Locations []Location    `conf:"location"`
+	}
+	type Config struct {
+		Message string   `conf:"message"`
+		Banner  string   `conf:"banner"`
+		Empty   string   `conf:"empty"`
+		Weights []uint8  `conf:"weights"`
+		Ports   []int    `conf:"ports"`
+		Servers []Server `conf:"server"`
+		Limit   float32  `conf:"limit"`
+	}
+	in := Config{
+		Message: `Hello, "World"! # not a comment; {}`,
+		Banner:  "line one\nline two \\ end",
+		Empty:   "",
+		Weights: []uint8{1, 255},
+		Ports:   []int{-1, 443},
+		Servers: []Server{{
+			Name:    "web 01",
+			Timeout: 1500 * time.Millisecond,
+			Locations: []Location{
+				{Path: []string{"/", "exact"}, Root: `C:\www`, Headers: []string{"a b", "", "c"}},
+			},
+		}},
+		Limit: 0.1,
+	}
+	text := marshalOK(t, in)
+
+	var out Config
+	if err := Unmarshal(text, &out); err != nil {
+		t.Fatalf("Unmarshal(Marshal(x)) error: %v\n%s", err, text)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("round trip mismatch:\n got: %+v\nwant: %+v\ntext:\n%s", out, in, text)
+	}
+}
+
+func TestMarshal_ConfigurationUnit(t *testing.T) {
+	src := "server web {\n    listen 80\n    empty {}\n}\nkey \"two words\"\n"
+	cfg := parseOK(t, src)
+	got := marshalOK(t, cfg)
+	want := src
+	if got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// a leading U+FEFF is not a byte order mark
+	bom := &ConfigurationUnit{Directives: []Directive{{Arguments: []string{"\ufeff", "\ufeff"}}}}
+	if got, want := marshalOK(t, bom), "\"\ufeff\" \ufeff\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestMarshal_Errors(t *testing.T) {
+	type BadPointer struct {
+		C *chan int `conf:"c"`
+	}
+	type BadKind struct {
+		C chan int `conf:"c"`
+	}
+	type BadArg struct {
+		Inner struct {
+			Arg int `conf:",arg"`
+		} `conf:"inner"`
+	}
+	tests := []struct {
+		name    string
+		v       any
+		wantMsg string
+	}{
+		{"non-struct", 42, "requires a struct"},
+		{"nil pointer", (*BadKind)(nil), "nil"},
+		{"nil unit", (*ConfigurationUnit)(nil), "nil *ConfigurationUnit"},
+		{"unsupported pointer", BadPointer{C: new(chan int)}, "unsupported type chan"},
+		{"unsupported kind", BadKind{}, "unsupported type chan"},
+		{"unsupported arg field", BadArg{}, "unsupported ,arg field type"},
+		{"forbidden character", struct{ S string }{"a\x01b"}, "forbidden character"},
+		{"malformed UTF-8", struct{ S string }{"\xff"}, "malformed UTF-8"},
+		{"empty directive", &ConfigurationUnit{Directives: []Directive{{}}}, "at least one argument"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Marshal(tt.v)
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("error %q does not contain %q", err.Error(), tt.wantMsg)
+			}
+		})
+	}
+
+	// nested fields add their names without repeating the prefix
+	var nested struct {
+		A struct {
+			B chan int `conf:"b"`
+		} `conf:"a"`
+	}
+	_, err := Marshal(nested)
+	if want := `confetti: field "a": field "b": unsupported type chan`; err == nil || err.Error() != want {
+		t.Errorf("error = %v, want %s", err, want)
+	}
+}
+
+func TestEncoder_SetIndent(t *testing.T) {
+	type Inner struct {
+		Key string `conf:"key"`
+	}
+	type Config struct {
+		Inner Inner `conf:"inner"`
+	}
+	var sb strings.Builder
+	enc := NewEncoder(&sb)
+	enc.SetIndent("\t")
+	if err := enc.Encode(Config{Inner: Inner{Key: "v"}}); err != nil {
+		t.Fatalf("Encode error: %v", err)
+	}
+	if got, want := sb.String(), "inner {\n\tkey v\n}\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestQuoteArgument(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{"user@example.com:8080/path?q=1", "user@example.com:8080/path?q=1"},
+		{"", `""`},
+		{"two words", `"two words"`},
+		{"semi;colon", `"semi;colon"`},
+		{"#hash", `"#hash"`},
+		{"{", `"{"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`back\slash`, `"back\\slash"`},
+		{"multi\nline", "\"\"\"multi\nline\"\"\""},
+		{"ends with quote\n\"", "\"\"\"ends with quote\n\\\"\"\"\""},
+	}
+	for _, tt := range tests {
+		got, err := quoteArgument(tt.in)
+		if err != nil {
+			t.Errorf("quoteArgument(%q) error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("quoteArgument(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		u, err := Parse("key " + got)
+		if err != nil {
+			t.Errorf("Parse(%q) error: %v", got, err)
+			continue
+		}
+		if args := u.Directives[0].Arguments; len(args) != 2 || args[1] != tt.in {
+			t.Errorf("Parse(%q) arguments = %q, want [key %q]", got, args, tt.in)
+		}
+	}
+}
+
+func TestMarshal_Maps(t *testing.T) {
+	type Server struct {
+		Name    string `conf:",arg"`
+		Timeout int    `conf:"timeout"`
+	}
+	type Plain struct {
+		Timeout int `conf:"timeout"`
+	}
+	type Config struct {
+		Env     map[string]string   `conf:"env"`
+		Lists   map[string][]int    `conf:"lists"`
+		Servers map[string]*Server  `conf:"server"`
+		Plain   map[string]Plain    `conf:"plain"`
+		Empty   map[string]string   `conf:"empty"`
+		Nil     map[string][]string `conf:"nil"`
+	}
+	in := Config{
+		Env:     map[string]string{"B": "two words", "A": "1"},
+		Lists:   map[string][]int{"ports": {80, 443}},
+		Servers: map[string]*Server{"web": {Name: "web", Timeout: 30}, "api": {Name: "api", Timeout: 60}},
+		Plain:   map[string]Plain{"x": {Timeout: 1}},
+		Empty:   map[string]string{},
+	}
+	got := marshalOK(t, in)
+	want := `env {
+    A 1
+    B "two words"
+}
+lists {
+    ports 80 443
+}
+server api {
+    timeout 60
+}
+server web {
+    timeout 30
+}
+plain x {
+    timeout 1
+}
+`
+	if got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	var out Config
+	if err := Unmarshal(got, &out); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	in.Empty = nil
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("round trip mismatch:\n got: %+v\nwant: %+v", out, in)
+	}
+}
@@ -1,8 +1,37 @@
 package confetti
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
 
-// ParseError describes a syntax error and its position in the input.
+// ErrUnknownDirective is wrapped by the *DecodeError reported for each
+// directive that matches no struct field when DecodeOptions.DisallowUnknown
+// is set.
+var ErrUnknownDirective = errors.New("unknown directive")
+
+// ErrMissingRequired is wrapped by the *DecodeError reported for a block
+// that lacks one or more directives whose field is tagged ",required".
+var ErrMissingRequired = errors.New("missing required directive")
+
+// ErrIncludeCycle is wrapped by the *ParseError reported by ParseFS for a
+// file that includes itself, directly or through other files.
+var ErrIncludeCycle = errors.New("include cycle")
+
+// Errors wrapped by the *ParseError reported when input exceeds one of the
+// Limits set in Options. Test for them with errors.Is.
+var (
+	ErrInputTooLarge     = errors.New("input too large")
+	ErrMaxDepth          = errors.New("blocks nested too deeply")
+	ErrTooManyArguments  = errors.New("too many arguments in directive")
+	ErrTooManyDirectives = errors.New("too many directives")
+	ErrArgumentTooLong   = errors.New("argument too long")
+)
+
+// ParseError describes an error in a document and its position: a syntax
+// error, or a failure to include a file or interpolate a variable.
 // Line and Column are 1-based. Retrieve it with errors.As:
 //
 //	var perr *confetti.ParseError
@@ -10,11 +39,128 @@ import "fmt"
 //		fmt.Println(perr.Line, perr.Column, perr.Msg)
 //	}
 type ParseError struct {
+	File   string // file containing the offending input, set by ParseFS
 	Line   int    // 1-based line of the offending input
 	Column int    // 1-based column of the offending input
 	Msg    string // description of the error, without position information
+
+	// Err is the underlying error: the limit exceeded, such as ErrMaxDepth,
+	// or the reason an include failed. It is nil for syntax errors.
+	Err error
 }
 
 func (e *ParseError) Error() string {
+	if e.File != "" {
+		return fmt.Sprintf("confetti: %s in %s at line %d, column %d", e.Msg, e.File, e.Line, e.Column)
+	}
 	return fmt.Sprintf("confetti: %s at line %d, column %d", e.Msg, e.Line, e.Column)
 }
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// limitError returns a *ParseError at pos for exceeding the limit err.
+func limitError(pos Position, err error, limit int) *ParseError {
+	return &ParseError{Line: pos.Line, Column: pos.Column, Msg: fmt.Sprintf("%v (limit %d)", err, limit), Err: err}
+}
+
+// ErrorList is a list of errors at positions in a document: the syntax
+// errors returned when parsing with Options.AllErrors, and the errors found
+// by Validate, ParseSchema and Interpolate. Each element is also reachable
+// through errors.As, which sees the first matching one.
+type ErrorList []*ParseError
+
+func (l ErrorList) Len() int      { return len(l) }
+func (l ErrorList) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+
+// Less orders errors by file, then by position, then by message.
+func (l ErrorList) Less(i, j int) bool {
+	a, b := l[i], l[j]
+	if a.File != b.File {
+		return a.File < b.File
+	}
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	if a.Column != b.Column {
+		return a.Column < b.Column
+	}
+	return a.Msg < b.Msg
+}
+
+// Sort sorts the list by position.
+func (l ErrorList) Sort() {
+	sort.Stable(l)
+}
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "confetti: no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// Err returns an error equivalent to the list, or nil if it is empty.
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
+
+// Unwrap returns the errors in the list.
+func (l ErrorList) Unwrap() []error {
+	errs := make([]error, len(l))
+	for i, e := range l {
+		errs[i] = e
+	}
+	return errs
+}
+
+// DecodeError describes a directive that could not be decoded into a Go
+// value. Line and Column locate the offending argument, or the directive
+// itself when the error is not about a single argument; they are 0 when the
+// document was not produced by the parser. Retrieve it with errors.As:
+//
+//	var derr *confetti.DecodeError
+//	if errors.As(err, &derr) {
+//		fmt.Println(derr.Line, derr.Column, strings.Join(derr.Path, " > "))
+//	}
+type DecodeError struct {
+	Path     []string // directive names from the top level down, e.g. [database credentials port]
+	Field    string   // Go field path, e.g. "Database.Credentials.Port" or "Servers[1].Timeout"
+	Argument string   // offending argument, empty if the error concerns the whole directive
+	File     string   // file the offending directive was read from, if known
+	Line     int      // 1-based line of the offending input
+	Column   int      // 1-based column of the offending input
+	Err      error    // underlying error
+}
+
+func (e *DecodeError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("confetti: ")
+	if len(e.Path) > 0 {
+		sb.WriteString(strings.Join(e.Path, " > "))
+		if e.Field != "" {
+			fmt.Fprintf(&sb, " (field %s)", e.Field)
+		}
+		sb.WriteString(": ")
+	}
+	fmt.Fprint(&sb, e.Err)
+	if e.File != "" {
+		fmt.Fprintf(&sb, " in %s", e.File)
+	}
+	if e.Line > 0 {
+		fmt.Fprintf(&sb, " at line %d, column %d", e.Line, e.Column)
+	}
+	return sb.String()
+}
+
+// Unwrap returns the underlying error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
@@ -3,7 +3,10 @@ package confetti_test
 import (
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"strings"
+	"testing/fstest"
 	"time"
 
 	"github.com/demen1n/confetti"
@@ -70,3 +73,194 @@ func ExampleParseError() {
 	}
 	// Output: 1:18 unterminated quoted string
 }
+
+func ExampleErrorList() {
+	src := "host example.com\nport \"8080\n}\ntimeout 30s\n"
+	config, err := confetti.ParseWithOptions(src, confetti.Options{AllErrors: true})
+
+	var list confetti.ErrorList
+	if errors.As(err, &list) {
+		for _, perr := range list {
+			fmt.Printf("%d:%d %s\n", perr.Line, perr.Column, perr.Msg)
+		}
+	}
+	fmt.Println(len(config.Directives), "directives parsed")
+	// Output:
+	// 2:11 unexpected newline in single-quoted string
+	// 3:1 unexpected '}' without matching '{'
+	// 3 directives parsed
+}
+
+func ExampleMarshal() {
+	type Server struct {
+		Name    string        `conf:",arg"`
+		Timeout time.Duration `conf:"timeout"`
+	}
+	type Config struct {
+		Message string   `conf:"message"`
+		Tags    []string `conf:"tags"`
+		Servers []Server `conf:"server"`
+	}
+
+	out, err := confetti.Marshal(Config{
+		Message: "Hello, World!",
+		Tags:    []string{"web", "api"},
+		Servers: []Server{{Name: "web", Timeout: 30 * time.Second}},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(string(out))
+	// Output:
+	// message "Hello, World!"
+	// tags web api
+	// server web {
+	//     timeout 30s
+	// }
+}
+
+func ExampleDecodeError() {
+	type Config struct {
+		Database struct {
+			Port int `conf:"port"`
+		} `conf:"database"`
+	}
+	var cfg Config
+	err := confetti.Unmarshal("database {\n  port abc\n}", &cfg)
+
+	var derr *confetti.DecodeError
+	if errors.As(err, &derr) {
+		fmt.Printf("%d:%d %s %q\n", derr.Line, derr.Column, derr.Field, derr.Argument)
+	}
+	// Output: 2:8 Database.Port "abc"
+}
+
+func ExampleDecoder() {
+	routes := "route 10.0.0.0/8 { via eth0 }\nroute 192.168.0.0/16 { via eth1 }\n"
+	dec := confetti.NewDecoder(strings.NewReader(routes))
+	for {
+		ev, err := dec.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if ev.Type == confetti.EventStartDirective && ev.Depth == 0 {
+			d, err := dec.Directive() // the rest of this directive only
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Println(d.Arguments[1], d.Subdirectives[0].Arguments[1])
+		}
+	}
+	// Output:
+	// 10.0.0.0/8 eth0
+	// 192.168.0.0/16 eth1
+}
+
+func ExampleParseFS() {
+	fsys := fstest.MapFS{
+		"main.conf":        {Data: []byte("include conf.d/*.conf\nlog_level info\n")},
+		"conf.d/db.conf":   {Data: []byte("database { port 5432 }\n")},
+		"conf.d/http.conf": {Data: []byte("listen 8080\n")},
+	}
+	config, err := confetti.ParseFS(fsys, "main.conf", confetti.Options{Include: "include"})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, d := range config.Directives {
+		fmt.Printf("%s: %s\n", d.File, strings.Join(d.Arguments, " "))
+	}
+	// Output:
+	// conf.d/db.conf: database
+	// conf.d/http.conf: listen 8080
+	// main.conf: log_level info
+}
+
+func ExampleConfigurationUnit_Query() {
+	src := `
+server web {
+    port 80
+}
+server api {
+    port 8080
+}
+`
+	config, err := confetti.Parse(src)
+	if err != nil {
+		log.Fatal(err)
+	}
+	matches, err := config.Query("server[*].port")
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, m := range matches {
+		fmt.Println(strings.Join(m.Path, "."), m.Directive.Arguments[1])
+	}
+	fmt.Println(config.Find("server", "port").Arguments[1])
+	// Output:
+	// server.port 80
+	// server.port 8080
+	// 80
+}
+
+func ExampleCST_SetArguments() {
+	src := `# listening port
+port 8080 # keep in sync with the proxy
+server {
+    root /srv
+}
+`
+	tree, err := confetti.ParseCST(src, confetti.Options{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := tree.SetArguments([]int{0}, "9090"); err != nil {
+		log.Fatal(err)
+	}
+	d, err := tree.NewDirective(confetti.Directive{Arguments: []string{"index", "index.html", "home page.html"}})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := tree.Append([]int{1}, d); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(tree.String())
+	// Output:
+	// # listening port
+	// port 9090 # keep in sync with the proxy
+	// server {
+	//     root /srv
+	//     index index.html "home page.html"
+	// }
+}
+
+func ExampleValidate() {
+	schema, err := confetti.ParseSchema(`
+directive port {
+    required
+    type int
+}
+directive server {
+    repeatable
+    args 1
+    block {
+        directive timeout { type duration }
+    }
+}
+`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	config, err := confetti.Parse("server web {\n    timeout soon\n}\n")
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, err := range confetti.Validate(config, schema) {
+		fmt.Println(err)
+	}
+	// Output:
+	// confetti: missing required directive "port" at line 1, column 1
+	// confetti: timeout: "soon" is not a duration at line 2, column 13
+}
@@ -0,0 +1,183 @@
+package confetti
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FormatOptions configures Format.
+type FormatOptions struct {
+	// Options enables the language extensions the input is written in.
+	Options
+
+	// Indent is the text used for each level of nesting. The default is
+	// four spaces.
+	Indent string
+}
+
+// Format returns src in canonical form: one directive per line, blocks
+// indented by one Indent per level with '{' on the directive's line and '}'
+// on its own, arguments quoted only where needed, semicolons dropped, runs of
+// blank lines collapsed to one and the file ending in a single newline.
+// Comments are kept, as are line continuations inside a directive.
+//
+// Formatting does not change the meaning of the document: parsing the
+// result yields the same directives as parsing src. Syntax errors are
+// reported as *ParseError.
+func Format(src []byte, opts FormatOptions) ([]byte, error) {
+	tree, err := ParseCST(string(src), opts.Options)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Indent == "" {
+		opts.Indent = defaultIndent
+	}
+
+	f := &formatter{opts: opts, atStart: true}
+	if err := f.directives(tree.Directives, 0); err != nil {
+		return nil, err
+	}
+	f.comments(tree.Trailing, 0)
+	f.endLine()
+	return []byte(f.sb.String()), nil
+}
+
+// formatter writes a CST in canonical form, one line at a time.
+type formatter struct {
+	sb   strings.Builder
+	opts FormatOptions
+
+	lineOpen  bool // the current line has content and no newline yet
+	lineEnded bool // the current line ends in a # or // comment
+	atStart   bool // nothing has been written since the document or block began
+}
+
+func (f *formatter) directives(nodes []*CSTDirective, depth int) error {
+	for _, d := range nodes {
+		newlines := f.comments(d.Leading, depth)
+		f.startLine(newlines, depth)
+
+		for i, arg := range d.Arguments {
+			if i > 0 {
+				f.argumentGap(arg.Leading, depth)
+			}
+			text, err := f.argument(arg)
+			if err != nil {
+				return err
+			}
+			if f.sb.Len() == 0 {
+				text = quoteBOM(text)
+			}
+			f.sb.WriteString(text)
+		}
+
+		if blk := d.Block; blk != nil {
+			if len(blk.Directives) == 0 && !hasComment(blk.Leading) && !hasComment(blk.Trailing) {
+				f.sb.WriteString(" {}")
+			} else {
+				f.sb.WriteString(" {")
+				f.atStart = true
+				f.comments(blk.Leading, depth+1)
+				if err := f.directives(blk.Directives, depth+1); err != nil {
+					return err
+				}
+				f.comments(blk.Trailing, depth+1)
+				f.startLine(0, depth)
+				f.sb.WriteString("}")
+			}
+		}
+
+		f.comments(d.Trailing, depth)
+	}
+	return nil
+}
+
+// comments writes the comments in ts at the given depth and returns the
+// number of line breaks after the last of them. A comment not preceded by a
+// line break stays on the current line.
+func (f *formatter) comments(ts []Trivia, depth int) int {
+	newlines := 0
+	for _, t := range ts {
+		switch t.Kind {
+		case TriviaNewline:
+			newlines++
+		case TriviaComment:
+			if f.lineOpen && !f.lineEnded && newlines == 0 {
+				f.sb.WriteString(" ")
+			} else {
+				f.startLine(newlines, depth)
+			}
+			f.sb.WriteString(t.Text)
+			f.lineEnded = !strings.HasPrefix(t.Text, "/*")
+			newlines = 0
+		}
+	}
+	return newlines
+}
+
+// startLine ends the current line and indents a new one, preceded by a blank
+// line if the source had one and this is not the first line of a block.
+func (f *formatter) startLine(newlines, depth int) {
+	f.endLine()
+	if newlines > 1 && !f.atStart {
+		f.sb.WriteString("\n")
+	}
+	f.sb.WriteString(strings.Repeat(f.opts.Indent, depth))
+	f.lineOpen = true
+	f.lineEnded = false
+	f.atStart = false
+}
+
+func (f *formatter) endLine() {
+	if f.lineOpen {
+		f.sb.WriteString("\n")
+		f.lineOpen = false
+		f.lineEnded = false
+	}
+}
+
+// argumentGap writes the separator before an argument other than the first:
+// a single space, keeping comments and line continuations.
+func (f *formatter) argumentGap(ts []Trivia, depth int) {
+	sep := " "
+	for _, t := range ts {
+		switch t.Kind {
+		case TriviaComment:
+			f.sb.WriteString(sep)
+			f.sb.WriteString(t.Text)
+			sep = " "
+		case TriviaLineContinuation:
+			f.sb.WriteString(" \\\n")
+			f.sb.WriteString(strings.Repeat(f.opts.Indent, depth+1))
+			sep = ""
+		}
+	}
+	f.sb.WriteString(sep)
+}
+
+// argument returns the canonical source text of arg: expression and
+// punctuator arguments as written, anything else minimally quoted.
+func (f *formatter) argument(arg *CSTArgument) (string, error) {
+	if f.opts.ExpressionArguments && strings.HasPrefix(arg.Raw, "(") {
+		return arg.Raw, nil
+	}
+	for _, p := range f.opts.PunctuatorArguments {
+		if arg.Raw == p {
+			return arg.Raw, nil
+		}
+	}
+	text, err := quoteArgumentWith(arg.Value, f.opts.Options)
+	if err != nil {
+		return "", fmt.Errorf("confetti: argument %q at %s: %w", arg.Value, arg.Span.Start, err)
+	}
+	return text, nil
+}
+
+func hasComment(ts []Trivia) bool {
+	for _, t := range ts {
+		if t.Kind == TriviaComment {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package confetti
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		opts FormatOptions
+		want string
+	}{
+		{"empty", "", FormatOptions{}, ""},
+		{"only blank lines", "\n\n\n", FormatOptions{}, ""},
+		{"final newline", "a 1", FormatOptions{}, "a 1\n"},
+		{"spacing", "  a \t 1   2  \n", FormatOptions{}, "a 1 2\n"},
+		{"semicolons", "a 1; b 2;c 3\n", FormatOptions{}, "a 1\nb 2\nc 3\n"},
+		{"blank lines collapsed", "\n\na 1\n\n\n\nb 2\n\n\n", FormatOptions{}, "a 1\n\nb 2\n"},
+		{"quoting", `a "plain" "two words" "" "{" un\;quoted "x\"y"` + "\n", FormatOptions{},
+			`a plain "two words" "" "{" "un;quoted" "x\"y"` + "\n"},
+		{"triple quoted", "a \"\"\"one\n  two\"\"\"\n", FormatOptions{}, "a \"\"\"one\n  two\"\"\"\n"},
+		{"triple quoted single line", `a """plain"""` + "\n", FormatOptions{}, "a plain\n"},
+		{"blocks", "server web{\nlisten 80\n  loc / { root /var; index a }\n}\n", FormatOptions{},
+			"server web {\n    listen 80\n    loc / {\n        root /var\n        index a\n    }\n}\n"},
+		{"brace on next line", "server\n{\n  x 1\n}\n", FormatOptions{}, "server {\n    x 1\n}\n"},
+		{"empty blocks", "a {\n\n}\nb{}\n", FormatOptions{}, "a {}\nb {}\n"},
+		{"no blank line at block edges", "a {\n\n  x 1\n\n}\n", FormatOptions{}, "a {\n    x 1\n}\n"},
+		{"block semicolon", "a { x 1 }; b 2\n", FormatOptions{}, "a {\n    x 1\n}\nb 2\n"},
+		{"comments", "# head\n\n\na 1 # one\n  # own line\nb 2;   # two\n# tail\n", FormatOptions{},
+			"# head\n\na 1 # one\n# own line\nb 2 # two\n# tail\n"},
+		{"comments in blocks", "a { # open\n  # first\n  x 1\n\n  # last\n}\n", FormatOptions{},
+			"a { # open\n    # first\n    x 1\n\n    # last\n}\n"},
+		{"comment only block", "a {\n# only\n}\n", FormatOptions{}, "a {\n    # only\n}\n"},
+		{"comment before brace", "a\n# why\n{\n  x 1\n}\n", FormatOptions{}, "a {\n    # why\n    x 1\n}\n"},
+		{"continuation", "a one \\\n        two\n", FormatOptions{}, "a one \\\n    two\n"},
+		{"crlf", "a 1\r\nb {\r\nc 2\r\n}\r\n", FormatOptions{}, "a 1\nb {\n    c 2\n}\n"},
+		{"byte order mark", "\ufeffa \ufeff\n", FormatOptions{}, "a \ufeff\n"},
+		{"leading U+FEFF argument", "\n\ufeff x\n", FormatOptions{}, "\"\ufeff\" x\n"},
+		{"indent", "a {\nb {\nc 1\n}\n}\n", FormatOptions{Indent: "\t"}, "a {\n\tb {\n\t\tc 1\n\t}\n}\n"},
+		{"c-style comments", "a 1 /* mid */ 2 // end\n/* own */\nb \"x//y\"\n", FormatOptions{Options: Options{CStyleComments: true}},
+			"a 1 /* mid */ 2 // end\n/* own */\nb \"x//y\"\n"},
+		{"c-style block comment before directive", "/* a */ b 1; /* c */ d 2\n", FormatOptions{Options: Options{CStyleComments: true}},
+			"/* a */\nb 1 /* c */\nd 2\n"},
+		{"expressions", "if  (x > (1))  \"a(b\"\n", FormatOptions{Options: Options{ExpressionArguments: true}},
+			"if (x > (1)) \"a(b\"\n"},
+		{"punctuators", "x=1\ny \"a=b\" \"=\"\n", FormatOptions{Options: Options{PunctuatorArguments: []string{"="}}},
+			"x = 1\ny \"a=b\" \"=\"\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := Format([]byte(tt.src), tt.opts)
+			if err != nil {
+				t.Fatalf("Format error: %v", err)
+			}
+			if got := string(out); got != tt.want {
+				t.Fatalf("got:\n%q\nwant:\n%q", got, tt.want)
+			}
+
+			again, err := Format(out, tt.opts)
+			if err != nil {
+				t.Fatalf("Format of formatted output error: %v", err)
+			}
+			if string(again) != string(out) {
+				t.Errorf("not idempotent:\n first: %q\nsecond: %q", out, again)
+			}
+
+			before, err := ParseWithOptions(tt.src, tt.opts.Options)
+			if err != nil {
+				t.Fatalf("parse input: %v", err)
+			}
+			after, err := ParseWithOptions(string(out), tt.opts.Options)
+			if err != nil {
+				t.Fatalf("parse output: %v", err)
+			}
+			if b, a := marshalOK(t, before), marshalOK(t, after); b != a {
+				t.Errorf("formatting changed the directives:\nbefore: %q\n after: %q", b, a)
+			}
+		})
+	}
+}
+
+func TestFormat_SyntaxError(t *testing.T) {
+	_, err := Format([]byte("a {\n"), FormatOptions{})
+	if err == nil || !strings.Contains(err.Error(), "line") {
+		t.Fatalf("expected a positioned syntax error, got %v", err)
+	}
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("error %v (%T) is not a *ParseError", err, err)
+	}
+}
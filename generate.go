@@ -0,0 +1,471 @@
+package confetti
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SchemaOf returns the schema of the documents that Decode accepts for v,
+// a struct or pointer to a struct, following the same "conf" tag rules:
+// each field becomes a directive declaration, required if its tag says so,
+// with the argument count and type of the field's Go type, a block for
+// struct fields and the field's default. A "confdoc" tag gives the
+// declaration's doc text:
+//
+//	Port int `conf:"port,default=8080" confdoc:"Port to listen on."`
+//
+// Slices of structs and maps of structs are repeatable. Blocks decoded into
+// maps of scalars, and directives decoded by a type implementing
+// Unmarshaler, allow any content.
+func SchemaOf(v any) (*Schema, error) {
+	rv, err := structValue(v, "SchemaOf")
+	if err != nil {
+		return nil, err
+	}
+	return structSchema(rv.Type(), make(map[reflect.Type]bool)), nil
+}
+
+// structValue returns the struct v is or points to.
+func structValue(v any, fn string) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return reflect.Value{}, fmt.Errorf("confetti: %s called with nil %T", fn, v)
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("confetti: %s requires a struct or pointer to a struct, got %T", fn, v)
+	}
+	return rv, nil
+}
+
+// structSchema returns the schema of the block decoded into struct type t.
+// Types in stack are being described; a block of one of them allows any
+// content rather than being described again.
+func structSchema(t reflect.Type, stack map[reflect.Type]bool) *Schema {
+	if stack[t] {
+		return &Schema{AllowUnknown: true}
+	}
+	stack[t] = true
+	defer delete(stack, t)
+
+	meta := fieldMap(t)
+	s := &Schema{}
+	for _, fi := range meta.fields {
+		f := t.Field(fi.index)
+		ds := &DirectiveSchema{Name: fi.name, Doc: f.Tag.Get("confdoc"), Required: fi.required}
+		fieldSchema(ds, f.Type, stack)
+		if fi.hasDefault {
+			ds.Default = []string{fi.def}
+			if ds.MaxArgs != 1 {
+				ds.Default = strings.Fields(fi.def)
+			}
+		}
+		s.Directives = append(s.Directives, ds)
+	}
+	return s
+}
+
+// fieldSchema sets the arguments, type and block of ds from t, the type of
+// the field it is decoded into.
+func fieldSchema(ds *DirectiveSchema, t reflect.Type, stack map[reflect.Type]bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case reflect.PointerTo(t).Implements(unmarshalerType):
+		ds.Repeatable, ds.MinArgs, ds.MaxArgs = true, 0, -1
+		ds.Block = &Schema{AllowUnknown: true}
+
+	case isTextScalar(t):
+		ds.MinArgs, ds.MaxArgs, ds.Type.Kind = 1, 1, scalarKind(t)
+
+	case t.Kind() == reflect.Slice && isBlockElem(t.Elem()):
+		fieldSchema(ds, t.Elem(), stack)
+		ds.Repeatable = true
+
+	case t.Kind() == reflect.Slice:
+		ds.MinArgs, ds.MaxArgs, ds.Type.Kind = 0, -1, scalarKind(t.Elem())
+
+	case t.Kind() == reflect.Map && isBlockElem(t.Elem()):
+		fieldSchema(ds, t.Elem(), stack)
+		ds.Repeatable, ds.MinArgs, ds.MaxArgs = true, 1, -1
+
+	case t.Kind() == reflect.Map:
+		ds.Block = &Schema{AllowUnknown: true}
+
+	case t.Kind() == reflect.Struct:
+		ds.Block = structSchema(t, stack)
+		if i := fieldMap(t).argFieldIdx; i >= 0 {
+			switch arg := t.Field(i).Type; arg.Kind() {
+			case reflect.String:
+				ds.MaxArgs = 1
+			case reflect.Slice:
+				ds.MaxArgs, ds.Type.Kind = -1, scalarKind(arg.Elem())
+			}
+		}
+
+	default:
+		ds.MinArgs, ds.MaxArgs, ds.Type.Kind = 1, 1, scalarKind(t)
+	}
+}
+
+// scalarKind returns the ArgType kind of the arguments decoded into t.
+func scalarKind(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == durationType {
+		return "duration"
+	}
+	if isTextScalar(t) {
+		return "string"
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "int"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "uint"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	}
+	return ""
+}
+
+// MarshalText returns s written as a schema document, which ParseSchema
+// reads back.
+func (s *Schema) MarshalText() ([]byte, error) {
+	var sb strings.Builder
+	if err := writeDirectives(&sb, s.directives(), 0, defaultIndent); err != nil {
+		return nil, err
+	}
+	return []byte(sb.String()), nil
+}
+
+// UnmarshalText sets s to the schema document text, as ParseSchema reads it.
+func (s *Schema) UnmarshalText(text []byte) error {
+	res, err := ParseSchema(string(text))
+	if err != nil {
+		return err
+	}
+	*s = *res
+	return nil
+}
+
+// directives returns the statements of the schema document for s.
+func (s *Schema) directives() []Directive {
+	dirs := []Directive{}
+	for _, ds := range s.Directives {
+		var props []Directive
+		prop := func(args ...string) { props = append(props, Directive{Arguments: args}) }
+		if ds.Doc != "" {
+			prop("doc", ds.Doc)
+		}
+		if ds.Required {
+			prop("required")
+		}
+		if ds.Repeatable {
+			prop("repeatable")
+		}
+		implied := ds.MinArgs == 1 && ds.MaxArgs == 1
+		if ds.Type.Kind == "" {
+			implied = ds.MinArgs == 0 && ds.MaxArgs < 0
+		}
+		switch {
+		case implied:
+		case ds.MaxArgs < 0:
+			prop("args", strconv.Itoa(ds.MinArgs), "*")
+		case ds.MinArgs == ds.MaxArgs:
+			prop("args", strconv.Itoa(ds.MinArgs))
+		default:
+			prop("args", strconv.Itoa(ds.MinArgs), strconv.Itoa(ds.MaxArgs))
+		}
+		switch ds.Type.Kind {
+		case "":
+		case "enum":
+			prop(append([]string{"type", "enum"}, ds.Type.Values...)...)
+		case "regex":
+			prop("type", "regex", ds.Type.Pattern.String())
+		default:
+			prop("type", ds.Type.Kind)
+		}
+		if len(ds.Default) > 0 {
+			prop(append([]string{"default"}, ds.Default...)...)
+		}
+		if ds.Block != nil {
+			props = append(props, Directive{Arguments: []string{"block"}, Subdirectives: ds.Block.directives()})
+		}
+		if props == nil {
+			props = []Directive{}
+		}
+		dirs = append(dirs, Directive{Arguments: []string{"directive", ds.Name}, Subdirectives: props})
+	}
+	if s.AllowUnknown {
+		dirs = append(dirs, Directive{Arguments: []string{"allow-unknown"}})
+	}
+	return dirs
+}
+
+// Template returns an example configuration for v, a struct or pointer to
+// a struct, that documents each directive Decode accepts for it. Every
+// directive is preceded by comments giving its "confdoc" text, as
+// SchemaOf does, then its type and whether it is required, repeatable or
+// has a default:
+//
+//	# Port to listen on.
+//	# int, default 8080
+//	port 8080
+//
+// Directives hold the value of their field in v, or its default if the
+// field is zero, so that decoding the template gives back v with its
+// defaults applied. Empty slices and maps of structs get one example
+// element, and empty maps one example entry, keyed "example" if their
+// keys are strings. Directives decoded by a type implementing Unmarshaler
+// are only described in a comment.
+func Template(v any) ([]byte, error) {
+	rv, err := structValue(v, "Template")
+	if err != nil {
+		return nil, err
+	}
+	w := &templateWriter{stack: make(map[reflect.Type]bool)}
+	if err := w.block(rv, 0); err != nil {
+		return nil, err
+	}
+	return []byte(w.sb.String()), nil
+}
+
+// templateWriter holds the state of a Template call.
+type templateWriter struct {
+	sb    strings.Builder
+	stack map[reflect.Type]bool // struct types being written
+}
+
+// block writes the fields of struct sv at nesting level depth.
+func (w *templateWriter) block(sv reflect.Value, depth int) error {
+	t := sv.Type()
+	w.stack[t] = true
+	defer delete(w.stack, t)
+
+	// work on a copy, to which defaults are applied
+	cp := reflect.New(t).Elem()
+	cp.Set(sv)
+	schema := structSchema(t, make(map[reflect.Type]bool))
+	written := false
+	for i, fi := range fieldMap(t).fields {
+		fv := cp.Field(fi.index)
+		if fi.hasDefault {
+			if err := setDefault(fv, fi.def); err != nil {
+				return fmt.Errorf("confetti: field %q: invalid default %q: %w", fi.name, fi.def, err)
+			}
+		}
+		if w.recursive(fv) {
+			continue // do not expand a recursive type forever
+		}
+		if written {
+			w.sb.WriteString("\n")
+		}
+		written = true
+		w.comment(schema.Directives[i], depth)
+		if err := w.field(fi.name, fv, depth); err != nil {
+			return fmt.Errorf("confetti: field %q: %w", fi.name, err)
+		}
+	}
+	return nil
+}
+
+// recursive reports whether fv is a nil pointer to a struct type being
+// written.
+func (w *templateWriter) recursive(fv reflect.Value) bool {
+	for fv.Kind() == reflect.Pointer {
+		if fv.IsNil() {
+			t := fv.Type().Elem()
+			for t.Kind() == reflect.Pointer {
+				t = t.Elem()
+			}
+			return w.stack[t]
+		}
+		fv = fv.Elem()
+	}
+	return false
+}
+
+// comment writes the comments describing ds.
+func (w *templateWriter) comment(ds *DirectiveSchema, depth int) {
+	if ds.Doc != "" {
+		for _, line := range strings.Split(ds.Doc, "\n") {
+			w.line(depth, strings.TrimRight("# "+line, " "))
+		}
+	}
+	var notes []string
+	switch {
+	case ds.Type.Kind != "" && ds.MaxArgs < 0 && ds.Block == nil:
+		notes = append(notes, "list of "+ds.Type.Kind)
+	case ds.Type.Kind != "" && ds.Block == nil:
+		notes = append(notes, ds.Type.Kind)
+	}
+	if ds.Required {
+		notes = append(notes, "required")
+	}
+	if ds.Repeatable {
+		notes = append(notes, "repeatable")
+	}
+	if len(ds.Default) > 0 {
+		notes = append(notes, "default "+strings.Join(ds.Default, " "))
+	}
+	if len(notes) > 0 {
+		w.line(depth, "# "+strings.Join(notes, ", "))
+	}
+}
+
+// field writes the directives named name for field value fv.
+func (w *templateWriter) field(name string, fv reflect.Value, depth int) error {
+	t := fv.Type()
+	for t.Kind() == reflect.Pointer {
+		if fv.IsNil() {
+			fv = reflect.New(t.Elem())
+		}
+		fv, t = fv.Elem(), t.Elem()
+	}
+
+	switch {
+	case reflect.PointerTo(t).Implements(unmarshalerType):
+		w.line(depth, fmt.Sprintf("# %s: custom syntax, decoded by %s", name, t))
+		return nil
+
+	case isTextScalar(t):
+		return w.directive([]string{name}, fv, depth)
+
+	case t.Kind() == reflect.Slice && isBlockElem(t.Elem()):
+		if fv.Len() == 0 {
+			fv = reflect.Append(fv, reflect.New(t.Elem()).Elem())
+		}
+		for i := 0; i < fv.Len(); i++ {
+			if err := w.field(name, fv.Index(i), depth); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case t.Kind() == reflect.Map:
+		if fv.Len() == 0 {
+			fv = reflect.MakeMap(t)
+			key := reflect.New(t.Key()).Elem()
+			if key.Kind() == reflect.String {
+				key.SetString("example")
+			}
+			fv.SetMapIndex(key, reflect.New(t.Elem()).Elem())
+		}
+		if elem := t.Elem(); reflect.PointerTo(elem).Implements(unmarshalerType) ||
+			elem.Kind() == reflect.Pointer && elem.Implements(unmarshalerType) {
+			w.line(depth, fmt.Sprintf("# %s: custom syntax, decoded by %s", name, elem))
+			return nil
+		}
+		if !isBlockElem(t.Elem()) {
+			dirs, err := encodeMap(name, fv)
+			if err != nil {
+				return err
+			}
+			return w.directives(dirs, depth)
+		}
+		keys := fv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			a, _ := formatScalar(keys[i])
+			b, _ := formatScalar(keys[j])
+			return a < b
+		})
+		for _, k := range keys {
+			key, err := formatScalar(k)
+			if err != nil {
+				return fmt.Errorf("map key: %w", err)
+			}
+			if err := w.blockDirective(name, fv.MapIndex(k), &key, depth); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case t.Kind() == reflect.Struct:
+		return w.blockDirective(name, fv, nil, depth)
+	}
+	return w.directive([]string{name}, fv, depth)
+}
+
+// directive writes a directive with arguments args followed by the scalar
+// or scalar slice value fv.
+func (w *templateWriter) directive(args []string, fv reflect.Value, depth int) error {
+	if fv.Kind() == reflect.Slice && !isTextScalar(fv.Type()) {
+		values, err := formatScalarSlice(fv)
+		if err != nil {
+			return err
+		}
+		args = append(args, values...)
+	} else {
+		s, err := formatScalar(fv)
+		if err != nil {
+			return err
+		}
+		args = append(args, s)
+	}
+	return w.directives([]Directive{{Arguments: args}}, depth)
+}
+
+// blockDirective writes the block directive named name for struct value
+// sv, with the inline arguments of its ",arg" field. With a key, the
+// directive is a map entry and takes key as its first inline argument.
+func (w *templateWriter) blockDirective(name string, sv reflect.Value, key *string, depth int) error {
+	for sv.Kind() == reflect.Pointer {
+		if sv.IsNil() {
+			sv = reflect.New(sv.Type().Elem())
+		}
+		sv = sv.Elem()
+	}
+	d, err := encodeBlock(name, sv)
+	if err != nil {
+		return err
+	}
+	if key != nil && (len(d.Arguments) < 2 || d.Arguments[1] != *key) {
+		d.Arguments = append([]string{name, *key}, d.Arguments[1:]...)
+	}
+
+	w.sb.WriteString(strings.Repeat(defaultIndent, depth))
+	for i, arg := range d.Arguments {
+		quoted, err := quoteArgument(arg)
+		if err != nil {
+			return fmt.Errorf("argument %q: %w", arg, err)
+		}
+		if i > 0 {
+			w.sb.WriteString(" ")
+		}
+		w.sb.WriteString(quoted)
+	}
+	if len(fieldMap(sv.Type()).fields) == 0 {
+		w.sb.WriteString(" {}\n")
+		return nil
+	}
+	w.sb.WriteString(" {\n")
+	if err := w.block(sv, depth+1); err != nil {
+		return err
+	}
+	w.line(depth, "}")
+	return nil
+}
+
+// directives writes dirs at nesting level depth.
+func (w *templateWriter) directives(dirs []Directive, depth int) error {
+	return writeDirectives(&w.sb, dirs, depth, defaultIndent)
+}
+
+// line writes s on a line of its own at nesting level depth.
+func (w *templateWriter) line(depth int, s string) {
+	w.sb.WriteString(strings.Repeat(defaultIndent, depth))
+	w.sb.WriteString(s)
+	w.sb.WriteString("\n")
+}
@@ -0,0 +1,237 @@
+package confetti
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type genServer struct {
+	Name    string        `conf:",arg"`
+	Root    string        `conf:"root,required" confdoc:"Directory to serve."`
+	Timeout time.Duration `conf:"timeout,default=30s"`
+}
+
+type genConfig struct {
+	Port    int                   `conf:"port,default=8080" confdoc:"Port to listen on."`
+	Debug   bool                  `conf:"debug"`
+	Tags    []string              `conf:"tags" confdoc:"Labels attached to metrics.\nMay be empty."`
+	Ratio   *float64              `conf:"ratio"`
+	Servers []genServer           `conf:"server"`
+	Env     map[string]string     `conf:"env"`
+	Pools   map[string]*genServer `conf:"pool"`
+	Log     struct {
+		Level string `conf:"level,default=info"`
+	} `conf:"log"`
+	Tree    *genTree `conf:"tree"`
+	Ignored string   `conf:"-"`
+}
+
+type genTree struct {
+	Value string   `conf:"value"`
+	Child *genTree `conf:"child"`
+}
+
+func TestSchemaOf(t *testing.T) {
+	s, err := SchemaOf(&genConfig{})
+	if err != nil {
+		t.Fatalf("SchemaOf error: %v", err)
+	}
+	text, err := s.MarshalText()
+	if err != nil {
+		t.Fatalf("MarshalText error: %v", err)
+	}
+	want := `directive port {
+    doc "Port to listen on."
+    type int
+    default 8080
+}
+directive debug {
+    type bool
+}
+directive tags {
+    doc """Labels attached to metrics.
+May be empty."""
+    args 0 *
+    type string
+}
+directive ratio {
+    type float
+}
+directive server {
+    repeatable
+    args 0 1
+    block {
+        directive root {
+            doc "Directory to serve."
+            required
+            type string
+        }
+        directive timeout {
+            type duration
+            default 30s
+        }
+    }
+}
+directive env {
+    args 0
+    block {
+        allow-unknown
+    }
+}
+directive pool {
+    repeatable
+    args 1 *
+    block {
+        directive root {
+            doc "Directory to serve."
+            required
+            type string
+        }
+        directive timeout {
+            type duration
+            default 30s
+        }
+    }
+}
+directive log {
+    args 0
+    block {
+        directive level {
+            type string
+            default info
+        }
+    }
+}
+directive tree {
+    args 0
+    block {
+        directive value {
+            type string
+        }
+        directive child {
+            args 0
+            block {
+                allow-unknown
+            }
+        }
+    }
+}
+`
+	if string(text) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", text, want)
+	}
+
+	var back Schema
+	if err := back.UnmarshalText(text); err != nil {
+		t.Fatalf("UnmarshalText error: %v", err)
+	}
+	if !reflect.DeepEqual(&back, s) {
+		t.Errorf("schema does not round-trip:\n got: %+v\nwant: %+v", &back, s)
+	}
+
+	if _, err := SchemaOf(42); err == nil {
+		t.Errorf("SchemaOf(42) succeeded")
+	}
+}
+
+func TestSchemaOf_Unsigned(t *testing.T) {
+	var cfg struct {
+		Workers uint     `conf:"workers"`
+		Ports   []uint16 `conf:"ports"`
+	}
+	s, err := SchemaOf(&cfg)
+	if err != nil {
+		t.Fatalf("SchemaOf error: %v", err)
+	}
+	unit, err := Parse("workers 4\nports 80 443\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := Validate(unit, s); errs != nil {
+		t.Errorf("valid document: %v", errs)
+	}
+
+	// what the schema accepts decodes
+	unit, err = Parse("workers -1\nports 80 -443\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := Validate(unit, s)
+	if len(errs) != 2 || errs[0].Msg != `workers: "-1" is not a non-negative integer` || errs[1].Column != 10 {
+		t.Errorf("errors: %v", errs)
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	out, err := Template(genConfig{Debug: true, Servers: []genServer{{Name: "web", Root: "/srv"}}})
+	if err != nil {
+		t.Fatalf("Template error: %v", err)
+	}
+	want := `# Port to listen on.
+# int, default 8080
+port 8080
+
+# bool
+debug true
+
+# Labels attached to metrics.
+# May be empty.
+# list of string
+tags
+
+# float
+ratio 0
+
+# repeatable
+server web {
+    # Directory to serve.
+    # string, required
+    root /srv
+
+    # duration, default 30s
+    timeout 30s
+}
+
+env {
+    example ""
+}
+
+# repeatable
+pool example {
+    # Directory to serve.
+    # string, required
+    root ""
+
+    # duration, default 30s
+    timeout 30s
+}
+
+log {
+    # string, default info
+    level info
+}
+
+tree {
+    # string
+    value ""
+}
+`
+	if string(out) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out, want)
+	}
+
+	// the template decodes, and is valid against the schema
+	var cfg genConfig
+	if err := Unmarshal(string(out), &cfg); err != nil {
+		t.Fatalf("Unmarshal(template) error: %v", err)
+	}
+	if cfg.Port != 8080 || !cfg.Debug || len(cfg.Servers) != 1 || cfg.Servers[0].Timeout != 30*time.Second || cfg.Log.Level != "info" {
+		t.Errorf("decoded template = %+v", cfg)
+	}
+	s, _ := SchemaOf(cfg)
+	unit, _ := Parse(string(out))
+	if errs := Validate(unit, s); errs != nil {
+		t.Errorf("template does not validate: %v", errs)
+	}
+}
@@ -0,0 +1,214 @@
+package confetti
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Errors wrapped by the *DecodeError returned by Get and the typed getters
+// such as ConfigurationUnit.GetInt. Test for them with errors.Is.
+var (
+	ErrNotFound   = errors.New("directive not found")
+	ErrArity      = errors.New("wrong number of arguments")
+	ErrConversion = errors.New("cannot convert argument")
+)
+
+// Node is implemented by *ConfigurationUnit and *Directive, from which Get
+// reads values.
+type Node interface {
+	// node returns the directive itself, nil for a unit, and the
+	// directives it contains.
+	node() (*Directive, []Directive)
+}
+
+func (cf *ConfigurationUnit) node() (*Directive, []Directive) { return nil, cf.Directives }
+
+func (d *Directive) node() (*Directive, []Directive) { return d, d.Subdirectives }
+
+// findAll returns the directives found by following path from n, in
+// document order.
+func findAll(n Node, path []string) []*Directive {
+	self, dirs := n.node()
+	if len(path) == 0 {
+		if self == nil {
+			return nil
+		}
+		return []*Directive{self}
+	}
+	var res []*Directive
+	for _, m := range namesSelector(path).match(dirs, nil, nil, nil) {
+		res = append(res, m.Directive)
+	}
+	return res
+}
+
+// Get converts the value of the directive found by following path from n,
+// as [ConfigurationUnit.Find] does, to a T. From a *Directive, path leads
+// through its subdirectives, and an empty path denotes the directive itself.
+//
+// The value is made of the directive's arguments after its name, converted
+// with the rules Decode applies to struct fields: a scalar T, such as
+// string, int, bool, time.Duration or a type implementing
+// encoding.TextUnmarshaler, takes exactly one argument; a slice of scalars
+// takes them all; a struct or map is decoded from the directive's block,
+// and a slice of structs gets one element for each directive at path.
+//
+//	port, err := confetti.Get[uint16](cfg, "server", "port")
+//
+// Errors are reported as a *DecodeError wrapping ErrNotFound if there is no
+// such directive, ErrArity if a scalar T is not given exactly one argument,
+// or ErrConversion if an argument cannot be converted to T. Struct and map
+// targets report errors within their block as Decode does.
+func Get[T any](n Node, path ...string) (T, error) {
+	var v T
+	err := get(n, path, reflect.ValueOf(&v).Elem())
+	return v, err
+}
+
+// get sets fv from the directive found by following path from n.
+func get(n Node, path []string, fv reflect.Value) error {
+	found := findAll(n, path)
+	if len(found) == 0 {
+		return &DecodeError{Path: path, Err: ErrNotFound}
+	}
+	d := found[0]
+	derr := &DecodeError{Path: path, File: d.File, Line: d.Span.Start.Line, Column: d.Span.Start.Column}
+	var args []string
+	if len(d.Arguments) > 0 {
+		args = d.Arguments[1:]
+	}
+
+	t := fv.Type()
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case isBlockElem(t) || t.Kind() == reflect.Map || (t.Kind() == reflect.Slice && isBlockElem(t.Elem())):
+		if t.Kind() != reflect.Slice {
+			found = found[:1]
+		}
+		dec := &decoder{}
+		for _, d := range found {
+			path := decodePath{directives: path, pos: d.Span.Start, file: d.File}
+			if err := dec.decodeField(fv, fv.Type(), *d, path); err != nil {
+				return newDecodeError(*d, path, err)
+			}
+		}
+		return nil
+
+	case t.Kind() == reflect.Slice && !isTextScalar(t):
+		sv := reflect.New(t).Elem()
+		if err := setScalarSlice(sv, args); err != nil {
+			var aerr *argError
+			errors.As(err, &aerr)
+			derr.setArgument(d, aerr.index)
+			derr.Err = &conversionError{aerr.err}
+			return derr
+		}
+		setPointers(fv, sv)
+		return nil
+	}
+
+	if len(args) != 1 {
+		derr.Err = fmt.Errorf("%w: want 1, got %d", ErrArity, len(args))
+		return derr
+	}
+	sv := reflect.New(t).Elem()
+	if err := setScalar(sv, args[0]); err != nil {
+		derr.setArgument(d, 0)
+		derr.Err = &conversionError{err}
+		return derr
+	}
+	setPointers(fv, sv)
+	return nil
+}
+
+// setPointers sets fv, of type T or *T or **T..., to v of type T,
+// allocating the pointers.
+func setPointers(fv, v reflect.Value) {
+	for fv.Kind() == reflect.Pointer && fv.Type() != v.Type() {
+		fv.Set(reflect.New(fv.Type().Elem()))
+		fv = fv.Elem()
+	}
+	fv.Set(v)
+}
+
+// setArgument points e at argument i of d, counted after its name.
+func (e *DecodeError) setArgument(d *Directive, i int) {
+	e.Argument = d.Arguments[i+1]
+	if i+1 < len(d.ArgSpans) {
+		e.Line, e.Column = d.ArgSpans[i+1].Start.Line, d.ArgSpans[i+1].Start.Column
+	}
+}
+
+// conversionError is an error converting an argument; it matches
+// ErrConversion without changing the message.
+type conversionError struct {
+	err error
+}
+
+func (e *conversionError) Error() string { return e.err.Error() }
+
+func (e *conversionError) Unwrap() error { return e.err }
+
+func (e *conversionError) Is(target error) bool { return target == ErrConversion }
+
+// GetString returns the single argument of the directive at path, as
+// Get[string] does.
+func (cf *ConfigurationUnit) GetString(path ...string) (string, error) {
+	return Get[string](cf, path...)
+}
+
+// GetInt returns the directive at path as an int, as Get[int] does.
+func (cf *ConfigurationUnit) GetInt(path ...string) (int, error) {
+	return Get[int](cf, path...)
+}
+
+// GetBool returns the directive at path as a bool, as Get[bool] does.
+func (cf *ConfigurationUnit) GetBool(path ...string) (bool, error) {
+	return Get[bool](cf, path...)
+}
+
+// GetDuration returns the directive at path as a time.Duration, as
+// Get[time.Duration] does.
+func (cf *ConfigurationUnit) GetDuration(path ...string) (time.Duration, error) {
+	return Get[time.Duration](cf, path...)
+}
+
+// GetStrings returns the arguments after the name of the directive at path,
+// as Get[[]string] does. A directive with no arguments yields an empty slice.
+func (cf *ConfigurationUnit) GetStrings(path ...string) ([]string, error) {
+	return Get[[]string](cf, path...)
+}
+
+// GetString returns the single argument of the subdirective at path, or of
+// d itself if path is empty, as Get[string] does.
+func (d *Directive) GetString(path ...string) (string, error) {
+	return Get[string](d, path...)
+}
+
+// GetInt returns the subdirective at path, or d itself if path is empty, as
+// an int, as Get[int] does.
+func (d *Directive) GetInt(path ...string) (int, error) {
+	return Get[int](d, path...)
+}
+
+// GetBool returns the subdirective at path, or d itself if path is empty, as
+// a bool, as Get[bool] does.
+func (d *Directive) GetBool(path ...string) (bool, error) {
+	return Get[bool](d, path...)
+}
+
+// GetDuration returns the subdirective at path, or d itself if path is
+// empty, as a time.Duration, as Get[time.Duration] does.
+func (d *Directive) GetDuration(path ...string) (time.Duration, error) {
+	return Get[time.Duration](d, path...)
+}
+
+// GetStrings returns the arguments after the name of the subdirective at
+// path, or of d itself if path is empty, as Get[[]string] does.
+func (d *Directive) GetStrings(path ...string) ([]string, error) {
+	return Get[[]string](d, path...)
+}
@@ -0,0 +1,131 @@
+package confetti
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const getSrc = `name app
+port 8080
+debug true
+timeout 1m30s
+hosts a b c
+empty
+pair 1 2
+addr 10.0.0.1
+server web {
+    port 80
+}
+server api {
+    port 81
+}
+limits {
+    cpu 2
+}
+`
+
+func TestGet(t *testing.T) {
+	cfg, err := Parse(getSrc)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	if v, err := cfg.GetString("name"); v != "app" || err != nil {
+		t.Errorf("GetString = %q, %v", v, err)
+	}
+	if v, err := cfg.GetInt("port"); v != 8080 || err != nil {
+		t.Errorf("GetInt = %d, %v", v, err)
+	}
+	if v, err := cfg.GetBool("debug"); !v || err != nil {
+		t.Errorf("GetBool = %v, %v", v, err)
+	}
+	if v, err := cfg.GetDuration("timeout"); v != 90*time.Second || err != nil {
+		t.Errorf("GetDuration = %v, %v", v, err)
+	}
+	if v, err := cfg.GetStrings("hosts"); !reflect.DeepEqual(v, []string{"a", "b", "c"}) || err != nil {
+		t.Errorf("GetStrings = %q, %v", v, err)
+	}
+	if v, err := cfg.GetStrings("empty"); len(v) != 0 || err != nil {
+		t.Errorf("GetStrings(empty) = %q, %v", v, err)
+	}
+	if v, err := cfg.GetInt("server", "port"); v != 80 || err != nil {
+		t.Errorf("GetInt(server, port) = %d, %v", v, err)
+	}
+	if v, err := Get[[]uint8](cfg, "pair"); !reflect.DeepEqual(v, []uint8{1, 2}) || err != nil {
+		t.Errorf("Get[[]uint8] = %v, %v", v, err)
+	}
+	if v, err := Get[net.IP](cfg, "addr"); !v.Equal(net.IPv4(10, 0, 0, 1)) || err != nil {
+		t.Errorf("Get[net.IP] = %v, %v", v, err)
+	}
+	if v, err := Get[*int](cfg, "port"); v == nil || *v != 8080 || err != nil {
+		t.Errorf("Get[*int] = %v, %v", v, err)
+	}
+
+	type limits struct {
+		CPU int `conf:"cpu"`
+	}
+	if v, err := Get[limits](cfg, "limits"); v.CPU != 2 || err != nil {
+		t.Errorf("Get[limits] = %+v, %v", v, err)
+	}
+	type server struct {
+		Name string `conf:",arg"`
+		Port int    `conf:"port"`
+	}
+	want := []server{{"web", 80}, {"api", 81}}
+	if v, err := Get[[]server](cfg, "server"); !reflect.DeepEqual(v, want) || err != nil {
+		t.Errorf("Get[[]server] = %+v, %v", v, err)
+	}
+
+	// from a directive
+	api := cfg.Find("server")
+	if v, err := api.GetInt("port"); v != 80 || err != nil {
+		t.Errorf("Directive.GetInt(port) = %d, %v", v, err)
+	}
+	if v, err := api.GetString(); v != "web" || err != nil {
+		t.Errorf("Directive.GetString() = %q, %v", v, err)
+	}
+}
+
+func TestGet_Errors(t *testing.T) {
+	cfg, err := Parse(getSrc)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	tests := []struct {
+		name      string
+		get       func() error
+		want      error
+		line, col int
+		msg       string
+	}{
+		{"missing", func() error { _, err := cfg.GetInt("nope"); return err }, ErrNotFound, 0, 0,
+			"confetti: nope: directive not found"},
+		{"missing nested", func() error { _, err := cfg.GetInt("server", "nope"); return err }, ErrNotFound, 0, 0,
+			"confetti: server > nope: directive not found"},
+		{"no value", func() error { _, err := cfg.GetString("empty"); return err }, ErrArity, 6, 1,
+			"confetti: empty: wrong number of arguments: want 1, got 0 at line 6, column 1"},
+		{"two values", func() error { _, err := cfg.GetInt("pair"); return err }, ErrArity, 7, 1,
+			"confetti: pair: wrong number of arguments: want 1, got 2 at line 7, column 1"},
+		{"not an int", func() error { _, err := cfg.GetInt("name"); return err }, ErrConversion, 1, 6,
+			`confetti: name: cannot parse "app" as int: strconv.ParseInt: parsing "app": invalid syntax at line 1, column 6`},
+		{"not a duration", func() error { _, err := cfg.GetDuration("port"); return err }, ErrConversion, 2, 6, ""},
+		{"bad element", func() error { _, err := Get[[]int](cfg, "hosts"); return err }, ErrConversion, 5, 7, ""},
+	}
+	for _, tt := range tests {
+		err := tt.get()
+		var derr *DecodeError
+		if !errors.Is(err, tt.want) || !errors.As(err, &derr) {
+			t.Errorf("%s: error = %v, want a *DecodeError wrapping %v", tt.name, err, tt.want)
+			continue
+		}
+		if derr.Line != tt.line || derr.Column != tt.col {
+			t.Errorf("%s: error at %d:%d, want %d:%d", tt.name, derr.Line, derr.Column, tt.line, tt.col)
+		}
+		if tt.msg != "" && err.Error() != tt.msg {
+			t.Errorf("%s: message\n got: %s\nwant: %s", tt.name, err, tt.msg)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package confetti
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+)
+
+// ParseFS parses the file name in fsys, resolving includes when
+// Options.Include is set. Each include directive is replaced, at its place
+// in the document and at its nesting level, by the directives of the files
+// its arguments name:
+//
+//	include conf.d/*.conf
+//	server web {
+//	    include web/common.conf web/tls.conf
+//	}
+//
+// Arguments are slash-separated paths relative to the directory of the
+// including file, or to the root of fsys if they begin with a slash. They
+// may be glob patterns, as understood by [path.Match]; files matching a
+// pattern are included in lexical order, and a pattern matching nothing
+// includes nothing. A file that does not exist and is not a pattern is an
+// error, as is a file that includes itself, directly or through others,
+// which wraps [ErrIncludeCycle]; a file may otherwise be included any number
+// of times.
+//
+// Limits.MaxInputBytes and Limits.MaxDirectives apply to all the files read
+// together, counting a file again each time it is included, and the other
+// limits to each file separately. An include that reads past them fails
+// with the limit error at its position.
+//
+// Every directive records the file it came from in Directive.File, and
+// errors report it in ParseError.File. With Options.AllErrors, the errors of
+// every file are returned in one ErrorList, in the order they were found.
+// An error reading name itself is returned as is.
+func ParseFS(fsys fs.FS, name string, opts Options) (*ConfigurationUnit, error) {
+	in := &includer{fsys: fsys, opts: opts}
+	src, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	unit, err := in.parse(name, src)
+	if err != nil {
+		return nil, err
+	}
+	dirs, err := in.expandFile(unit, name)
+	if err != nil {
+		return nil, err
+	}
+	return &ConfigurationUnit{Directives: dirs}, in.errors.Err()
+}
+
+// includer resolves the includes of the files read by ParseFS.
+type includer struct {
+	fsys   fs.FS
+	opts   Options
+	stack  []string  // files being read, the outermost first
+	errors ErrorList // errors recovered from with Options.AllErrors
+
+	bytes, directives int // read from all files so far
+}
+
+// parse parses src, read from name, and counts it towards the limits on all
+// files.
+func (in *includer) parse(name string, src []byte) (*ConfigurationUnit, error) {
+	unit, err := ParseWithOptions(string(src), in.opts)
+	switch err := err.(type) {
+	case nil:
+	case ErrorList:
+		for _, perr := range err {
+			perr.File = name
+		}
+		in.errors = append(in.errors, err...)
+	case *ParseError:
+		err.File = name
+		return nil, err
+	default:
+		return nil, err
+	}
+	in.bytes += len(src)
+	in.directives += countDirectives(unit.Directives)
+	return unit, nil
+}
+
+// countDirectives returns the number of directives in dirs, at every level.
+func countDirectives(dirs []Directive) int {
+	n := len(dirs)
+	for _, d := range dirs {
+		n += countDirectives(d.Subdirectives)
+	}
+	return n
+}
+
+// expandFile returns the directives of unit, read from name, with their
+// includes replaced.
+func (in *includer) expandFile(unit *ConfigurationUnit, name string) ([]Directive, error) {
+	in.stack = append(in.stack, name)
+	defer func() { in.stack = in.stack[:len(in.stack)-1] }()
+	return in.expand(unit.Directives, name)
+}
+
+// expand returns dirs, read from name, with their includes replaced.
+func (in *includer) expand(dirs []Directive, name string) ([]Directive, error) {
+	var res []Directive
+	for _, d := range dirs {
+		d.File = name
+		if in.opts.Include != "" && len(d.Arguments) > 0 && d.Arguments[0] == in.opts.Include {
+			included, err := in.include(d, name)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, included...)
+			continue
+		}
+		if len(d.Subdirectives) > 0 {
+			subdirs, err := in.expand(d.Subdirectives, name)
+			if err != nil {
+				return nil, err
+			}
+			d.Subdirectives = subdirs
+		}
+		res = append(res, d)
+	}
+	return res, nil
+}
+
+// include returns the directives of the files named by the include
+// directive d, read from name.
+func (in *includer) include(d Directive, name string) ([]Directive, error) {
+	if len(d.Arguments) < 2 {
+		return nil, in.fail(name, d.Span.Start, nil, "%s needs at least one file name", d.Arguments[0])
+	}
+	if d.HasBlock() {
+		return nil, in.fail(name, d.LeftBrace.Start, nil, "%s cannot have a block", d.Arguments[0])
+	}
+
+	var res []Directive
+	for i, pattern := range d.Arguments[1:] {
+		pos := d.ArgSpans[i+1].Start
+		target := path.Join(path.Dir(name), pattern)
+		if strings.HasPrefix(pattern, "/") {
+			target = strings.TrimPrefix(path.Clean(pattern), "/")
+			if target == "" {
+				target = "."
+			}
+		}
+		if !fs.ValidPath(target) {
+			if err := in.fail(name, pos, nil, "invalid include path %q", pattern); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		files := []string{target}
+		if strings.ContainsAny(target, `*?[\`) {
+			var err error
+			if files, err = fs.Glob(in.fsys, target); err != nil {
+				if err := in.fail(name, pos, err, "invalid include pattern %q", pattern); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+
+		for _, file := range files {
+			dirs, err := in.file(name, pos, file)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, dirs...)
+		}
+	}
+	return res, nil
+}
+
+// file reads and parses file, included at pos in name.
+func (in *includer) file(name string, pos Position, file string) ([]Directive, error) {
+	if i := slices.Index(in.stack, file); i >= 0 {
+		cycle := strings.Join(append(in.stack[i:len(in.stack):len(in.stack)], file), " -> ")
+		return nil, in.fail(name, pos, ErrIncludeCycle, "include cycle: %s", cycle)
+	}
+	src, err := fs.ReadFile(in.fsys, file)
+	if err != nil {
+		msg := err.Error()
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			msg = pathErr.Err.Error()
+		}
+		return nil, in.fail(name, pos, err, "cannot include %s: %s", file, msg)
+	}
+	unit, err := in.parse(file, src)
+	if err != nil {
+		return nil, err
+	}
+
+	var perr *ParseError
+	switch lim := in.opts.Limits; {
+	case lim.MaxInputBytes > 0 && in.bytes > lim.MaxInputBytes:
+		perr = limitError(pos, ErrInputTooLarge, lim.MaxInputBytes)
+	case lim.MaxDirectives > 0 && in.directives > lim.MaxDirectives:
+		perr = limitError(pos, ErrTooManyDirectives, lim.MaxDirectives)
+	}
+	if perr != nil {
+		perr.File = name
+		return nil, perr
+	}
+	return in.expandFile(unit, file)
+}
+
+// fail reports an include error at pos in name, wrapping err. With
+// Options.AllErrors it records the error and returns nil, so that the
+// include is skipped.
+func (in *includer) fail(name string, pos Position, err error, format string, args ...any) error {
+	perr := &ParseError{File: name, Line: pos.Line, Column: pos.Column, Msg: fmt.Sprintf(format, args...), Err: err}
+	if in.opts.AllErrors {
+		in.errors = append(in.errors, perr)
+		return nil
+	}
+	return perr
+}
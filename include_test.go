@@ -0,0 +1,240 @@
+package confetti
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+// names returns the names of dirs and their subdirectives, each prefixed by
+// the file it came from.
+func names(dirs []Directive) []string {
+	var res []string
+	for _, d := range dirs {
+		res = append(res, d.File+":"+d.Arguments[0])
+		res = append(res, names(d.Subdirectives)...)
+	}
+	return res
+}
+
+func TestParseFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.conf":         {Data: []byte("a 1\ninclude conf.d/*.conf\nserver {\n    include web/common.conf\n}\nz 1\n")},
+		"conf.d/2.conf":     {Data: []byte("two 2\n")},
+		"conf.d/1.conf":     {Data: []byte("one 1\ninclude ../shared.conf\n")},
+		"conf.d/skip.txt":   {Data: []byte("}")},
+		"shared.conf":       {Data: []byte("shared { x 1 }\n")},
+		"web/common.conf":   {Data: []byte("root /srv\ninclude /shared.conf none/*.conf\n")},
+		"unused/cycle.conf": {Data: []byte("include cycle.conf\n")},
+	}
+	unit, err := ParseFS(fsys, "main.conf", Options{Include: "include"})
+	if err != nil {
+		t.Fatalf("ParseFS error: %v", err)
+	}
+	want := []string{
+		"main.conf:a",
+		"conf.d/1.conf:one",
+		"shared.conf:shared", "shared.conf:x",
+		"conf.d/2.conf:two",
+		"main.conf:server",
+		"web/common.conf:root",
+		"shared.conf:shared", "shared.conf:x",
+		"main.conf:z",
+	}
+	if got := names(unit.Directives); !reflect.DeepEqual(got, want) {
+		t.Fatalf("directives:\n got: %q\nwant: %q", got, want)
+	}
+	if got := unit.Directives[1].Span.Start; got.Line != 1 || got.Column != 1 {
+		t.Errorf("included directive at %v, want 1:1 in its own file", got)
+	}
+
+	// includes are opt-in
+	unit, err = ParseFS(fsys, "main.conf", Options{})
+	if err != nil {
+		t.Fatalf("ParseFS error: %v", err)
+	}
+	if got := unit.Directives[1].Arguments; !reflect.DeepEqual(got, []string{"include", "conf.d/*.conf"}) {
+		t.Errorf("include directive = %q, want it unexpanded", got)
+	}
+}
+
+func TestParseFS_Errors(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     fstest.MapFS
+		wantErr   error // wrapped by the error, if not nil
+		file      string
+		line, col int
+	}{
+		{
+			name:  "syntax error in included file",
+			files: fstest.MapFS{"a.conf": {Data: []byte("include b.conf\n")}, "b.conf": {Data: []byte("x 1\n}\n")}},
+			file:  "b.conf", line: 2, col: 1,
+		},
+		{
+			name:    "missing file",
+			files:   fstest.MapFS{"a.conf": {Data: []byte("x 1\ninclude  missing.conf\n")}},
+			wantErr: fs.ErrNotExist,
+			file:    "a.conf", line: 2, col: 10,
+		},
+		{
+			name:    "self include",
+			files:   fstest.MapFS{"a.conf": {Data: []byte("include a.conf\n")}},
+			wantErr: ErrIncludeCycle,
+			file:    "a.conf", line: 1, col: 9,
+		},
+		{
+			name: "indirect cycle",
+			files: fstest.MapFS{
+				"a.conf":     {Data: []byte("include sub/b.conf\n")},
+				"sub/b.conf": {Data: []byte("x {\n  include ../a.conf\n}\n")},
+			},
+			wantErr: ErrIncludeCycle,
+			file:    "sub/b.conf", line: 2, col: 11,
+		},
+		{
+			name:  "include with a block",
+			files: fstest.MapFS{"a.conf": {Data: []byte("include b.conf { x }\n")}},
+			file:  "a.conf", line: 1, col: 16,
+		},
+		{
+			name:  "include without a file",
+			files: fstest.MapFS{"a.conf": {Data: []byte("  include\n")}},
+			file:  "a.conf", line: 1, col: 3,
+		},
+		{
+			name:  "path outside the file system",
+			files: fstest.MapFS{"a.conf": {Data: []byte("include ../b.conf\n")}},
+			file:  "a.conf", line: 1, col: 9,
+		},
+		{
+			name:    "bad pattern",
+			files:   fstest.MapFS{"a.conf": {Data: []byte("include [.conf\n")}},
+			wantErr: path.ErrBadPattern,
+			file:    "a.conf", line: 1, col: 9,
+		},
+	}
+	for _, tt := range tests {
+		_, err := ParseFS(tt.files, "a.conf", Options{Include: "include"})
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("%s: error = %v, want a *ParseError", tt.name, err)
+			continue
+		}
+		if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: error = %v, want it to wrap %v", tt.name, err, tt.wantErr)
+		}
+		if perr.File != tt.file || perr.Line != tt.line || perr.Column != tt.col {
+			t.Errorf("%s: error at %s:%d:%d, want %s:%d:%d", tt.name, perr.File, perr.Line, perr.Column, tt.file, tt.line, tt.col)
+		}
+	}
+}
+
+func TestParseFS_CycleMessage(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.conf": {Data: []byte("include b.conf\n")},
+		"b.conf": {Data: []byte("include c.conf\n")},
+		"c.conf": {Data: []byte("include b.conf\n")},
+	}
+	_, err := ParseFS(fsys, "a.conf", Options{Include: "include"})
+	want := "confetti: include cycle: b.conf -> c.conf -> b.conf in c.conf at line 1, column 9"
+	if err == nil || err.Error() != want {
+		t.Fatalf("error = %v, want %s", err, want)
+	}
+}
+
+func TestParseFS_Limits(t *testing.T) {
+	small := fstest.MapFS{
+		"a.conf": {Data: []byte("include b.conf b.conf\n")},
+		"b.conf": {Data: []byte("x\n")},
+	}
+	// each file includes the next one twice, doubling the document
+	chain := fstest.MapFS{"f30.conf": {Data: []byte("x\n")}}
+	for i := 0; i < 30; i++ {
+		chain[fmt.Sprintf("f%d.conf", i)] = &fstest.MapFile{Data: []byte(fmt.Sprintf("include f%d.conf f%[1]d.conf\n", i+1))}
+	}
+	tests := []struct {
+		files     fstest.MapFS
+		limits    Limits
+		want      error // nil if the files are within the limits
+		file      string
+		line, col int
+	}{
+		{small, Limits{MaxDirectives: 3, MaxInputBytes: 26}, nil, "", 0, 0},
+		{small, Limits{MaxDirectives: 2}, ErrTooManyDirectives, "a.conf", 1, 16},
+		{small, Limits{MaxInputBytes: 25}, ErrInputTooLarge, "a.conf", 1, 16},
+		{chain, Limits{MaxDirectives: 1000}, ErrTooManyDirectives, "", 0, 0},
+		{chain, Limits{MaxInputBytes: 1 << 16}, ErrInputTooLarge, "", 0, 0},
+	}
+	for i, tt := range tests {
+		name := "a.conf"
+		if tt.files["a.conf"] == nil {
+			name = "f0.conf"
+		}
+		_, err := ParseFS(tt.files, name, Options{Include: "include", Limits: tt.limits})
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%d: unexpected error: %v", i, err)
+			}
+			continue
+		}
+		var perr *ParseError
+		if !errors.Is(err, tt.want) || !errors.As(err, &perr) {
+			t.Errorf("%d: error = %v, want %v", i, err, tt.want)
+			continue
+		}
+		if tt.file != "" && (perr.File != tt.file || perr.Line != tt.line || perr.Column != tt.col) {
+			t.Errorf("%d: error at %s:%d:%d, want %s:%d:%d", i, perr.File, perr.Line, perr.Column, tt.file, tt.line, tt.col)
+		}
+	}
+}
+
+func TestParseFS_AllErrors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.conf": {Data: []byte("x }\ninclude b.conf missing.conf\ny 1\n")},
+		"b.conf": {Data: []byte("z {\n")},
+	}
+	unit, err := ParseFS(fsys, "a.conf", Options{Include: "include", AllErrors: true})
+	var list ErrorList
+	if !errors.As(err, &list) {
+		t.Fatalf("error = %v, want an ErrorList", err)
+	}
+	var got []string
+	for _, perr := range list {
+		got = append(got, perr.File+":"+perr.Msg)
+	}
+	want := []string{
+		"a.conf:unexpected '}' without matching '{'",
+		"b.conf:expected '}', got end of input",
+		"a.conf:cannot include missing.conf: file does not exist",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("errors:\n got: %q\nwant: %q", got, want)
+	}
+	if got, want := names(unit.Directives), []string{"a.conf:x", "b.conf:z", "a.conf:y"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("directives = %q, want %q", got, want)
+	}
+}
+
+func TestDecodeError_File(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.conf":  {Data: []byte("include db.conf\n")},
+		"db.conf": {Data: []byte("port abc\n")},
+	}
+	unit, err := ParseFS(fsys, "a.conf", Options{Include: "include"})
+	if err != nil {
+		t.Fatalf("ParseFS error: %v", err)
+	}
+	var cfg struct {
+		Port int `conf:"port"`
+	}
+	err = Decode(unit, &cfg)
+	var derr *DecodeError
+	if !errors.As(err, &derr) || derr.File != "db.conf" || derr.Line != 1 || derr.Column != 6 {
+		t.Fatalf("error = %#v, want a *DecodeError at db.conf:1:6", err)
+	}
+}
@@ -0,0 +1,195 @@
+package confetti
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseINI reads an INI file into a ConfigurationUnit: the keys before the
+// first section become top-level directives, and each section a block of
+// the same name, or of the name and inline argument SUB for a section
+// written [name "SUB"] as in Git configuration files. "key = value" and
+// "key: value" become directives with one argument, the value with
+// surrounding whitespace removed, or the text between the quotes if it is
+// quoted, and a key alone a directive without arguments.
+//
+// Lines starting with ; or # are comments, reported as losses. A section
+// header that is not closed, or a name or value holding a forbidden
+// character, is reported as a *ParseError.
+func ParseINI(input string) (*ConfigurationUnit, []Loss, error) {
+	im := &importer{}
+	cf := &ConfigurationUnit{Directives: []Directive{}}
+	dirs := &cf.Directives
+	for i, line := range strings.Split(strings.ReplaceAll(input, "\r\n", "\n"), "\n") {
+		num := i + 1
+		text := strings.TrimSpace(line)
+		column := len(line) - len(strings.TrimLeft(line, " \t")) + 1
+		switch {
+		case text == "":
+		case text[0] == ';' || text[0] == '#':
+			im.comment(num)
+		case text[0] == '[':
+			if !strings.HasSuffix(text, "]") {
+				return nil, nil, &ParseError{Line: num, Column: column, Msg: "section header is not closed"}
+			}
+			args := iniSection(strings.TrimSpace(text[1 : len(text)-1]))
+			if msg := forbiddenIn(args); msg != "" {
+				return nil, nil, &ParseError{Line: num, Column: column, Msg: msg}
+			}
+			cf.Directives = append(cf.Directives, Directive{Arguments: args, Subdirectives: []Directive{}})
+			dirs = &cf.Directives[len(cf.Directives)-1].Subdirectives
+		default:
+			key, value, ok := strings.Cut(text, "=")
+			if k, v, colon := strings.Cut(text, ":"); colon && (!ok || len(k) < len(key)) {
+				key, value, ok = k, v, true
+			}
+			d := Directive{Arguments: []string{strings.TrimSpace(key)}}
+			if ok {
+				d.Arguments = append(d.Arguments, iniValue(strings.TrimSpace(value)))
+			}
+			if msg := forbiddenIn(d.Arguments); msg != "" {
+				return nil, nil, &ParseError{Line: num, Column: column, Msg: msg}
+			}
+			*dirs = append(*dirs, d)
+		}
+	}
+	return cf, im.report(), nil
+}
+
+// iniSection returns the arguments for the section header name.
+func iniSection(name string) []string {
+	if i := strings.IndexAny(name, " \t"); i > 0 {
+		sub := strings.TrimSpace(name[i:])
+		if len(sub) >= 2 && sub[0] == '"' && sub[len(sub)-1] == '"' {
+			return []string{name[:i], iniValue(sub)}
+		}
+	}
+	return []string{name}
+}
+
+// iniValue returns the value v with its quotes removed and, for double
+// quotes, its escape sequences replaced.
+func iniValue(v string) string {
+	if len(v) < 2 || v[0] != v[len(v)-1] {
+		return v
+	}
+	switch v[0] {
+	case '\'':
+		return v[1 : len(v)-1]
+	case '"':
+		var sb strings.Builder
+		inner := v[1 : len(v)-1]
+		for i := 0; i < len(inner); i++ {
+			if inner[i] == '\\' {
+				if r, n, ok := unescape(inner[i+1:]); ok {
+					sb.WriteRune(r)
+					i += n
+					continue
+				}
+			}
+			sb.WriteByte(inner[i])
+		}
+		return sb.String()
+	}
+	return v
+}
+
+// MarshalINI returns the INI encoding of cf: directives without a block
+// become "key = value" lines, written before the sections if they are at the
+// top level, and blocks become sections, written [name "SUB"] for a block
+// with one inline argument. Values are quoted when they would not read back
+// as the same text.
+//
+// The losses report the directives that could not be mapped exactly:
+// directives with several arguments, written as one value, blocks with
+// several inline arguments, top-level directives that follow a block,
+// nested blocks, written as sections named after their path, and names
+// that cannot be written as keys.
+func MarshalINI(cf *ConfigurationUnit) ([]byte, []Loss, error) {
+	ex := &exporter{}
+	var sb strings.Builder
+	var blocks []Directive
+	for _, d := range cf.Directives {
+		if len(d.Arguments) == 0 {
+			continue
+		}
+		if d.Subdirectives != nil || d.HasBlock() {
+			blocks = append(blocks, d)
+			continue
+		}
+		if len(blocks) > 0 {
+			ex.lose(d.Span.Start.Line, "%s: moved before the sections", d.Arguments[0])
+		}
+		writeINIKey(&sb, ex, d)
+	}
+	for _, d := range blocks {
+		writeINISection(&sb, ex, d, nil)
+	}
+	return []byte(sb.String()), ex.report(), nil
+}
+
+// writeINISection writes the block d as a section, followed by the sections
+// for its nested blocks. path holds the arguments of the enclosing blocks.
+func writeINISection(sb *strings.Builder, ex *exporter, d Directive, path []string) {
+	line := d.Span.Start.Line
+	if sb.Len() > 0 {
+		sb.WriteByte('\n')
+	}
+	switch {
+	case len(path) > 0:
+		path = append(path[:len(path):len(path)], d.Arguments...)
+		name := strings.Join(path, ".")
+		ex.lose(line, "%s: nested block written as section [%s]", d.Arguments[0], name)
+		fmt.Fprintf(sb, "[%s]\n", name)
+	case len(d.Arguments) == 1:
+		path = d.Arguments
+		fmt.Fprintf(sb, "[%s]\n", d.Arguments[0])
+	default:
+		path = d.Arguments
+		if len(d.Arguments) > 2 {
+			ex.lose(line, "%s: inline arguments joined", d.Arguments[0])
+		}
+		fmt.Fprintf(sb, "[%s %s]\n", d.Arguments[0], quoteEscaped(strings.Join(d.Arguments[1:], " ")))
+	}
+
+	var nested []Directive
+	for _, sub := range d.Subdirectives {
+		if len(sub.Arguments) == 0 {
+			continue
+		}
+		if sub.Subdirectives != nil || sub.HasBlock() {
+			nested = append(nested, sub)
+			continue
+		}
+		writeINIKey(sb, ex, sub)
+	}
+	for _, sub := range nested {
+		writeINISection(sb, ex, sub, path)
+	}
+}
+
+// writeINIKey writes the directive d without a block as a key/value line.
+func writeINIKey(sb *strings.Builder, ex *exporter, d Directive) {
+	key, args := d.Arguments[0], d.Arguments[1:]
+	line := d.Span.Start.Line
+	if key == "" || key != strings.TrimSpace(key) || strings.ContainsAny(key, "=:\n\r") || strings.ContainsRune("[;#", rune(key[0])) {
+		ex.lose(line, "%q: name cannot be written as a key, dropped", key)
+		return
+	}
+	if len(args) == 0 {
+		fmt.Fprintf(sb, "%s\n", key)
+		return
+	}
+	if len(args) > 1 {
+		ex.lose(line, "%s: arguments joined into one value", key)
+	}
+	fmt.Fprintf(sb, "%s = %s\n", key, iniQuote(strings.Join(args, " ")))
+}
+
+// iniQuote returns v quoted if it would not read back as the same text.
+func iniQuote(v string) string {
+	if v == "" || v != strings.TrimSpace(v) || strings.ContainsAny(v, "\"';#\\\n\r\t") {
+		return quoteEscaped(v)
+	}
+	return v
+}
@@ -0,0 +1,135 @@
+package confetti
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseINI(t *testing.T) {
+	src := `; settings
+name = demo
+flag
+empty =
+url: http://example.com:8080/?a=b
+
+[server]
+port = 8080
+  path = "C:\\dir ; x"
+lit = 'a "b"'
+# repeated keys are kept
+listen = 80
+listen = 443
+
+[remote "origin"]
+url = git@example.com:repo.git
+`
+	cf, losses, err := ParseINI(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Marshal(cf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `name demo
+flag
+empty ""
+url http://example.com:8080/?a=b
+server {
+    port 8080
+    path "C:\\dir ; x"
+    lit "a \"b\""
+    listen 80
+    listen 443
+}
+remote origin {
+    url git@example.com:repo.git
+}
+`
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if want := []Loss{{Line: 1, Msg: "2 comments dropped"}}; !reflect.DeepEqual(losses, want) {
+		t.Errorf("losses %v, want %v", losses, want)
+	}
+
+	_, _, err = ParseINI("a = 1\n  [section\n")
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.Line != 2 || perr.Column != 3 {
+		t.Errorf("unclosed section: got %v", err)
+	}
+	for _, src := range []string{"a = 1\n b = x\x01\n", "a = 1\n b = \"\\u0001\"\n", "a = 1\n [s \"\x01\"]\n"} {
+		_, _, err = ParseINI(src)
+		if !errors.As(err, &perr) || perr.Line != 2 || perr.Column != 2 || !strings.Contains(perr.Msg, "forbidden character U+0001") {
+			t.Errorf("%q: got %v, want a forbidden character at 2:2", src, err)
+		}
+	}
+}
+
+func TestMarshalINI(t *testing.T) {
+	cf, err := Parse(`name demo
+server {
+    port 8080
+    path "C:\\dir ; x"
+    hosts a b
+    flag
+    tls {
+        cert a.pem
+    }
+}
+remote origin { url "git@example.com:repo.git" }
+late 1
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, losses, err := MarshalINI(cf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `name = demo
+late = 1
+
+[server]
+port = 8080
+path = "C:\\dir ; x"
+hosts = a b
+flag
+
+[server.tls]
+cert = a.pem
+
+[remote "origin"]
+url = git@example.com:repo.git
+`
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	wantLosses := []Loss{
+		{Line: 5, Msg: "hosts: arguments joined into one value"},
+		{Line: 7, Msg: "tls: nested block written as section [server.tls]"},
+		{Line: 12, Msg: "late: moved before the sections"},
+	}
+	if !reflect.DeepEqual(losses, wantLosses) {
+		t.Errorf("losses %v, want %v", losses, wantLosses)
+	}
+
+	// what MarshalINI writes without losses reads back the same
+	cf, err = Parse("a 1\nb \" x \"\ns {\n    c \"\"\n    d\n}\nt u {\n    e \"1;2\"\n}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ini, losses, err := MarshalINI(cf)
+	if err != nil || len(losses) > 0 {
+		t.Fatalf("MarshalINI: %v, %v", losses, err)
+	}
+	back, _, err := ParseINI(string(ini))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.String() != cf.String() {
+		t.Errorf("round trip through\n%s\ngot:\n%s\nwant:\n%s", ini, back, cf)
+	}
+}
@@ -0,0 +1,205 @@
+package confetti
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrUndefinedVariable is wrapped by the *ParseError reported by Interpolate
+// for a ${NAME} substitution that has no value and no default.
+var ErrUndefinedVariable = errors.New("undefined variable")
+
+// ErrReferenceCycle is wrapped by the *ParseError reported by Interpolate
+// for a directive whose value refers back to itself.
+var ErrReferenceCycle = errors.New("reference cycle")
+
+// InterpolateOptions configures Interpolate.
+type InterpolateOptions struct {
+	// Lookup returns the value of a variable and whether it is set. If nil,
+	// variables are looked up in the environment with os.LookupEnv.
+	Lookup func(name string) (string, bool)
+
+	// NoReferences disables references to other directives, so that every
+	// name is passed to Lookup.
+	NoReferences bool
+}
+
+// Interpolate returns a copy of unit with substitutions made in the
+// arguments of its directives, other than their names:
+//
+//	${NAME}           the value of NAME
+//	${NAME:-default}  the value of NAME, or default if NAME is unset or empty
+//	$$                a literal $
+//
+// A $ not followed by { or $ is kept as is. The default may itself contain
+// substitutions. Since braces are reserved in Confetti, an argument holding
+// a substitution must be quoted, as in password "${DB_PASSWORD}", or have
+// its braces escaped.
+//
+// NAME is first resolved as a reference to another directive: a path of
+// directive names separated by dots, starting at the top level, such as
+// ${database.host}, which refers to the directive [ConfigurationUnit.Find]
+// returns for that path. A reference's value is that directive's arguments
+// after its name, themselves interpolated, joined by spaces. Names that
+// match no directive are passed to the Lookup function, which reads the
+// environment by default.
+//
+// Every undefined variable, reference cycle and unterminated ${ is reported
+// as a *ParseError at the position of its argument, together in an
+// ErrorList sorted by position; the returned unit then keeps the
+// substitutions in error as written.
+func Interpolate(unit *ConfigurationUnit, opts InterpolateOptions) (*ConfigurationUnit, error) {
+	in := &interpolator{
+		root:   unit.Directives,
+		opts:   opts,
+		values: make(map[interpolatedArg]string),
+		active: make(map[*Directive]bool),
+	}
+	if in.opts.Lookup == nil {
+		in.opts.Lookup = os.LookupEnv
+	}
+	res := &ConfigurationUnit{Directives: in.directives(unit.Directives)}
+	in.errors.Sort()
+	return res, in.errors.Err()
+}
+
+// interpolator holds the state of an Interpolate call.
+type interpolator struct {
+	root   []Directive
+	opts   InterpolateOptions
+	values map[interpolatedArg]string // arguments interpolated so far
+	active map[*Directive]bool        // directives with an argument being interpolated
+	errors ErrorList
+}
+
+// interpolatedArg identifies argument i of a directive of the original unit.
+type interpolatedArg struct {
+	d *Directive
+	i int
+}
+
+// directives returns a copy of dirs with their arguments interpolated.
+func (in *interpolator) directives(dirs []Directive) []Directive {
+	if dirs == nil {
+		return nil
+	}
+	res := make([]Directive, len(dirs))
+	for i := range dirs {
+		d := &dirs[i]
+		res[i] = *d
+		res[i].Arguments = make([]string, len(d.Arguments))
+		for j := range d.Arguments {
+			res[i].Arguments[j] = in.argument(d, j)
+		}
+		res[i].Subdirectives = in.directives(d.Subdirectives)
+	}
+	return res
+}
+
+// argument returns argument i of d, interpolated unless it is the name.
+func (in *interpolator) argument(d *Directive, i int) string {
+	if i == 0 {
+		return d.Arguments[0]
+	}
+	key := interpolatedArg{d, i}
+	if v, ok := in.values[key]; ok {
+		return v
+	}
+	active := in.active[d]
+	in.active[d] = true
+	v := in.expand(d.Arguments[i], d, i)
+	in.active[d] = active
+	in.values[key] = v
+	return v
+}
+
+// expand makes the substitutions in s, found in argument i of d.
+func (in *interpolator) expand(s string, d *Directive, i int) string {
+	var sb strings.Builder
+	for j := 0; j < len(s); {
+		if s[j] != '$' || j+1 == len(s) || (s[j+1] != '$' && s[j+1] != '{') {
+			sb.WriteByte(s[j])
+			j++
+			continue
+		}
+		if s[j+1] == '$' {
+			sb.WriteByte('$')
+			j += 2
+			continue
+		}
+
+		end := closingBrace(s, j+2)
+		if end < 0 {
+			in.errorAt(d, i, nil, "unterminated ${")
+			sb.WriteString(s[j:])
+			break
+		}
+		name, def, hasDefault := strings.Cut(s[j+2:end], ":-")
+		v, ok := in.lookup(name, d, i)
+		switch {
+		case hasDefault && (!ok || v == ""):
+			v = in.expand(def, d, i)
+		case !ok:
+			if name == "" {
+				in.errorAt(d, i, nil, "empty variable name in ${}")
+			} else {
+				in.errorAt(d, i, ErrUndefinedVariable, "undefined variable %q", name)
+			}
+			v = s[j : end+1]
+		}
+		sb.WriteString(v)
+		j = end + 1
+	}
+	return sb.String()
+}
+
+// closingBrace returns the index of the '}' closing the substitution whose
+// contents start at s[start], or -1.
+func closingBrace(s string, start int) int {
+	depth := 0
+	for j := start; j < len(s); j++ {
+		switch s[j] {
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return j
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// lookup returns the value of name, substituted in argument i of d, and
+// whether it is defined.
+func (in *interpolator) lookup(name string, d *Directive, i int) (string, bool) {
+	if name == "" {
+		return "", false
+	}
+	if !in.opts.NoReferences {
+		if ref := findPath(in.root, strings.Split(name, ".")); ref != nil {
+			if in.active[ref] {
+				in.errorAt(d, i, ErrReferenceCycle, "reference cycle through %q", name)
+				return "", true
+			}
+			args := make([]string, 0, len(ref.Arguments))
+			for k := 1; k < len(ref.Arguments); k++ {
+				args = append(args, in.argument(ref, k))
+			}
+			return strings.Join(args, " "), true
+		}
+	}
+	return in.opts.Lookup(name)
+}
+
+// errorAt records an error in argument i of d, at the argument's position.
+func (in *interpolator) errorAt(d *Directive, i int, err error, format string, args ...any) {
+	perr := &ParseError{File: d.File, Msg: fmt.Sprintf(format, args...), Err: err}
+	if i < len(d.ArgSpans) {
+		perr.Line, perr.Column = d.ArgSpans[i].Start.Line, d.ArgSpans[i].Start.Column
+	}
+	in.errors = append(in.errors, perr)
+}
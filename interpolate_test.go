@@ -0,0 +1,132 @@
+package confetti
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func lookupMap(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	src := `host db.local
+port 5432
+database {
+    url "postgres://${host}:${port}/${database.name}"
+    name app
+    password "${DB_PASSWORD}"
+    user "${DB_USER:-admin}" "${EMPTY:-none}" "${DB_USER:-${host}}"
+}
+price $$5 $ cost$ "${}x$$"
+`
+	unit, err := Parse(src)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	vars := map[string]string{"DB_PASSWORD": "s3cret", "EMPTY": "", "host": "ignored"}
+	got, err := Interpolate(unit, InterpolateOptions{Lookup: lookupMap(vars)})
+	var list ErrorList
+	if !errors.As(err, &list) || len(list) != 1 || list[0].Msg != "empty variable name in ${}" {
+		t.Fatalf("error = %v, want only the empty name", err)
+	}
+
+	db := got.Directives[2].Subdirectives
+	want := [][]string{
+		{"url", "postgres://db.local:5432/app"},
+		{"name", "app"},
+		{"password", "s3cret"},
+		{"user", "admin", "none", "db.local"},
+	}
+	for i, w := range want {
+		if !reflect.DeepEqual(db[i].Arguments, w) {
+			t.Errorf("directive %d = %q, want %q", i, db[i].Arguments, w)
+		}
+	}
+	if got, want := got.Directives[3].Arguments, []string{"price", "$5", "$", "cost$", "${}x$"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("escapes = %q, want %q", got, want)
+	}
+
+	// the original is left unchanged, positions are kept
+	if unit.Directives[2].Subdirectives[2].Arguments[1] != "${DB_PASSWORD}" {
+		t.Errorf("Interpolate modified its input")
+	}
+	if got.Directives[2].Subdirectives[2].ArgSpans[1] != unit.Directives[2].Subdirectives[2].ArgSpans[1] {
+		t.Errorf("Interpolate lost argument spans")
+	}
+}
+
+func TestInterpolate_Errors(t *testing.T) {
+	src := "a \"${UNSET}\"\nb \"x ${a} ${MISSING}\" $\\{b\\}\nc pre$\\{c\\}\nd \"${open\"\ne x$\\{f\\}\nf \"${e}\"\n"
+	unit, err := Parse(src)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	got, err := Interpolate(unit, InterpolateOptions{Lookup: lookupMap(nil)})
+	var list ErrorList
+	if !errors.As(err, &list) {
+		t.Fatalf("error = %v, want an ErrorList", err)
+	}
+	type result struct {
+		line, col int
+		msg       string
+		err       error
+	}
+	var results []result
+	for _, perr := range list {
+		results = append(results, result{perr.Line, perr.Column, perr.Msg, perr.Err})
+	}
+	want := []result{
+		{1, 3, `undefined variable "UNSET"`, ErrUndefinedVariable},
+		{2, 3, `undefined variable "MISSING"`, ErrUndefinedVariable},
+		{2, 23, `reference cycle through "b"`, ErrReferenceCycle},
+		{3, 3, `reference cycle through "c"`, ErrReferenceCycle},
+		{4, 3, "unterminated ${", nil},
+		{6, 3, `reference cycle through "e"`, ErrReferenceCycle},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("errors:\n got: %v\nwant: %v", results, want)
+	}
+	if got, want := got.Directives[0].Arguments[1], "${UNSET}"; got != want {
+		t.Errorf("undefined variable expanded to %q, want %q", got, want)
+	}
+	if !errors.Is(err, ErrUndefinedVariable) {
+		t.Errorf("errors.Is(err, ErrUndefinedVariable) = false")
+	}
+}
+
+func TestInterpolate_NoReferences(t *testing.T) {
+	unit, err := Parse("host a\nurl \"${host}\"\n")
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	got, err := Interpolate(unit, InterpolateOptions{Lookup: lookupMap(map[string]string{"host": "b"}), NoReferences: true})
+	if err != nil {
+		t.Fatalf("Interpolate error: %v", err)
+	}
+	if v := got.Directives[1].Arguments[1]; v != "b" {
+		t.Errorf("url = %q, want b", v)
+	}
+}
+
+func TestDecode_Interpolate(t *testing.T) {
+	t.Setenv("CONFETTI_TEST_PORT", "8080")
+	unit, err := Parse("port \"${CONFETTI_TEST_PORT}\"\nhost \"${CONFETTI_TEST_UNSET:-localhost}\"\n")
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	var cfg struct {
+		Port int    `conf:"port"`
+		Host string `conf:"host"`
+	}
+	if err := DecodeWithOptions(unit, &cfg, DecodeOptions{Interpolate: &InterpolateOptions{}}); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if cfg.Port != 8080 || cfg.Host != "localhost" {
+		t.Errorf("got %+v", cfg)
+	}
+}
@@ -0,0 +1,190 @@
+package confetti
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// jsonUnit is the JSON form of a ConfigurationUnit.
+type jsonUnit struct {
+	Directives []Directive `json:"directives"`
+}
+
+// jsonDirective is the JSON form of a Directive. A nil Subdirectives marks
+// a directive without a block; a pointer to an empty slice, an empty block.
+type jsonDirective struct {
+	Arguments     []string     `json:"arguments"`
+	Subdirectives *[]Directive `json:"subdirectives,omitempty"`
+}
+
+// MarshalJSON encodes the document losslessly as an object with a
+// "directives" array, each directive being encoded as Directive.MarshalJSON
+// does:
+//
+//	{"directives": [
+//	  {"arguments": ["port", "8080"]},
+//	  {"arguments": ["server", "api"], "subdirectives": [
+//	    {"arguments": ["timeout", "30s"]}
+//	  ]}
+//	]}
+//
+// UnmarshalJSON reads it back into an equivalent document.
+func (cf ConfigurationUnit) MarshalJSON() ([]byte, error) {
+	dirs := cf.Directives
+	if dirs == nil {
+		dirs = []Directive{}
+	}
+	return json.Marshal(jsonUnit{Directives: dirs})
+}
+
+// UnmarshalJSON decodes a document encoded by MarshalJSON.
+func (cf *ConfigurationUnit) UnmarshalJSON(data []byte) error {
+	var u jsonUnit
+	if err := json.Unmarshal(data, &u); err != nil {
+		return err
+	}
+	cf.Directives = u.Directives
+	return nil
+}
+
+// MarshalJSON encodes the directive as an object with an "arguments" array,
+// the name first, and, if the directive has a block, a "subdirectives"
+// array, empty for an empty block. Source positions are not encoded.
+func (d Directive) MarshalJSON() ([]byte, error) {
+	if len(d.Arguments) == 0 {
+		return nil, fmt.Errorf("confetti: directive must have at least one argument")
+	}
+	jd := jsonDirective{Arguments: d.Arguments}
+	if d.Subdirectives != nil || d.HasBlock() {
+		subs := d.Subdirectives
+		if subs == nil {
+			subs = []Directive{}
+		}
+		jd.Subdirectives = &subs
+	}
+	return json.Marshal(jd)
+}
+
+// UnmarshalJSON decodes a directive encoded by MarshalJSON. A directive with
+// an empty block gets a non-nil, empty Subdirectives, which Marshal writes
+// as {}. Arguments holding characters that Confetti forbids are rejected.
+func (d *Directive) UnmarshalJSON(data []byte) error {
+	var jd jsonDirective
+	if err := json.Unmarshal(data, &jd); err != nil {
+		return err
+	}
+	if len(jd.Arguments) == 0 {
+		return fmt.Errorf("confetti: directive must have at least one argument")
+	}
+	for _, arg := range jd.Arguments {
+		for _, r := range arg {
+			if IsForbidden(r) {
+				return fmt.Errorf("confetti: argument %q: forbidden character %U", arg, r)
+			}
+		}
+	}
+	*d = Directive{Arguments: jd.Arguments}
+	if jd.Subdirectives != nil {
+		d.Subdirectives = *jd.Subdirectives
+	}
+	return nil
+}
+
+// Object returns a projection of the document meant for reading rather than
+// round-tripping, which maps directive names to their values:
+//
+//   - a directive without arguments after its name maps to nil, one with a
+//     single argument to that string, and one with more to a []any of
+//     strings;
+//   - a directive with a block maps to a map[string]any of its block, nested
+//     under one key per inline argument, so that server api { port 80 }
+//     gives {"server": {"api": {"port": "80"}}};
+//   - the values of directives repeated at one level are merged if they are
+//     all blocks whose keys do not clash, as with server api { } and
+//     server web { }, and collected into a []any otherwise.
+//
+// Arguments stay strings, and the order of directives with different names
+// is lost. Encoded with encoding/json, the result is the "object" form
+// printed by confetti convert.
+func (cf *ConfigurationUnit) Object() map[string]any {
+	return objectOf(cf.Directives)
+}
+
+// objectOf returns the projection of dirs described in Object.
+func objectOf(dirs []Directive) map[string]any {
+	var names []string
+	values := make(map[string][]any)
+	for _, d := range dirs {
+		if len(d.Arguments) == 0 {
+			continue
+		}
+		name := d.Arguments[0]
+		if _, ok := values[name]; !ok {
+			names = append(names, name)
+		}
+		values[name] = append(values[name], objectValue(d))
+	}
+
+	res := make(map[string]any, len(names))
+	for _, name := range names {
+		vs := values[name]
+		if len(vs) == 1 {
+			res[name] = vs[0]
+			continue
+		}
+		if merged, ok := mergeObjects(vs); ok {
+			res[name] = merged
+			continue
+		}
+		res[name] = vs
+	}
+	return res
+}
+
+// objectValue returns the value of d in the projection described in Object.
+func objectValue(d Directive) any {
+	args := d.Arguments[1:]
+	if !d.HasBlock() && d.Subdirectives == nil {
+		switch len(args) {
+		case 0:
+			return nil
+		case 1:
+			return args[0]
+		}
+		res := make([]any, len(args))
+		for i, arg := range args {
+			res[i] = arg
+		}
+		return res
+	}
+	var res any = objectOf(d.Subdirectives)
+	for i := len(args) - 1; i >= 0; i-- {
+		res = map[string]any{args[i]: res}
+	}
+	return res
+}
+
+// mergeObjects merges values into one map if they are all maps and no key
+// holds a non-map value in two of them.
+func mergeObjects(values []any) (map[string]any, bool) {
+	res := make(map[string]any)
+	for _, v := range values {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		for k, mv := range m {
+			prev, ok := res[k]
+			if !ok {
+				res[k] = mv
+				continue
+			}
+			merged, ok := mergeObjects([]any{prev, mv})
+			if !ok {
+				return nil, false
+			}
+			res[k] = merged
+		}
+	}
+	return res, true
+}
@@ -0,0 +1,134 @@
+package confetti
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	cfg, err := Parse("port 8080\nflag\nserver api {\n    timeout \"30 s\"\n}\nempty {}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"directives":[` +
+		`{"arguments":["port","8080"]},` +
+		`{"arguments":["flag"]},` +
+		`{"arguments":["server","api"],"subdirectives":[{"arguments":["timeout","30 s"]}]},` +
+		`{"arguments":["empty"],"subdirectives":[]}]}`
+	if string(got) != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+
+	var back ConfigurationUnit
+	if err := json.Unmarshal(got, &back); err != nil {
+		t.Fatal(err)
+	}
+	if back.String() != cfg.String() {
+		t.Errorf("round trip:\n%s\nwant:\n%s", back.String(), cfg.String())
+	}
+	text, err := Marshal(&back)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "port 8080\nflag\nserver api {\n    timeout \"30 s\"\n}\nempty {}\n"; string(text) != want {
+		t.Errorf("Marshal after round trip:\n%s\nwant:\n%s", text, want)
+	}
+
+	if got, err := json.Marshal(ConfigurationUnit{}); err != nil || string(got) != `{"directives":[]}` {
+		t.Errorf("empty unit: %s, %v", got, err)
+	}
+	if _, err := json.Marshal(Directive{}); err == nil {
+		t.Error("directive without arguments: expected an error")
+	}
+}
+
+func TestUnmarshalJSON_Invalid(t *testing.T) {
+	for _, in := range []string{
+		`{"directives":[{"arguments":[]}]}`,
+		`{"directives":[{"subdirectives":[]}]}`,
+		`{"directives":[{"arguments":["a"],"subdirectives":[{"arguments":null}]}]}`,
+		`{"directives":[{"arguments":"a"}]}`,
+		`{"directives":[{"arguments":["a\u0000b"]}]}`,
+		`{"directives":[{"arguments":["a"],"subdirectives":[{"arguments":["b","x\u0007"]}]}]}`,
+	} {
+		var cfg ConfigurationUnit
+		if err := json.Unmarshal([]byte(in), &cfg); err == nil {
+			t.Errorf("%s: expected an error", in)
+		}
+	}
+}
+
+func TestUnmarshalJSON_Arguments(t *testing.T) {
+	var cfg ConfigurationUnit
+	err := json.Unmarshal([]byte(`{"directives":[{"arguments":["x\u0007"]}]}`), &cfg)
+	if want := `confetti: argument "x\a": forbidden character U+0007`; err == nil || err.Error() != want {
+		t.Fatalf("error = %v, want %s", err, want)
+	}
+
+	// whitespace, line breaks and format characters are allowed
+	in := `{"directives":[{"arguments":["a","b c\n\td","\u200b"]}]}`
+	if err := json.Unmarshal([]byte(in), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Marshal(&cfg); err != nil {
+		t.Errorf("Marshal: %v", err)
+	}
+}
+
+func TestObject(t *testing.T) {
+	cfg, err := Parse(`port 8080
+flag
+tags a b
+server api { port 80 }
+server web {
+    port 81
+    tls { cert a.pem }
+}
+route GET /x { to api }
+route GET /y { to web }
+log { level info }
+log { level debug }
+plugin a
+plugin b c
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"port": "8080",
+		"flag": nil,
+		"tags": []any{"a", "b"},
+		"server": map[string]any{
+			"api": map[string]any{"port": "80"},
+			"web": map[string]any{"port": "81", "tls": map[string]any{"cert": "a.pem"}},
+		},
+		"route": map[string]any{"GET": map[string]any{
+			"/x": map[string]any{"to": "api"},
+			"/y": map[string]any{"to": "web"},
+		}},
+		"log": []any{
+			map[string]any{"level": "info"},
+			map[string]any{"level": "debug"},
+		},
+		"plugin": []any{"a", []any{"b", "c"}},
+	}
+	got := cfg.Object()
+	if !reflect.DeepEqual(got, want) {
+		g, _ := json.MarshalIndent(got, "", "  ")
+		t.Fatalf("got:\n%s", g)
+	}
+
+	b, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"flag":null`) {
+		t.Errorf("JSON form: %s", b)
+	}
+}
@@ -1,7 +1,9 @@
 package confetti
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"sort"
 	"strings"
 	"unicode/utf8"
@@ -9,14 +11,28 @@ import (
 
 // Lexer tokenizes Confetti source text
 type Lexer struct {
-	input        string
+	input        string // source text from offset base on; all of it unless reading from r
+	base         int
 	pos          int
 	line         int
 	column       int
 	opts         Options
 	sortedPuncts []string // PunctuatorArguments sorted by length descending (maximal munch)
+
+	r         io.Reader // source of further input, nil when lexing a string
+	readErr   error     // error other than io.EOF returned by r
+	mark      int       // offset of the token being scanned; input before it may be discarded
+	truncated bool      // input was cut at Limits.MaxInputBytes
 }
 
+// minRead is the smallest amount of input a reader-backed Lexer reads at once.
+const minRead = 4096
+
+// malformedRune is returned by peek for a byte that does not start a valid
+// UTF-8 sequence. It is a forbidden character, so every scanning loop stops
+// at it; errf then reports the error as malformed UTF-8.
+const malformedRune = 0xFFFF
+
 // NewLexer creates a new lexer with no extensions enabled.
 func NewLexer(input string) *Lexer {
 	return NewLexerWithOptions(input, Options{})
@@ -31,6 +47,7 @@ func NewLexerWithOptions(input string, opts Options) *Lexer {
 		column: 1,
 		opts:   opts,
 	}
+	l.truncate()
 	if len(opts.PunctuatorArguments) > 0 {
 		l.sortedPuncts = make([]string, len(opts.PunctuatorArguments))
 		copy(l.sortedPuncts, opts.PunctuatorArguments)
@@ -41,9 +58,26 @@ func NewLexerWithOptions(input string, opts Options) *Lexer {
 	return l
 }
 
-// errf returns a *ParseError at the lexer's current position.
+// NewLexerFromReader creates a lexer that reads its input from r as it goes,
+// instead of requiring the whole document up front. Tokens and errors, and
+// their positions, are the same as for the string-based lexer; errors
+// reading from r are returned as is.
+func NewLexerFromReader(r io.Reader, opts Options) *Lexer {
+	l := NewLexerWithOptions("", opts)
+	l.r = r
+	return l
+}
+
+// errf returns a *ParseError at the lexer's current position. Errors raised
+// at a malformed UTF-8 sequence are reported as such.
 func (l *Lexer) errf(format string, args ...any) error {
-	return &ParseError{Line: l.line, Column: l.column, Msg: fmt.Sprintf(format, args...)}
+	msg := fmt.Sprintf(format, args...)
+	if l.more() {
+		if r, size := utf8.DecodeRuneInString(l.rest()); r == utf8.RuneError && size == 1 {
+			msg = "malformed UTF-8"
+		}
+	}
+	return &ParseError{Line: l.line, Column: l.column, Msg: msg}
 }
 
 // errAt returns a *ParseError at the given position.
@@ -53,20 +87,91 @@ func (l *Lexer) errAt(line, column int, format string, args ...any) error {
 
 // NextToken returns the next token
 func (l *Lexer) NextToken() (Token, error) {
-	// check for malformed UTF-8 on first call
-	if l.pos == 0 {
-		if !ValidateUTF8(l.input) {
-			return Token{}, l.errf("malformed UTF-8")
+	l.mark = l.pos
+	tok, err := l.nextToken()
+	if l.readErr != nil {
+		return Token{}, l.readErr
+	}
+	// reaching the cut made for MaxInputBytes, the input is too large,
+	// whatever the token or error scanned from what came before
+	if l.truncated && (err == nil && tok.Type == TokenEOF || err != nil && !utf8.FullRuneInString(l.rest())) {
+		return Token{}, limitError(l.position(), ErrInputTooLarge, l.opts.Limits.MaxInputBytes)
+	}
+	if err != nil {
+		return Token{}, err
+	}
+	if max := l.opts.Limits.MaxArgumentBytes; max > 0 && tok.Type == TokenArgument && len(tok.Value) > max {
+		return Token{}, limitError(tok.Pos(), ErrArgumentTooLong, max)
+	}
+	tok.End = l.position()
+	return tok, nil
+}
+
+// truncate cuts the input at Limits.MaxInputBytes and stops reading.
+func (l *Lexer) truncate() {
+	max := l.opts.Limits.MaxInputBytes
+	if max > 0 && l.base+len(l.input) > max {
+		l.input = l.input[:max-l.base]
+		l.truncated = true
+		l.r = nil
+	}
+}
+
+// fill tries to make n bytes of input available from the current position
+// on, reading more from r if needed. It reports whether it succeeded; at the
+// end of input fewer bytes remain.
+func (l *Lexer) fill(n int) bool {
+	for l.pos-l.base+n > len(l.input) {
+		if l.r == nil || l.readErr != nil {
+			return false
+		}
+		// text before the current token is never looked at again
+		l.input = l.input[l.mark-l.base:]
+		l.base = l.mark
+
+		// read at least as much as is buffered, so that a long token is
+		// copied a logarithmic number of times
+		buf := make([]byte, max(minRead, len(l.input)))
+		k, err := io.ReadFull(l.r, buf)
+		l.input += string(buf[:k])
+		if l.truncate(); l.truncated {
+			continue
 		}
-		// skip BOM at the beginning of file
-		if len(l.input) >= 3 && l.input[0:3] == "\xEF\xBB\xBF" {
-			l.pos = 3
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+				l.readErr = err
+			}
+			l.r = nil
 		}
 	}
+	return true
+}
+
+// more reports whether any input remains.
+func (l *Lexer) more() bool {
+	return l.fill(1)
+}
+
+// rest returns the available input from the current position on.
+func (l *Lexer) rest() string {
+	return l.input[l.pos-l.base:]
+}
+
+// slice returns the input between two offsets within the current token.
+func (l *Lexer) slice(start, end int) string {
+	return l.input[start-l.base : end-l.base]
+}
+
+// nextToken scans the next token; NextToken fills in its end position.
+func (l *Lexer) nextToken() (Token, error) {
+	// skip BOM at the beginning of file
+	if l.pos == 0 && l.fill(3) && strings.HasPrefix(l.rest(), "\xEF\xBB\xBF") {
+		l.pos = 3
+	}
 
 	l.skipWhitespace()
 
-	if l.pos >= len(l.input) {
+	if !l.more() {
 		return l.makeToken(TokenEOF, ""), nil
 	}
 
@@ -74,7 +179,7 @@ func (l *Lexer) NextToken() (Token, error) {
 
 	// control-Z (SUB, 0x1A) after whitespace/at start of token is treated as EOF
 	if r == '\x1A' {
-		if l.pos+1 < len(l.input) {
+		if l.fill(2) {
 			return Token{}, l.errf("forbidden character")
 		}
 		return l.makeToken(TokenEOF, ""), nil
@@ -150,39 +255,68 @@ func (l *Lexer) NextToken() (Token, error) {
 	return Token{}, l.errf("unexpected character %q", r)
 }
 
+// resync discards input up to the next line terminator, semicolon or brace,
+// so that scanning can resume after an error.
+func (l *Lexer) resync() {
+	for l.more() {
+		r := l.peek()
+		if IsLineTerminator(r) || r == ';' || r == '{' || r == '}' {
+			return
+		}
+		l.advance()
+	}
+}
+
 func (l *Lexer) peek() rune {
-	if l.pos >= len(l.input) {
+	if !l.more() {
 		return 0
 	}
-	r, _ := utf8.DecodeRuneInString(l.input[l.pos:])
-	return r
+	l.fill(utf8.UTFMax)
+	return decodeRune(l.rest())
 }
 
 // peekSecond returns the rune after the current one without advancing.
 func (l *Lexer) peekSecond() rune {
-	if l.pos >= len(l.input) {
+	if !l.more() {
 		return 0
 	}
-	_, size := utf8.DecodeRuneInString(l.input[l.pos:])
-	if l.pos+size >= len(l.input) {
+	l.fill(2 * utf8.UTFMax)
+	_, size := utf8.DecodeRuneInString(l.rest())
+	if size >= len(l.rest()) {
 		return 0
 	}
-	r, _ := utf8.DecodeRuneInString(l.input[l.pos+size:])
+	return decodeRune(l.rest()[size:])
+}
+
+// decodeRune returns the first rune of s, or malformedRune if s does not
+// start with a valid UTF-8 sequence.
+func decodeRune(s string) rune {
+	r, size := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError && size == 1 {
+		return malformedRune
+	}
 	return r
 }
 
 func (l *Lexer) advance() rune {
-	if l.pos >= len(l.input) {
+	if !l.more() {
 		return 0
 	}
-	r, size := utf8.DecodeRuneInString(l.input[l.pos:])
+	l.fill(utf8.UTFMax)
+	r, size := utf8.DecodeRuneInString(l.rest())
 	l.pos += size
 	l.column++
 	return r
 }
 
+// hasPrefix reports whether the input at the current position starts with p.
+func (l *Lexer) hasPrefix(p string) bool {
+	l.fill(len(p))
+	return strings.HasPrefix(l.rest(), p)
+}
+
 func (l *Lexer) skipWhitespace() {
-	for l.pos < len(l.input) {
+	for l.more() {
 		r := l.peek()
 		if !IsWhitespace(r) {
 			break
@@ -191,12 +325,18 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
+// position returns the lexer's current position.
+func (l *Lexer) position() Position {
+	return Position{Offset: l.pos, Line: l.line, Column: l.column}
+}
+
 func (l *Lexer) makeToken(typ TokenType, value string) Token {
 	return Token{
 		Type:   typ,
 		Value:  value,
 		Line:   l.line,
 		Column: l.column,
+		Offset: l.pos,
 	}
 }
 
@@ -216,10 +356,11 @@ func (l *Lexer) scanNewline() (Token, error) {
 }
 
 func (l *Lexer) scanComment() (Token, error) {
+	tok := l.makeToken(TokenComment, "")
 	start := l.pos
 	l.advance() // skip '#'
 
-	for l.pos < len(l.input) {
+	for l.more() {
 		r := l.peek()
 		if IsLineTerminator(r) {
 			break
@@ -230,17 +371,18 @@ func (l *Lexer) scanComment() (Token, error) {
 		l.advance()
 	}
 
-	value := l.input[start:l.pos]
-	return l.makeToken(TokenComment, value), nil
+	tok.Value = l.slice(start, l.pos)
+	return tok, nil
 }
 
 // scanCStyleLineComment scans a // single-line comment (Annex A).
 func (l *Lexer) scanCStyleLineComment() (Token, error) {
+	tok := l.makeToken(TokenComment, "")
 	start := l.pos
 	l.advance() // skip first '/'
 	l.advance() // skip second '/'
 
-	for l.pos < len(l.input) {
+	for l.more() {
 		r := l.peek()
 		if IsLineTerminator(r) {
 			break
@@ -251,26 +393,26 @@ func (l *Lexer) scanCStyleLineComment() (Token, error) {
 		l.advance()
 	}
 
-	value := l.input[start:l.pos]
-	return l.makeToken(TokenComment, value), nil
+	tok.Value = l.slice(start, l.pos)
+	return tok, nil
 }
 
 // scanCStyleBlockComment scans a /* ... */ block comment (Annex A).
 func (l *Lexer) scanCStyleBlockComment() (Token, error) {
-	startLine, startCol := l.line, l.column
+	tok := l.makeToken(TokenComment, "")
 	start := l.pos
 	l.advance() // skip '/'
 	l.advance() // skip '*'
 
-	for l.pos < len(l.input) {
+	for l.more() {
 		r := l.peek()
 
 		// check for closing */
 		if r == '*' && l.peekSecond() == '/' {
 			l.advance() // skip '*'
 			l.advance() // skip '/'
-			value := l.input[start:l.pos]
-			return l.makeToken(TokenComment, value), nil
+			tok.Value = l.slice(start, l.pos)
+			return tok, nil
 		}
 
 		if IsForbidden(r) {
@@ -290,7 +432,7 @@ func (l *Lexer) scanCStyleBlockComment() (Token, error) {
 		l.advance()
 	}
 
-	return Token{}, l.errAt(startLine, startCol, "unterminated block comment")
+	return Token{}, l.errAt(tok.Line, tok.Column, "unterminated block comment")
 }
 
 // scanExpressionArgument scans a (expr) argument with balanced parentheses (Annex B).
@@ -301,7 +443,7 @@ func (l *Lexer) scanExpressionArgument() (Token, error) {
 	var buf strings.Builder
 	depth := 1
 
-	for l.pos < len(l.input) {
+	for l.more() {
 		r := l.peek()
 
 		if r == '(' {
@@ -348,7 +490,7 @@ func (l *Lexer) scanExpressionArgument() (Token, error) {
 // matchesPunctuator reports whether the current position starts a punctuator argument.
 func (l *Lexer) matchesPunctuator() bool {
 	for _, p := range l.sortedPuncts {
-		if strings.HasPrefix(l.input[l.pos:], p) {
+		if l.hasPrefix(p) {
 			return true
 		}
 	}
@@ -359,7 +501,7 @@ func (l *Lexer) matchesPunctuator() bool {
 func (l *Lexer) scanPunctuatorArgument() (Token, error) {
 	tok := l.makeToken(TokenArgument, "")
 	for _, punct := range l.sortedPuncts {
-		if strings.HasPrefix(l.input[l.pos:], punct) {
+		if l.hasPrefix(punct) {
 			tok.Value = punct
 			for range punct { // iterates once per rune
 				l.advance()
@@ -374,7 +516,7 @@ func (l *Lexer) scanSimpleArgument() (Token, error) {
 	var buf strings.Builder
 	tok := l.makeToken(TokenArgument, "")
 
-	for l.pos < len(l.input) {
+	for l.more() {
 		r := l.peek()
 
 		// escape sequence
@@ -394,7 +536,8 @@ func (l *Lexer) scanSimpleArgument() (Token, error) {
 				l.line++
 				l.column = 1
 				l.skipWhitespace()
-				return l.makeToken(TokenLineContinuation, ""), nil
+				tok.Type = TokenLineContinuation
+				return tok, nil
 			}
 
 			// escaped character
@@ -446,21 +589,22 @@ func (l *Lexer) scanQuotedArgument() (Token, error) {
 		l.advance()
 		if l.peek() == '"' {
 			l.advance()
-			return l.scanTripleQuoted()
+			return l.scanTripleQuoted(tok)
 		}
 		// empty single-quoted string
 		tok.Value = ""
 		return tok, nil
 	}
 
-	return l.scanSingleQuoted()
+	return l.scanSingleQuoted(tok)
 }
 
-func (l *Lexer) scanSingleQuoted() (Token, error) {
+// scanSingleQuoted scans the rest of a "..." argument whose opening quote
+// has been consumed; tok holds the position of that quote.
+func (l *Lexer) scanSingleQuoted(tok Token) (Token, error) {
 	var buf strings.Builder
-	tok := l.makeToken(TokenArgument, "")
 
-	for l.pos < len(l.input) {
+	for l.more() {
 		r := l.peek()
 
 		if r == '"' {
@@ -511,24 +655,21 @@ func (l *Lexer) scanSingleQuoted() (Token, error) {
 	return Token{}, l.errf("unterminated quoted string")
 }
 
-func (l *Lexer) scanTripleQuoted() (Token, error) {
+// scanTripleQuoted scans the rest of a """...""" argument whose opening
+// quotes have been consumed; tok holds the position of the first quote.
+func (l *Lexer) scanTripleQuoted(tok Token) (Token, error) {
 	var buf strings.Builder
-	tok := l.makeToken(TokenArgument, "")
 
-	for l.pos < len(l.input) {
+	for l.more() {
 		r := l.peek()
 
 		// check for closing """
-		if r == '"' && l.pos+2 < len(l.input) {
-			next1, _ := utf8.DecodeRuneInString(l.input[l.pos+1:])
-			next2, _ := utf8.DecodeRuneInString(l.input[l.pos+2:])
-			if next1 == '"' && next2 == '"' {
-				l.advance()
-				l.advance()
-				l.advance()
-				tok.Value = buf.String()
-				return tok, nil
-			}
+		if r == '"' && l.hasPrefix(`"""`) {
+			l.advance()
+			l.advance()
+			l.advance()
+			tok.Value = buf.String()
+			return tok, nil
 		}
 
 		// escape sequence
@@ -547,6 +688,18 @@ func (l *Lexer) scanTripleQuoted() (Token, error) {
 			return Token{}, l.errf("forbidden character in string")
 		}
 
+		// line terminators are kept verbatim but still advance the line count
+		if IsLineTerminator(r) {
+			consumed := l.advance()
+			buf.WriteRune(consumed)
+			if consumed == '\r' && l.peek() == '\n' {
+				buf.WriteRune(l.advance())
+			}
+			l.line++
+			l.column = 1
+			continue
+		}
+
 		buf.WriteRune(r)
 		l.advance()
 	}
@@ -1,8 +1,11 @@
 package confetti
 
 import (
+	"errors"
 	"reflect"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func collectTokens(t *testing.T, src string) ([]Token, error) {
@@ -420,3 +423,106 @@ func TestLexer_PunctuatorArgument_MaximalMunch(t *testing.T) {
 		t.Fatalf("expected [x === y], got %v", args)
 	}
 }
+
+func TestLexer_TokenPositions(t *testing.T) {
+	src := "ключ \"v\" # c\r\n\\\n  x"
+	toks, err := collectTokens(t, src)
+	if err != nil {
+		t.Fatalf("lexer error: %v", err)
+	}
+
+	want := []struct {
+		typ   TokenType
+		start Position
+		end   Position
+	}{
+		{TokenArgument, Position{0, 1, 1}, Position{8, 1, 5}},
+		{TokenArgument, Position{9, 1, 6}, Position{12, 1, 9}},
+		{TokenComment, Position{13, 1, 10}, Position{16, 1, 13}},
+		{TokenNewline, Position{16, 1, 13}, Position{18, 2, 1}},
+		{TokenLineContinuation, Position{18, 2, 1}, Position{22, 3, 3}},
+		{TokenArgument, Position{22, 3, 3}, Position{23, 3, 4}},
+		{TokenEOF, Position{23, 3, 4}, Position{23, 3, 4}},
+	}
+	if len(toks) != len(want) {
+		t.Fatalf("got %d tokens, want %d", len(toks), len(want))
+	}
+	for i, w := range want {
+		tok := toks[i]
+		if tok.Type != w.typ || tok.Pos() != w.start || tok.End != w.end {
+			t.Errorf("token %d: got %s %+v-%+v, want %s %+v-%+v",
+				i, tok.Type, tok.Pos(), tok.End, w.typ, w.start, w.end)
+		}
+	}
+}
+
+// lexAll returns every token of l up to EOF, or the tokens before the first
+// error together with that error.
+func lexAll(l *Lexer) ([]Token, error) {
+	var toks []Token
+	for {
+		tok, err := l.NextToken()
+		if err != nil {
+			return toks, err
+		}
+		toks = append(toks, tok)
+		if tok.Type == TokenEOF {
+			return toks, nil
+		}
+	}
+}
+
+func TestLexer_MalformedUTF8Position(t *testing.T) {
+	for _, src := range []string{"a\n  b\xff", "a\n  \xff", "a\n  \"b\xff\"", "a\n  # b\xff"} {
+		_, err := collectTokens(t, src)
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Fatalf("%q: error %v (%T) is not a *ParseError", src, err, err)
+		}
+		if perr.Msg != "malformed UTF-8" || perr.Line != 2 || perr.Column < 3 {
+			t.Errorf("%q: got %d:%d %q, want malformed UTF-8 on line 2", src, perr.Line, perr.Column, perr.Msg)
+		}
+	}
+}
+
+func TestLexerFromReader_SameAsString(t *testing.T) {
+	long := strings.Repeat("x", 3*minRead)
+	tests := []struct {
+		name string
+		src  string
+		opts Options
+	}{
+		{"simple", "server web {\n  listen 80; # port\n}\n", Options{}},
+		{"byte order mark", "\xEF\xBB\xBFa 1", Options{}},
+		{"quoted", "a \"two words\" \"\"\"multi\r\nline\"\"\" \"cont\\\nued\"", Options{}},
+		{"continuation", "a \\\n   b", Options{}},
+		{"unicode", "ключ значение 🎉\u2028next \u00e9", Options{}},
+		{"control-Z", "a 1\n\x1A", Options{}},
+		{"long argument", "key " + long + " \"" + long + "\"\n", Options{}},
+		{"long comment", "# " + long + "\n/* " + long + " */ a", Options{CStyleComments: true}},
+		{"extensions", "if (a (b)) x:=1 // c\n", Options{CStyleComments: true, ExpressionArguments: true, PunctuatorArguments: []string{":=", "="}}},
+		{"malformed UTF-8", "a 1\nb \xe2\x82", Options{}},
+		{"forbidden character", "a \x01", Options{}},
+		{"unterminated triple quote", "a \"\"\"" + long, Options{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, wantErr := lexAll(NewLexerWithOptions(tt.src, tt.opts))
+			got, gotErr := lexAll(NewLexerFromReader(iotest.OneByteReader(strings.NewReader(tt.src)), tt.opts))
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("tokens differ:\n got: %+v\nwant: %+v", got, want)
+			}
+			if !reflect.DeepEqual(gotErr, wantErr) {
+				t.Errorf("error = %v, want %v", gotErr, wantErr)
+			}
+		})
+	}
+}
+
+func TestLexerFromReader_ReadError(t *testing.T) {
+	boom := errors.New("boom")
+	_, err := lexAll(NewLexerFromReader(iotest.ErrReader(boom), Options{}))
+	if err != boom {
+		t.Fatalf("got error %v, want %v", err, boom)
+	}
+}
@@ -0,0 +1,197 @@
+package confetti
+
+import (
+	"fmt"
+	"slices"
+)
+
+// MergeStrategy says how [Merge] combines directives of an overlay with
+// those of the same name in the base.
+type MergeStrategy int
+
+// Merge strategies.
+const (
+	// MergeAuto deep-merges directives with a block and replaces the others.
+	MergeAuto MergeStrategy = iota
+
+	// MergeReplace replaces every base directive of the same name with the
+	// overlay directives of that name.
+	MergeReplace
+
+	// MergeAppend adds the overlay directive after the base directives of
+	// the same name.
+	MergeAppend
+
+	// MergeDeep merges the block of the overlay directive into that of the
+	// base directive with the same name and inline arguments, which is
+	// added if there is none. An overlay directive without a block replaces
+	// that base directive.
+	MergeDeep
+)
+
+// MergeOptions configures Merge.
+type MergeOptions struct {
+	// Strategies gives the strategy for directives by name, at any nesting
+	// level. Names that are not listed use MergeAuto.
+	Strategies map[string]MergeStrategy
+
+	// Delete, if set, is the name of a marker directive that removes base
+	// directives instead of adding one: "delete server api", with Delete
+	// set to "delete", removes the directives named server whose arguments
+	// after the name start with api, at the level of the marker.
+	Delete string
+}
+
+// Merge returns the configuration obtained by applying overlay on top of
+// base, as when a base configuration is overridden for an environment,
+// then for a host.
+//
+// The directives of overlay are applied in order, each at its nesting
+// level, according to the strategy for its name in opts: with the default
+// strategy, a directive without a block replaces the base directives of
+// the same name, so that port 9090 overrides port 8080, and a directive
+// with a block is merged into the base directive with the same name and
+// inline arguments, so that server api { } changes only what it lists of
+// server api in base. New directives are added after the last directive
+// of the same name, or at the end of their level.
+//
+// A delete marker without arguments or with a block is reported as a
+// *ParseError. Base and overlay are not modified; the result shares their
+// arguments.
+func Merge(base, overlay *ConfigurationUnit, opts MergeOptions) (*ConfigurationUnit, error) {
+	dirs, err := mergeDirectives(base.Directives, overlay.Directives, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &ConfigurationUnit{Directives: dirs}, nil
+}
+
+// mergeDirectives returns the directives base with overlay applied.
+func mergeDirectives(base, overlay []Directive, opts MergeOptions) ([]Directive, error) {
+	res := slices.Clone(base)
+	replaced := make(map[string]bool) // names whose base directives have been replaced
+	for _, d := range overlay {
+		if len(d.Arguments) == 0 {
+			continue
+		}
+		name := d.Arguments[0]
+
+		if opts.Delete != "" && name == opts.Delete {
+			if len(d.Arguments) < 2 || d.HasBlock() {
+				return nil, &ParseError{
+					File:   d.File,
+					Line:   d.Span.Start.Line,
+					Column: d.Span.Start.Column,
+					Msg:    fmt.Sprintf("%s needs a directive name and no block", name),
+				}
+			}
+			res = slices.DeleteFunc(res, func(b Directive) bool {
+				return len(b.Arguments) >= len(d.Arguments)-1 && slices.Equal(b.Arguments[:len(d.Arguments)-1], d.Arguments[1:])
+			})
+			continue
+		}
+
+		// the directive as added, where its markers have nothing to delete
+		added := d
+		if opts.Delete != "" {
+			added.Subdirectives = dropMarkers(d.Subdirectives, opts.Delete)
+		}
+		strategy := opts.Strategies[name]
+		if strategy == MergeAuto {
+			strategy = MergeReplace
+			if d.HasBlock() {
+				strategy = MergeDeep
+			}
+		}
+		switch strategy {
+		case MergeReplace:
+			if !replaced[name] {
+				replaced[name] = true
+				i := slices.IndexFunc(res, func(b Directive) bool { return hasName(b, name) })
+				if i >= 0 {
+					res[i] = added
+					rest := slices.DeleteFunc(res[i+1:], func(b Directive) bool { return hasName(b, name) })
+					res = res[:i+1+len(rest)]
+					continue
+				}
+			}
+			res = insertAfterLast(res, added)
+
+		case MergeDeep:
+			i := slices.IndexFunc(res, func(b Directive) bool { return slices.Equal(b.Arguments, d.Arguments) })
+			if i < 0 {
+				res = insertAfterLast(res, added)
+				continue
+			}
+			if !d.HasBlock() {
+				res[i] = added
+				continue
+			}
+			subs, err := mergeDirectives(res[i].Subdirectives, d.Subdirectives, opts)
+			if err != nil {
+				return nil, err
+			}
+			if !res[i].HasBlock() {
+				res[i].LeftBrace, res[i].RightBrace = d.LeftBrace, d.RightBrace
+			}
+			res[i].Subdirectives = subs
+
+		default:
+			res = insertAfterLast(res, added)
+		}
+	}
+	return res, nil
+}
+
+// dropMarkers returns dirs without the delete markers named marker, which
+// have nothing to delete in directives added by an overlay.
+func dropMarkers(dirs []Directive, marker string) []Directive {
+	if dirs == nil {
+		return nil
+	}
+	res := []Directive{}
+	for _, d := range dirs {
+		if hasName(d, marker) {
+			continue
+		}
+		d.Subdirectives = dropMarkers(d.Subdirectives, marker)
+		res = append(res, d)
+	}
+	return res
+}
+
+func hasName(d Directive, name string) bool {
+	return len(d.Arguments) > 0 && d.Arguments[0] == name
+}
+
+// insertAfterLast inserts d into dirs after the last directive with the same
+// name, or at the end.
+func insertAfterLast(dirs []Directive, d Directive) []Directive {
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if hasName(dirs[i], d.Arguments[0]) {
+			return slices.Insert(dirs, i+1, d)
+		}
+	}
+	return append(dirs, d)
+}
+
+// DecodeMerged merges layers in order, each on top of the ones before it,
+// as Merge does with mopts, and decodes the result into v as
+// DecodeWithOptions does with opts. Interpolation, if enabled, takes place
+// after merging, so that a layer may override the values others refer to.
+//
+//	err := confetti.DecodeMerged([]*confetti.ConfigurationUnit{base, env, local}, &cfg,
+//	    confetti.MergeOptions{}, confetti.DecodeOptions{})
+func DecodeMerged(layers []*ConfigurationUnit, v any, mopts MergeOptions, opts DecodeOptions) error {
+	if len(layers) == 0 {
+		return fmt.Errorf("confetti: DecodeMerged called with no layers")
+	}
+	cfg := layers[0]
+	for _, layer := range layers[1:] {
+		var err error
+		if cfg, err = Merge(cfg, layer, mopts); err != nil {
+			return err
+		}
+	}
+	return DecodeWithOptions(cfg, v, opts)
+}
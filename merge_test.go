@@ -0,0 +1,120 @@
+package confetti
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	base := `port 8080
+listen 80
+listen 443
+server web {
+    root /srv/web
+    timeout 30
+}
+server api {
+    timeout 60
+}
+plugins a
+`
+	tests := []struct {
+		name    string
+		overlay string
+		opts    MergeOptions
+		want    string
+	}{
+		{"replace scalar", "port 9090\n", MergeOptions{},
+			"<port> <9090>\n<listen> <80>\n<listen> <443>\n<server> <web> [\n    <root> </srv/web>\n    <timeout> <30>\n]\n<server> <api> [\n    <timeout> <60>\n]\n<plugins> <a>\n"},
+		{"replace repeated", "listen 8080\nlisten 8443\n", MergeOptions{},
+			"<port> <8080>\n<listen> <8080>\n<listen> <8443>\n<server> <web> [\n    <root> </srv/web>\n    <timeout> <30>\n]\n<server> <api> [\n    <timeout> <60>\n]\n<plugins> <a>\n"},
+		{"deep merge", "server api {\n    timeout 90\n    retries 3\n}\nserver admin {\n    root /srv/admin\n}\n", MergeOptions{},
+			"<port> <8080>\n<listen> <80>\n<listen> <443>\n<server> <web> [\n    <root> </srv/web>\n    <timeout> <30>\n]\n<server> <api> [\n    <timeout> <90>\n    <retries> <3>\n]\n<server> <admin> [\n    <root> </srv/admin>\n]\n<plugins> <a>\n"},
+		{"append", "plugins b\nlisten 8080\n", MergeOptions{Strategies: map[string]MergeStrategy{"plugins": MergeAppend, "listen": MergeAppend}},
+			"<port> <8080>\n<listen> <80>\n<listen> <443>\n<listen> <8080>\n<server> <web> [\n    <root> </srv/web>\n    <timeout> <30>\n]\n<server> <api> [\n    <timeout> <60>\n]\n<plugins> <a>\n<plugins> <b>\n"},
+		{"replace block", "server web {\n    root /tmp\n}\n", MergeOptions{Strategies: map[string]MergeStrategy{"server": MergeReplace}},
+			"<port> <8080>\n<listen> <80>\n<listen> <443>\n<server> <web> [\n    <root> </tmp>\n]\n<plugins> <a>\n"},
+		{"deep without block", "server web\nlisten 80\n", MergeOptions{Strategies: map[string]MergeStrategy{"server": MergeDeep, "listen": MergeDeep}},
+			"<port> <8080>\n<listen> <80>\n<listen> <443>\n<server> <web>\n<server> <api> [\n    <timeout> <60>\n]\n<plugins> <a>\n"},
+		{"delete", "delete listen\nserver web {\n    delete timeout\n}\ndelete server api\n", MergeOptions{Delete: "delete"},
+			"<port> <8080>\n<server> <web> [\n    <root> </srv/web>\n]\n<plugins> <a>\n"},
+		{"delete in added block", "extra {\n    delete x\n    y 1\n}\n", MergeOptions{Delete: "delete"},
+			"<port> <8080>\n<listen> <80>\n<listen> <443>\n<server> <web> [\n    <root> </srv/web>\n    <timeout> <30>\n]\n<server> <api> [\n    <timeout> <60>\n]\n<plugins> <a>\n<extra> [\n    <y> <1>\n]\n"},
+		{"marker disabled", "delete listen\n", MergeOptions{},
+			"<port> <8080>\n<listen> <80>\n<listen> <443>\n<server> <web> [\n    <root> </srv/web>\n    <timeout> <30>\n]\n<server> <api> [\n    <timeout> <60>\n]\n<plugins> <a>\n<delete> <listen>\n"},
+	}
+	for _, tt := range tests {
+		b, err := Parse(base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o, err := Parse(tt.overlay)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		before := b.String()
+		got, err := Merge(b, o, tt.opts)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("%s:\n got: %q\nwant: %q", tt.name, got.String(), tt.want)
+		}
+		if b.String() != before {
+			t.Errorf("%s: Merge modified base", tt.name)
+		}
+	}
+}
+
+func TestMerge_InvalidMarker(t *testing.T) {
+	b, _ := Parse("a 1\n")
+	for _, src := range []string{"delete\n", "delete a { }\n"} {
+		o, _ := Parse(src)
+		_, err := Merge(b, o, MergeOptions{Delete: "delete"})
+		var perr *ParseError
+		if !errors.As(err, &perr) || perr.Line != 1 || perr.Column != 1 {
+			t.Errorf("%q: got error %v, want a *ParseError at 1:1", src, err)
+		}
+	}
+}
+
+func TestDecodeMerged(t *testing.T) {
+	type Server struct {
+		Name    string `conf:",arg"`
+		Timeout int    `conf:"timeout"`
+		Root    string `conf:"root"`
+	}
+	type Config struct {
+		Port    int      `conf:"port"`
+		Host    string   `conf:"host"`
+		Servers []Server `conf:"server"`
+	}
+	var layers []*ConfigurationUnit
+	for _, src := range []string{
+		"port 8080\nhost \"${HOST}\"\nserver web { timeout 30; root /srv }\n",
+		"port 9090\nserver web { timeout 60 }\n",
+		"HOST example.com\ndelete host\nhost \"${HOST}.local\"\n",
+	} {
+		unit, err := Parse(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		layers = append(layers, unit)
+	}
+	var cfg Config
+	err := DecodeMerged(layers, &cfg, MergeOptions{Delete: "delete"}, DecodeOptions{
+		Interpolate: &InterpolateOptions{},
+	})
+	if err != nil {
+		t.Fatalf("DecodeMerged error: %v", err)
+	}
+	want := Config{Port: 9090, Host: "example.com.local", Servers: []Server{{Name: "web", Timeout: 60, Root: "/srv"}}}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("got %+v, want %+v", cfg, want)
+	}
+	if err := DecodeMerged(nil, &cfg, MergeOptions{}, DecodeOptions{}); err == nil {
+		t.Errorf("DecodeMerged with no layers succeeded")
+	}
+}
@@ -1,6 +1,7 @@
 package confetti
 
-// Options configures optional Confetti language extensions.
+// Options configures parsing: the optional Confetti language extensions and
+// how syntax errors are reported.
 type Options struct {
 	// CStyleComments enables Annex A: // and /* ... */ comment syntax.
 	CStyleComments bool
@@ -13,4 +14,45 @@ type Options struct {
 	// each string is a punctuator that will be recognized as a standalone argument.
 	// longer punctuators are matched first (maximal munch).
 	PunctuatorArguments []string
+
+	// AllErrors makes the parser recover from syntax errors instead of
+	// stopping at the first one. It skips to the next newline, semicolon or
+	// closing brace and carries on, returning the directives it could parse
+	// together with an ErrorList holding every error, sorted by position.
+	AllErrors bool
+
+	// Limits bounds the resources spent on a document, for parsing
+	// untrusted input. ParseFS applies MaxInputBytes and MaxDirectives to
+	// all the files it reads together.
+	Limits Limits
+
+	// Include names the directive that ParseFS replaces with the directives
+	// of the files its arguments name, such as "include". Empty disables
+	// includes. Other parse functions ignore it.
+	Include string
+}
+
+// Limits caps the size and shape of a document. A zero field means no
+// limit. Exceeding a limit stops parsing, even with Options.AllErrors, with
+// a *ParseError wrapping the matching error: ErrInputTooLarge, ErrMaxDepth,
+// ErrTooManyArguments, ErrTooManyDirectives or ErrArgumentTooLong.
+type Limits struct {
+	MaxInputBytes    int // size of the whole input, in bytes
+	MaxDepth         int // nesting of blocks; 1 allows blocks but no blocks within them
+	MaxArguments     int // arguments of a single directive, including its name
+	MaxDirectives    int // directives in the document, at every level
+	MaxArgumentBytes int // length of an argument's value, in bytes
+}
+
+// DecodeOptions configures DecodeWithOptions.
+type DecodeOptions struct {
+	// DisallowUnknown makes decoding fail when a directive does not match any
+	// field of the target struct, at any nesting level. The error joins one
+	// *DecodeError wrapping ErrUnknownDirective per unrecognized directive.
+	DisallowUnknown bool
+
+	// Interpolate, if not nil, makes decoding substitute variables and
+	// references in the document first, as Interpolate does with these
+	// options. Interpolation errors stop decoding.
+	Interpolate *InterpolateOptions
 }
@@ -1,11 +1,24 @@
 package confetti
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
 // Parser parses Confetti tokens into a ConfigurationUnit
 type Parser struct {
 	lexer   *Lexer
 	current Token
+
+	allErrors bool      // recover from syntax errors, collecting them in errors
+	errors    ErrorList // errors recovered from so far
+
+	limits     Limits
+	depth      int // number of blocks open
+	directives int // number of directives started
+
+	keepTokens bool    // record every token, comments included, in tokens
+	tokens     []Token // tokens read so far when keepTokens is set
 }
 
 // NewParser creates a new parser with no extensions enabled.
@@ -23,8 +36,14 @@ func NewParserWithOptions(input string, opts Options) (*Parser, error) {
 }
 
 func newParser(input string, opts Options) (*Parser, error) {
+	return newParserFromLexer(NewLexerWithOptions(input, opts), opts)
+}
+
+func newParserFromLexer(l *Lexer, opts Options) (*Parser, error) {
 	p := &Parser{
-		lexer: NewLexerWithOptions(input, opts),
+		lexer:     l,
+		allErrors: opts.AllErrors,
+		limits:    opts.Limits,
 	}
 
 	// load first token
@@ -47,16 +66,66 @@ func (p *Parser) Parse() (*ConfigurationUnit, error) {
 		return nil, err
 	}
 
-	return &ConfigurationUnit{
+	unit := &ConfigurationUnit{
 		Directives: directives,
-	}, nil
+	}
+	if p.allErrors {
+		p.errors.Sort()
+		return unit, p.errors.Err()
+	}
+	return unit, nil
+}
+
+// recover records err when recovering from errors. It reports whether
+// parsing should carry on, which it cannot after an error reading the input
+// or exceeding a limit.
+func (p *Parser) recover(err error) bool {
+	var perr *ParseError
+	if !p.allErrors || !errors.As(err, &perr) || perr.Err != nil {
+		return false
+	}
+	p.errors = append(p.errors, perr)
+	return true
+}
+
+// sync skips to the end of the directive in error: past the next newline or
+// semicolon, or up to the '}' closing the enclosing block. Blocks opened
+// along the way are skipped whole. It returns the errors that stop parsing.
+func (p *Parser) sync() error {
+	depth := 0
+	for p.current.Type != TokenEOF {
+		switch p.current.Type {
+		case TokenLeftBrace:
+			depth++
+		case TokenRightBrace:
+			if depth == 0 {
+				return nil
+			}
+			depth--
+		case TokenNewline, TokenSemicolon:
+			if depth == 0 {
+				return p.advance()
+			}
+		}
+		if err := p.advance(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (p *Parser) advance() error {
 	for {
 		tok, err := p.lexer.NextToken()
 		if err != nil {
-			return err
+			if !p.recover(err) {
+				return err
+			}
+			p.lexer.resync()
+			continue
+		}
+		if p.keepTokens {
+			p.tokens = append(p.tokens, tok)
 		}
 
 		// skip comments
@@ -92,12 +161,28 @@ func (p *Parser) parseDirectives(insideBlock bool) ([]Directive, error) {
 			if insideBlock {
 				break // expected closing brace
 			}
-			return nil, p.errf("unexpected '}' without matching '{'")
+			if err := p.errf("unexpected '}' without matching '{'"); !p.recover(err) {
+				return nil, err
+			}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			continue
 		}
 
 		directive, err := p.parseDirective()
 		if err != nil {
-			return nil, err
+			if !p.recover(err) {
+				return nil, err
+			}
+			// keep what was parsed of the directive
+			if len(directive.Arguments) > 0 {
+				directives = append(directives, directive)
+			}
+			if err := p.sync(); err != nil {
+				return nil, err
+			}
+			continue
 		}
 
 		directives = append(directives, directive)
@@ -107,7 +192,19 @@ func (p *Parser) parseDirectives(insideBlock bool) ([]Directive, error) {
 }
 
 func (p *Parser) parseDirective() (Directive, error) {
-	args, err := p.parseArguments()
+	// count the directive at its first argument
+	for p.current.Type == TokenLineContinuation {
+		if err := p.advance(); err != nil {
+			return Directive{}, err
+		}
+	}
+	if max := p.limits.MaxDirectives; max > 0 && p.current.Type == TokenArgument {
+		if p.directives++; p.directives > max {
+			return Directive{}, limitError(p.current.Pos(), ErrTooManyDirectives, max)
+		}
+	}
+
+	args, spans, err := p.parseArguments()
 	if err != nil {
 		return Directive{}, err
 	}
@@ -118,6 +215,8 @@ func (p *Parser) parseDirective() (Directive, error) {
 
 	directive := Directive{
 		Arguments: args,
+		Span:      Span{Start: spans[0].Start, End: spans[len(spans)-1].End},
+		ArgSpans:  spans,
 	}
 
 	// check what comes after arguments (possibly with newlines before block)
@@ -133,11 +232,14 @@ func (p *Parser) parseDirective() (Directive, error) {
 
 	// block directive case: { follows (possibly after newlines)
 	if p.current.Type == TokenLeftBrace {
-		subdirs, err := p.parseBlock()
+		subdirs, lbrace, rbrace, err := p.parseBlock()
+		directive.Subdirectives = subdirs
+		directive.LeftBrace = lbrace
 		if err != nil {
-			return Directive{}, err
+			return directive, err
 		}
-		directive.Subdirectives = subdirs
+		directive.RightBrace = rbrace
+		directive.Span.End = rbrace.End
 
 		// optional semicolon after block
 		if p.current.Type == TokenSemicolon {
@@ -172,51 +274,67 @@ func (p *Parser) parseDirective() (Directive, error) {
 	return Directive{}, p.errf("expected newline, semicolon, or block after directive, got %s", p.current.Type)
 }
 
-func (p *Parser) parseArguments() ([]string, error) {
+// parseArguments returns the directive's arguments and the source span of each.
+func (p *Parser) parseArguments() ([]string, []Span, error) {
 	var args []string
+	var spans []Span
 
 	for p.current.Type == TokenArgument || p.current.Type == TokenLineContinuation {
 		// skip line continuation tokens
 		if p.current.Type == TokenLineContinuation {
 			if err := p.advance(); err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			continue
 		}
 
+		if max := p.limits.MaxArguments; max > 0 && len(args) == max {
+			return nil, nil, limitError(p.current.Pos(), ErrTooManyArguments, max)
+		}
 		args = append(args, p.current.Value)
+		spans = append(spans, p.current.Span())
 		if err := p.advance(); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
 
-	return args, nil
+	return args, spans, nil
 }
 
-func (p *Parser) parseBlock() ([]Directive, error) {
+// parseBlock returns the block's subdirectives and the spans of its braces.
+// When the closing brace is missing it returns the subdirectives parsed so
+// far along with the error.
+func (p *Parser) parseBlock() (subdirs []Directive, lbrace, rbrace Span, err error) {
 	// consume '{'
 	if p.current.Type != TokenLeftBrace {
-		return nil, p.errf("expected '{', got %s", p.current.Type)
+		return nil, Span{}, Span{}, p.errf("expected '{', got %s", p.current.Type)
 	}
 
+	lbrace = p.current.Span()
+	if max := p.limits.MaxDepth; max > 0 && p.depth == max {
+		return nil, Span{}, Span{}, limitError(lbrace.Start, ErrMaxDepth, max)
+	}
 	if err := p.advance(); err != nil {
-		return nil, err
+		return nil, Span{}, Span{}, err
 	}
+	p.depth++
+	defer func() { p.depth-- }()
 
 	// parse subdirectives
-	subdirs, err := p.parseDirectives(true) // true = inside block
+	subdirs, err = p.parseDirectives(true) // true = inside block
 	if err != nil {
-		return nil, err
+		return nil, Span{}, Span{}, err
 	}
 
 	// consume '}'
 	if p.current.Type != TokenRightBrace {
-		return nil, p.errf("expected '}', got %s", p.current.Type)
+		return subdirs, lbrace, Span{}, p.errf("expected '}', got %s", p.current.Type)
 	}
 
+	rbrace = p.current.Span()
 	if err := p.advance(); err != nil {
-		return nil, err
+		return nil, Span{}, Span{}, err
 	}
 
-	return subdirs, nil
+	return subdirs, lbrace, rbrace, nil
 }
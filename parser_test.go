@@ -1,8 +1,11 @@
 package confetti
 
 import (
+	"errors"
 	"reflect"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func parseOK(t *testing.T, src string) *ConfigurationUnit {
@@ -18,13 +21,25 @@ func parseOK(t *testing.T, src string) *ConfigurationUnit {
 	return unit
 }
 
+// span builds a Span from the line, column and offset of its start and end.
+func span(line, col, off, endLine, endCol, endOff int) Span {
+	return Span{
+		Start: Position{Offset: off, Line: line, Column: col},
+		End:   Position{Offset: endOff, Line: endLine, Column: endCol},
+	}
+}
+
 func TestParser_SimpleDirective_Semicolon(t *testing.T) {
 	src := "listen 80;"
 	u := parseOK(t, src)
 
 	want := &ConfigurationUnit{
 		Directives: []Directive{
-			{Arguments: []string{"listen", "80"}},
+			{
+				Arguments: []string{"listen", "80"},
+				Span:      span(1, 1, 0, 1, 10, 9),
+				ArgSpans:  []Span{span(1, 1, 0, 1, 7, 6), span(1, 8, 7, 1, 10, 9)},
+			},
 		},
 	}
 	if !reflect.DeepEqual(u, want) {
@@ -38,7 +53,11 @@ func TestParser_SimpleDirective_Newline(t *testing.T) {
 
 	want := &ConfigurationUnit{
 		Directives: []Directive{
-			{Arguments: []string{"root", "/var/www"}},
+			{
+				Arguments: []string{"root", "/var/www"},
+				Span:      span(1, 1, 0, 1, 14, 13),
+				ArgSpans:  []Span{span(1, 1, 0, 1, 5, 4), span(1, 6, 5, 1, 14, 13)},
+			},
 		},
 	}
 	if !reflect.DeepEqual(u, want) {
@@ -60,9 +79,21 @@ server {
 			{
 				Arguments: []string{"server"},
 				Subdirectives: []Directive{
-					{Arguments: []string{"listen", "80"}},
-					{Arguments: []string{"server_name", "example.com"}},
+					{
+						Arguments: []string{"listen", "80"},
+						Span:      span(3, 5, 14, 3, 14, 23),
+						ArgSpans:  []Span{span(3, 5, 14, 3, 11, 20), span(3, 12, 21, 3, 14, 23)},
+					},
+					{
+						Arguments: []string{"server_name", "example.com"},
+						Span:      span(4, 5, 29, 4, 28, 52),
+						ArgSpans:  []Span{span(4, 5, 29, 4, 16, 40), span(4, 17, 41, 4, 28, 52)},
+					},
 				},
+				Span:       span(2, 1, 1, 5, 2, 54),
+				ArgSpans:   []Span{span(2, 1, 1, 2, 7, 7)},
+				LeftBrace:  span(2, 8, 8, 2, 9, 9),
+				RightBrace: span(5, 1, 53, 5, 2, 54),
 			},
 		},
 	}
@@ -429,3 +460,226 @@ func TestParser_Error_OnlyWhitespace(t *testing.T) {
 		t.Fatalf("expected 0 directives for whitespace-only input, got %d", len(u.Directives))
 	}
 }
+
+func TestParser_Positions(t *testing.T) {
+	src := "a \\\n  \"b c\" {\n  x \"\"\"1\n2\"\"\" y\n  # note\n  /z\n}\n"
+	u := parseOK(t, src)
+
+	a := u.Directives[0]
+	if want := span(1, 1, 0, 7, 2, 45); a.Span != want {
+		t.Errorf("a.Span = %+v, want %+v", a.Span, want)
+	}
+	// the line continuation between the arguments is not an argument
+	wantArgs := []Span{span(1, 1, 0, 1, 2, 1), span(2, 3, 6, 2, 8, 11)}
+	if !reflect.DeepEqual(a.ArgSpans, wantArgs) {
+		t.Errorf("a.ArgSpans = %+v, want %+v", a.ArgSpans, wantArgs)
+	}
+	if !a.HasBlock() || a.LeftBrace.Start.Line != 2 || a.RightBrace.Start.Line != 7 {
+		t.Errorf("unexpected braces %+v %+v", a.LeftBrace, a.RightBrace)
+	}
+
+	// a triple-quoted argument spanning lines advances the line count
+	x := a.Subdirectives[0]
+	if want := span(3, 5, 18, 4, 5, 27); x.ArgSpans[1] != want {
+		t.Errorf("x.ArgSpans[1] = %+v, want %+v", x.ArgSpans[1], want)
+	}
+	if got := x.ArgSpans[2].Start; got.Line != 4 || got.Column != 6 {
+		t.Errorf("y starts at %s, want 4:6", got)
+	}
+
+	z := a.Subdirectives[1]
+	if got := z.Span.Start; got.Line != 6 || got.Column != 3 {
+		t.Errorf("z starts at %s, want 6:3", got)
+	}
+	if z.HasBlock() {
+		t.Error("z.HasBlock() = true, want false")
+	}
+}
+
+func TestParser_EmptyBlockHasBlock(t *testing.T) {
+	u := parseOK(t, "empty {}\nplain\n")
+	if !u.Directives[0].HasBlock() {
+		t.Error("empty {} should report HasBlock")
+	}
+	if u.Directives[1].HasBlock() {
+		t.Error("plain directive should not report HasBlock")
+	}
+}
+
+func TestParser_AllErrors(t *testing.T) {
+	src := "a 1\n" +
+		"}\n" + // stray brace
+		"b \"open\n" + // unterminated string
+		"c 2\n" +
+		"d { e \x01 }\n" + // forbidden character inside a block
+		"; f 3\n" + // directive without arguments
+		"k;;\n" + // empty directive after a semicolon
+		"h { i 5\n" // unclosed block
+	u, err := ParseWithOptions(src, Options{AllErrors: true})
+
+	var list ErrorList
+	if !errors.As(err, &list) {
+		t.Fatalf("error %v (%T) is not an ErrorList", err, err)
+	}
+	want := []struct {
+		line, col int
+		msg       string
+	}{
+		{2, 1, "unexpected '}' without matching '{'"},
+		{3, 8, "unexpected newline in single-quoted string"},
+		{5, 7, "forbidden character"},
+		{6, 1, "directive must have at least one argument"},
+		{7, 3, "directive must have at least one argument"},
+		{9, 1, "expected '}', got end of input"},
+	}
+	if len(list) != len(want) {
+		t.Fatalf("got %d errors, want %d: %v", len(list), len(want), list.Unwrap())
+	}
+	for i, w := range want {
+		if e := list[i]; e.Line != w.line || e.Column != w.col || e.Msg != w.msg {
+			t.Errorf("error %d = %d:%d %q, want %d:%d %q", i, e.Line, e.Column, e.Msg, w.line, w.col, w.msg)
+		}
+	}
+
+	if u == nil {
+		t.Fatal("no partial result")
+	}
+	var got []string
+	for _, d := range u.Directives {
+		got = append(got, d.Arguments[0])
+		for _, sub := range d.Subdirectives {
+			got = append(got, d.Arguments[0]+">"+sub.Arguments[0])
+		}
+	}
+	if w := []string{"a", "b", "c", "d", "d>e", "f", "k", "h", "h>i"}; !reflect.DeepEqual(got, w) {
+		t.Errorf("partial result has %v, want %v", got, w)
+	}
+
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr != list[0] {
+		t.Errorf("errors.As found %v, want the first error", perr)
+	}
+	if msg := err.Error(); !strings.HasSuffix(msg, "(and 5 more errors)") {
+		t.Errorf("Error() = %q", msg)
+	}
+}
+
+func TestParser_AllErrorsValidInput(t *testing.T) {
+	u, err := ParseWithOptions("a 1\nb { c 2 }\n", Options{AllErrors: true})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(u.Directives) != 2 {
+		t.Fatalf("got %d directives, want 2", len(u.Directives))
+	}
+}
+
+func TestParser_AllErrorsMalformedUTF8(t *testing.T) {
+	u, err := ParseWithOptions("a 1\nb x\xffy\nc 3\n", Options{AllErrors: true})
+	var list ErrorList
+	if !errors.As(err, &list) || len(list) != 1 || list[0].Msg != "malformed UTF-8" {
+		t.Fatalf("got %v, want a single malformed UTF-8 error", err)
+	}
+	if list[0].Line != 2 || list[0].Column != 4 {
+		t.Errorf("error at %d:%d, want 2:4", list[0].Line, list[0].Column)
+	}
+	if len(u.Directives) != 3 {
+		t.Errorf("got %d directives, want 3", len(u.Directives))
+	}
+}
+
+func TestErrorList_Sort(t *testing.T) {
+	list := ErrorList{
+		{Line: 3, Column: 1, Msg: "c"},
+		{Line: 1, Column: 5, Msg: "b"},
+		{Line: 1, Column: 5, Msg: "a"},
+		{Line: 1, Column: 2, Msg: "z"},
+	}
+	list.Sort()
+	var got []string
+	for _, e := range list {
+		got = append(got, e.Msg)
+	}
+	if want := []string{"z", "a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("sorted order %v, want %v", got, want)
+	}
+	if (ErrorList{}).Err() != nil {
+		t.Error("Err() of an empty list is not nil")
+	}
+}
+
+func TestParser_Limits(t *testing.T) {
+	tests := []struct {
+		src       string
+		limits    Limits
+		want      error // nil if the document is within the limits
+		line, col int
+	}{
+		{"a 1\nb 2\n", Limits{MaxInputBytes: 8}, nil, 0, 0},
+		{"a 1\nb 2\n", Limits{MaxInputBytes: 7}, ErrInputTooLarge, 2, 4},
+		{"a 1\nb 2", Limits{MaxInputBytes: 6}, ErrInputTooLarge, 2, 3},
+		{"a \"open\n", Limits{MaxInputBytes: 4}, ErrInputTooLarge, 1, 5},
+		{"a é\n", Limits{MaxInputBytes: 3}, ErrInputTooLarge, 1, 3},
+		{"a 1\n\x1a", Limits{MaxInputBytes: 4}, ErrInputTooLarge, 2, 1},
+		{"a {\n  b {\n    c\n  }\n}\n", Limits{MaxDepth: 2}, nil, 0, 0},
+		{"a {\n  b {\n    c {}\n  }\n}\n", Limits{MaxDepth: 2}, ErrMaxDepth, 3, 7},
+		{"a {}\n", Limits{MaxDepth: -1}, nil, 0, 0},
+		{"a 1 2\n", Limits{MaxArguments: 3}, nil, 0, 0},
+		{"a 1 2 3\n", Limits{MaxArguments: 3}, ErrTooManyArguments, 1, 7},
+		{"a { b; c }\nd\n", Limits{MaxDirectives: 4}, nil, 0, 0},
+		{"a { b; c }\nd\ne\n", Limits{MaxDirectives: 4}, ErrTooManyDirectives, 3, 1},
+		{"a { b; c { d; e } }\n", Limits{MaxDirectives: 4}, ErrTooManyDirectives, 1, 15},
+		{strings.Repeat("\\\na\n", 1000), Limits{MaxDirectives: 1}, ErrTooManyDirectives, 4, 1},
+		{"abc \"d e\"\n", Limits{MaxArgumentBytes: 3}, nil, 0, 0},
+		{"abc \"d e f\"\n", Limits{MaxArgumentBytes: 3}, ErrArgumentTooLong, 1, 5},
+	}
+	for _, tt := range tests {
+		opts := Options{Limits: tt.limits}
+		_, err := ParseWithOptions(tt.src, opts)
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%q: unexpected error: %v", tt.src, err)
+			}
+		} else {
+			var perr *ParseError
+			if !errors.Is(err, tt.want) || !errors.As(err, &perr) {
+				t.Errorf("%q: error = %v, want %v", tt.src, err, tt.want)
+				continue
+			}
+			if perr.Line != tt.line || perr.Column != tt.col {
+				t.Errorf("%q: error at %d:%d, want %d:%d", tt.src, perr.Line, perr.Column, tt.line, tt.col)
+			}
+		}
+
+		// every way of parsing enforces the limits alike
+		if _, rerr := ParseReader(iotest.OneByteReader(strings.NewReader(tt.src)), opts); !reflect.DeepEqual(rerr, err) {
+			t.Errorf("%q: ParseReader error = %v, want %v", tt.src, rerr, err)
+		}
+		if _, derr := readAll(NewDecoderWithOptions(strings.NewReader(tt.src), opts)); !reflect.DeepEqual(derr, err) {
+			t.Errorf("%q: Decoder error = %v, want %v", tt.src, derr, err)
+		}
+		if _, cerr := ParseCST(tt.src, opts); !reflect.DeepEqual(cerr, err) {
+			t.Errorf("%q: ParseCST error = %v, want %v", tt.src, cerr, err)
+		}
+	}
+}
+
+func TestParser_LimitsStopAllErrors(t *testing.T) {
+	src := "a {\n}}\nb 1 2 3\nc {\n"
+	unit, err := ParseWithOptions(src, Options{AllErrors: true, Limits: Limits{MaxArguments: 2}})
+	var perr *ParseError
+	if unit != nil || !errors.As(err, &perr) || !errors.Is(err, ErrTooManyArguments) {
+		t.Fatalf("got %v, %v; want only the limit error", unit, err)
+	}
+	if perr.Line != 3 || perr.Column != 5 {
+		t.Errorf("error at %d:%d, want 3:5", perr.Line, perr.Column)
+	}
+
+	// limits reached while skipping past an error
+	for _, src := range []string{"}abcdef\n", "a }\nbcdefgh\n", "a \"b\n;cdefgh\n"} {
+		unit, err := ParseWithOptions(src, Options{AllErrors: true, Limits: Limits{MaxInputBytes: 4}})
+		if unit != nil || !errors.Is(err, ErrInputTooLarge) {
+			t.Errorf("%q: got %v, %v; want only the limit error", src, unit, err)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package confetti
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Match is a directive found by [ConfigurationUnit.FindAll] or
+// [ConfigurationUnit.Query], together with where it was found.
+type Match struct {
+	Directive *Directive // the directive, within the unit searched
+
+	// Path holds the names of the directive's enclosing directives and of
+	// the directive itself, from the top level down, as in DecodeError.Path.
+	Path []string
+
+	// Index holds the position of each directive of Path within the
+	// directives of its parent, so that the directive is
+	// unit.Directives[Index[0]].Subdirectives[Index[1]]...
+	Index []int
+}
+
+// Find returns the first directive, in document order, found by following
+// names from the top level down: a directive named names[0], within it one
+// named names[1], and so on. It returns nil if there is none.
+//
+//	user := cfg.Find("database", "credentials", "user")
+func (cf *ConfigurationUnit) Find(names ...string) *Directive {
+	return findPath(cf.Directives, names)
+}
+
+// findPath returns the first directive of dirs found by following path, or
+// nil.
+func findPath(dirs []Directive, path []string) *Directive {
+	if len(path) == 0 {
+		return nil
+	}
+	for i := range dirs {
+		d := &dirs[i]
+		if len(d.Arguments) == 0 || d.Arguments[0] != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			return d
+		}
+		if found := findPath(d.Subdirectives, path[1:]); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// FindAll returns every directive found by following names from the top
+// level down, as Find does, in document order.
+//
+//	for _, m := range cfg.FindAll("server", "listen") { ... }
+func (cf *ConfigurationUnit) FindAll(names ...string) []Match {
+	if len(names) == 0 {
+		return nil
+	}
+	return namesSelector(names).match(cf.Directives, nil, nil, nil)
+}
+
+// Query returns every directive matching the selector sel, in document
+// order. A selector is a list of steps separated by dots, one per nesting
+// level starting at the top level. Each step is a directive name,
+// optionally followed by arguments in brackets that the directive's
+// arguments after its name must start with:
+//
+//	database.credentials.user   user within credentials within database
+//	server[web].timeout         timeout within the server whose first argument is web
+//	server[*].port              port within any server with at least one argument
+//	route[GET /api]             route whose arguments start with GET and /api
+//	*.port                      port within any top-level directive
+//
+// A * stands for any single name or argument. Arguments in brackets are
+// separated by spaces. A backslash makes the next character literal, so
+// that names and arguments may contain dots, brackets, spaces or stars.
+// Query returns an error if sel is malformed.
+func (cf *ConfigurationUnit) Query(sel string) ([]Match, error) {
+	s, err := parseSelector(sel)
+	if err != nil {
+		return nil, err
+	}
+	return s.match(cf.Directives, nil, nil, nil), nil
+}
+
+// selector is a parsed Query selector.
+type selector []selectorStep
+
+// namesSelector returns the selector matching the directive path names.
+func namesSelector(names []string) selector {
+	sel := make(selector, len(names))
+	for i, name := range names {
+		sel[i] = selectorStep{name: pattern{s: name}}
+	}
+	return sel
+}
+
+// selectorStep matches directives at one nesting level.
+type selectorStep struct {
+	name pattern
+	args []pattern
+}
+
+// pattern matches a name or argument: s, or anything if any is set.
+type pattern struct {
+	s   string
+	any bool
+}
+
+func (st selectorStep) matches(d *Directive) bool {
+	if len(d.Arguments) == 0 || !st.name.matches(d.Arguments[0]) {
+		return false
+	}
+	if len(d.Arguments)-1 < len(st.args) {
+		return false
+	}
+	for i, arg := range st.args {
+		if !arg.matches(d.Arguments[i+1]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p pattern) matches(s string) bool {
+	return p.any || p.s == s
+}
+
+// match appends to res the directives of dirs, found at path and index,
+// that s matches.
+func (s selector) match(dirs []Directive, path []string, index []int, res []Match) []Match {
+	for i := range dirs {
+		d := &dirs[i]
+		if !s[0].matches(d) {
+			continue
+		}
+		p := append(path[:len(path):len(path)], d.Arguments[0])
+		ix := append(index[:len(index):len(index)], i)
+		if len(s) == 1 {
+			res = append(res, Match{Directive: d, Path: p, Index: ix})
+			continue
+		}
+		res = s[1:].match(d.Subdirectives, p, ix, res)
+	}
+	return res
+}
+
+// parseSelector parses a Query selector.
+func parseSelector(sel string) (selector, error) {
+	p := &selectorParser{sel: sel}
+	var s selector
+	for {
+		name, err := p.word(".[] ")
+		if err != nil {
+			return nil, err
+		}
+		st := selectorStep{name: name}
+		if p.next('[') {
+			st.args = []pattern{}
+			for {
+				for p.next(' ') {
+				}
+				if p.next(']') {
+					break
+				}
+				if p.i == len(sel) {
+					return nil, p.errorf("missing ']'")
+				}
+				arg, err := p.word("] ")
+				if err != nil {
+					return nil, err
+				}
+				st.args = append(st.args, arg)
+			}
+		}
+		s = append(s, st)
+		if p.i == len(sel) {
+			return s, nil
+		}
+		if !p.next('.') {
+			return nil, p.errorf("unexpected %q", sel[p.i])
+		}
+	}
+}
+
+// escapeSelector returns s as a selector name or argument, with the bytes
+// that have a meaning in selectors escaped.
+func escapeSelector(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(`\.[] *`, s[i]) >= 0 {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// selectorParser holds the state of parseSelector.
+type selectorParser struct {
+	sel string
+	i   int // offset of the next byte to read
+}
+
+// next consumes c if it is the next byte.
+func (p *selectorParser) next(c byte) bool {
+	if p.i < len(p.sel) && p.sel[p.i] == c {
+		p.i++
+		return true
+	}
+	return false
+}
+
+// word reads a name or argument up to the next unescaped byte of stop.
+func (p *selectorParser) word(stop string) (pattern, error) {
+	var sb strings.Builder
+	start := p.i
+	for p.i < len(p.sel) && strings.IndexByte(stop, p.sel[p.i]) < 0 {
+		if p.sel[p.i] == '\\' {
+			if p.i++; p.i == len(p.sel) {
+				return pattern{}, p.errorf("trailing backslash")
+			}
+		}
+		sb.WriteByte(p.sel[p.i])
+		p.i++
+	}
+	switch p.sel[start:p.i] {
+	case "":
+		return pattern{}, p.errorf("expected a name")
+	case "*":
+		return pattern{any: true}, nil
+	}
+	return pattern{s: sb.String()}, nil
+}
+
+func (p *selectorParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("confetti: invalid selector %q at offset %d: %s", p.sel, p.i, fmt.Sprintf(format, args...))
+}
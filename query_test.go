@@ -0,0 +1,130 @@
+package confetti
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const querySrc = `server web {
+    listen 80
+    timeout 30s
+}
+server api {
+    listen 8080
+    port 9000
+}
+server {
+    port 1
+}
+route GET /api { to api }
+route GET /web { to web }
+route POST /api { to api }
+weird\.name[x] 1
+`
+
+// matchStrings renders matches as "path@index: arguments".
+func matchStrings(ms []Match) []string {
+	var res []string
+	for _, m := range ms {
+		var ix []string
+		for _, i := range m.Index {
+			ix = append(ix, strings.Repeat("i", i+1))
+		}
+		res = append(res, strings.Join(m.Path, ">")+"@"+strings.Join(ix, ",")+": "+strings.Join(m.Directive.Arguments, " "))
+	}
+	return res
+}
+
+func TestFind(t *testing.T) {
+	cfg, err := Parse(querySrc)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if d := cfg.Find("server", "timeout"); d == nil || d.Arguments[1] != "30s" {
+		t.Errorf("Find(server, timeout) = %v", d)
+	}
+	// the first server has no port; the search goes on to the second
+	if d := cfg.Find("server", "port"); d == nil || d.Arguments[1] != "9000" {
+		t.Errorf("Find(server, port) = %v", d)
+	}
+	if d := cfg.Find("server", "missing"); d != nil {
+		t.Errorf("Find(server, missing) = %v, want nil", d)
+	}
+	if d := cfg.Find(); d != nil {
+		t.Errorf("Find() = %v, want nil", d)
+	}
+
+	// the result points into the unit
+	cfg.Find("server", "listen").Arguments[1] = "81"
+	if got := cfg.Directives[0].Subdirectives[0].Arguments[1]; got != "81" {
+		t.Errorf("directive not modified through Find: %q", got)
+	}
+
+	got := matchStrings(cfg.FindAll("server", "listen"))
+	want := []string{"server>listen@i,i: listen 81", "server>listen@ii,i: listen 8080"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAll:\n got: %q\nwant: %q", got, want)
+	}
+	if got := cfg.FindAll(); got != nil {
+		t.Errorf("FindAll() = %q, want nil", matchStrings(got))
+	}
+	// an empty name is not a wildcard
+	if got := cfg.FindAll("", "listen"); got != nil {
+		t.Errorf("FindAll(\"\", listen) = %q, want nil", matchStrings(got))
+	}
+}
+
+func TestQuery(t *testing.T) {
+	cfg, err := Parse(querySrc)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	tests := []struct {
+		sel  string
+		want []string
+	}{
+		{"server[web].timeout", []string{"server>timeout@i,ii: timeout 30s"}},
+		{"server[*].port", []string{"server>port@ii,ii: port 9000"}},
+		{"server.port", []string{"server>port@ii,ii: port 9000", "server>port@iii,i: port 1"}},
+		{"server[]", []string{"server@i: server web", "server@ii: server api", "server@iii: server"}},
+		{"route[GET]", []string{"route@iiii: route GET /api", "route@iiiii: route GET /web"}},
+		{"route[* /api].to", []string{"route>to@iiii,i: to api", "route>to@iiiiii,i: to api"}},
+		{"route[ GET  /api ]", []string{"route@iiii: route GET /api"}},
+		{"*.to", []string{"route>to@iiii,i: to api", "route>to@iiiii,i: to web", "route>to@iiiiii,i: to api"}},
+		{`weird\.name\[x\]`, []string{"weird.name[x]@iiiiiii: weird.name[x] 1"}},
+		{"server[web api]", nil},
+		{"nothing", nil},
+	}
+	for _, tt := range tests {
+		ms, err := cfg.Query(tt.sel)
+		if err != nil {
+			t.Errorf("Query(%q) error: %v", tt.sel, err)
+			continue
+		}
+		if got := matchStrings(ms); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Query(%q):\n got: %q\nwant: %q", tt.sel, got, tt.want)
+		}
+	}
+}
+
+func TestQuery_Invalid(t *testing.T) {
+	cfg := &ConfigurationUnit{}
+	tests := []struct{ sel, msg string }{
+		{"", "at offset 0: expected a name"},
+		{"a..b", "at offset 2: expected a name"},
+		{"a.", "at offset 2: expected a name"},
+		{"[x]", "at offset 0: expected a name"},
+		{"a[x", "at offset 3: missing ']'"},
+		{"a[x]b", "at offset 4: unexpected 'b'"},
+		{"a b", "at offset 1: unexpected ' '"},
+		{`a\`, "at offset 2: trailing backslash"},
+		{`a[x\`, "at offset 4: trailing backslash"},
+	}
+	for _, tt := range tests {
+		_, err := cfg.Query(tt.sel)
+		if err == nil || !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("Query(%q) error = %v, want %q", tt.sel, err, tt.msg)
+		}
+	}
+}
@@ -0,0 +1,431 @@
+package confetti
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrDuplicateDirective is wrapped by the *ParseError reported by Validate
+// for a directive that appears more than once in a block although its
+// schema does not declare it repeatable.
+var ErrDuplicateDirective = errors.New("duplicate directive")
+
+// Schema describes the directives allowed at the top level of a document,
+// or in a block. It is usually read from a Confetti document with
+// ParseSchema.
+type Schema struct {
+	Directives   []*DirectiveSchema
+	AllowUnknown bool // accept directives that are not declared
+}
+
+// DirectiveSchema describes a directive allowed by a [Schema].
+type DirectiveSchema struct {
+	Name       string
+	Doc        string   // description, for documentation only
+	Default    []string // default arguments, for documentation only
+	Required   bool     // the directive must appear
+	Repeatable bool     // the directive may appear more than once
+
+	// MinArgs and MaxArgs bound the number of arguments after the name.
+	// MaxArgs is -1 if there is no upper bound.
+	MinArgs, MaxArgs int
+
+	Type ArgType // type of each argument after the name
+
+	// Block is the schema of the directive's block, or nil if the directive
+	// cannot have one.
+	Block *Schema
+}
+
+// ArgType is the type of the arguments of a directive.
+type ArgType struct {
+	// Kind is one of string, int, uint, float, bool, duration, enum and
+	// regex, or empty, like string, to accept any argument.
+	Kind string
+
+	Values  []string       // values allowed by an enum
+	Pattern *regexp.Regexp // expression a regex argument must match
+}
+
+// ParseSchema reads a schema from a Confetti document. Each directive the
+// schema allows is declared with a directive statement, whose block lists
+// its properties:
+//
+//	directive port {
+//	    required
+//	    type int
+//	}
+//	directive server {
+//	    repeatable
+//	    args 1
+//	    block {
+//	        directive root { required }
+//	        directive timeout { type duration }
+//	        directive mode { type enum debug release }
+//	        directive name { type regex "^[a-z][a-z0-9-]*$" }
+//	    }
+//	}
+//
+// The properties are:
+//
+//	required          the directive must appear
+//	repeatable        the directive may appear more than once
+//	args MIN [MAX]    the number of arguments after the name; MAX is MIN if
+//	                  omitted, or * for no upper bound
+//	type KIND ...     the type of each argument: string, int, uint (a
+//	                  non-negative int), float, bool, duration, enum
+//	                  followed by the allowed values, or regex
+//	                  followed by an expression the argument must match,
+//	                  anchored with ^ and $ to match the whole argument
+//	block { ... }     the directive may have a block, holding the
+//	                  directives declared within
+//	doc TEXT          a description
+//	default ARGS...   the default arguments, for documentation
+//
+// Without args, a directive takes one argument if it has a type and any
+// number otherwise. The statement allow-unknown, at the top level of the
+// schema or in a block, allows directives that are not declared there.
+//
+// Errors in the schema are reported as a *ParseError, or an ErrorList if
+// there are several.
+func ParseSchema(input string) (*Schema, error) {
+	unit, err := Parse(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &schemaParser{}
+	s := p.schema(unit.Directives)
+	p.errors.Sort()
+	if err := p.errors.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// schemaParser holds the state of ParseSchema.
+type schemaParser struct {
+	errors ErrorList
+}
+
+func (p *schemaParser) errorf(pos Position, format string, args ...any) {
+	p.errors = append(p.errors, &ParseError{Line: pos.Line, Column: pos.Column, Msg: fmt.Sprintf(format, args...)})
+}
+
+// schema reads the statements of a schema block.
+func (p *schemaParser) schema(dirs []Directive) *Schema {
+	s := &Schema{}
+	seen := make(map[string]bool)
+	for _, d := range dirs {
+		switch d.Arguments[0] {
+		case "directive":
+			if len(d.Arguments) != 2 {
+				p.errorf(d.Span.Start, "directive takes a name")
+				continue
+			}
+			ds := p.directive(d)
+			if seen[ds.Name] {
+				p.errorf(d.ArgSpans[1].Start, "directive %q declared twice", ds.Name)
+				continue
+			}
+			seen[ds.Name] = true
+			s.Directives = append(s.Directives, ds)
+		case "allow-unknown":
+			if p.noArguments(d) {
+				s.AllowUnknown = true
+			}
+		default:
+			p.errorf(d.Span.Start, "unknown schema statement %q", d.Arguments[0])
+		}
+	}
+	return s
+}
+
+// directive reads a directive statement.
+func (p *schemaParser) directive(d Directive) *DirectiveSchema {
+	ds := &DirectiveSchema{Name: d.Arguments[1], MaxArgs: -1}
+	hasArgs := false
+	for _, st := range d.Subdirectives {
+		args := st.Arguments[1:]
+		switch st.Arguments[0] {
+		case "required":
+			ds.Required = p.noArguments(st)
+		case "repeatable":
+			ds.Repeatable = p.noArguments(st)
+		case "doc":
+			if len(args) != 1 || st.HasBlock() {
+				p.errorf(st.Span.Start, "doc takes one argument")
+				continue
+			}
+			ds.Doc = args[0]
+		case "default":
+			if len(args) == 0 || st.HasBlock() {
+				p.errorf(st.Span.Start, "default takes at least one argument")
+				continue
+			}
+			ds.Default = args
+		case "args":
+			hasArgs = true
+			p.args(st, ds)
+		case "type":
+			p.argType(st, ds)
+		case "block":
+			if len(args) != 0 || !st.HasBlock() {
+				p.errorf(st.Span.Start, "block takes a block and no arguments")
+				continue
+			}
+			ds.Block = p.schema(st.Subdirectives)
+		default:
+			p.errorf(st.Span.Start, "unknown property %q of directive %q", st.Arguments[0], ds.Name)
+		}
+	}
+	if !hasArgs && ds.Type.Kind != "" {
+		ds.MinArgs, ds.MaxArgs = 1, 1
+	}
+	return ds
+}
+
+// noArguments reports whether the statement d has no arguments and no
+// block, reporting an error if it does.
+func (p *schemaParser) noArguments(d Directive) bool {
+	if len(d.Arguments) > 1 || d.HasBlock() {
+		p.errorf(d.Span.Start, "%s takes no arguments", d.Arguments[0])
+		return false
+	}
+	return true
+}
+
+// args reads an args statement into ds.
+func (p *schemaParser) args(st Directive, ds *DirectiveSchema) {
+	args := st.Arguments[1:]
+	if len(args) < 1 || len(args) > 2 || st.HasBlock() {
+		p.errorf(st.Span.Start, "args takes a minimum and an optional maximum")
+		return
+	}
+	minArgs, err := strconv.Atoi(args[0])
+	if err != nil || minArgs < 0 {
+		p.errorf(st.ArgSpans[1].Start, "invalid minimum number of arguments %q", args[0])
+		return
+	}
+	maxArgs := minArgs
+	if len(args) == 2 {
+		if args[1] == "*" {
+			maxArgs = -1
+		} else if maxArgs, err = strconv.Atoi(args[1]); err != nil || maxArgs < minArgs {
+			p.errorf(st.ArgSpans[2].Start, "invalid maximum number of arguments %q", args[1])
+			return
+		}
+	}
+	ds.MinArgs, ds.MaxArgs = minArgs, maxArgs
+}
+
+// argType reads a type statement into ds.
+func (p *schemaParser) argType(st Directive, ds *DirectiveSchema) {
+	args := st.Arguments[1:]
+	if len(args) == 0 || st.HasBlock() {
+		p.errorf(st.Span.Start, "type takes a type name")
+		return
+	}
+	t := ArgType{Kind: args[0]}
+	switch t.Kind {
+	case "string", "int", "uint", "float", "bool", "duration":
+		if len(args) != 1 {
+			p.errorf(st.ArgSpans[2].Start, "type %s takes no parameters", t.Kind)
+			return
+		}
+	case "enum":
+		if len(args) < 2 {
+			p.errorf(st.Span.Start, "type enum needs at least one value")
+			return
+		}
+		t.Values = args[1:]
+	case "regex":
+		if len(args) != 2 {
+			p.errorf(st.Span.Start, "type regex takes one expression")
+			return
+		}
+		re, err := regexp.Compile(args[1])
+		if err != nil {
+			p.errorf(st.ArgSpans[2].Start, "invalid expression: %v", err)
+			return
+		}
+		t.Pattern = re
+	default:
+		p.errorf(st.ArgSpans[1].Start, "unknown type %q", t.Kind)
+		return
+	}
+	ds.Type = t
+}
+
+// check reports whether s is a valid argument of type t, and if not, why.
+func (t ArgType) check(s string) (string, bool) {
+	var err error
+	switch t.Kind {
+	case "int":
+		_, err = strconv.ParseInt(s, 10, 64)
+		return "is not an integer", err == nil
+	case "uint":
+		_, err = strconv.ParseUint(s, 10, 64)
+		return "is not a non-negative integer", err == nil
+	case "float":
+		_, err = strconv.ParseFloat(s, 64)
+		return "is not a number", err == nil
+	case "bool":
+		_, err = strconv.ParseBool(s)
+		return "is not a boolean", err == nil
+	case "duration":
+		_, err = time.ParseDuration(s)
+		return "is not a duration", err == nil
+	case "enum":
+		for _, v := range t.Values {
+			if s == v {
+				return "", true
+			}
+		}
+		return "is not one of " + strings.Join(t.Values, ", "), false
+	case "regex":
+		return "does not match " + t.Pattern.String(), t.Pattern.MatchString(s)
+	}
+	return "", true
+}
+
+// Validate checks cfg against schema and returns an error for each
+// directive that the schema does not allow, sorted by position:
+//
+//   - a directive not declared in its block, unless the block allows
+//     unknown directives, wrapping ErrUnknownDirective;
+//   - a required directive missing from a block, reported at the
+//     directive holding the block or at the start of the document,
+//     wrapping ErrMissingRequired;
+//   - a directive that is not repeatable appearing again, wrapping
+//     ErrDuplicateDirective;
+//   - a directive with too few or too many arguments, wrapping ErrArity;
+//   - an argument not of the declared type, reported at the argument,
+//     wrapping ErrConversion;
+//   - a block on a directive that cannot have one.
+//
+// It returns nil if cfg is valid. As the result is an ErrorList, a nil
+// result stored in an error variable is not a nil error; use its Err method
+// to get an error that is:
+//
+//	if err := confetti.Validate(cfg, schema).Err(); err != nil {
+//	    return err
+//	}
+func Validate(cfg *ConfigurationUnit, schema *Schema) ErrorList {
+	v := &validator{}
+	v.block(cfg.Directives, schema, nil)
+	v.errors.Sort()
+	return v.errors
+}
+
+// validator holds the state of a Validate call.
+type validator struct {
+	errors ErrorList
+}
+
+func (v *validator) errorf(d *Directive, pos Position, err error, format string, args ...any) {
+	v.errors = append(v.errors, &ParseError{
+		File:   d.File,
+		Line:   pos.Line,
+		Column: pos.Column,
+		Msg:    fmt.Sprintf(format, args...),
+		Err:    err,
+	})
+}
+
+// block validates dirs, the block of parent or the top level if parent is
+// nil, against s.
+func (v *validator) block(dirs []Directive, s *Schema, parent *Directive) {
+	first := make(map[string]*Directive)
+	for i := range dirs {
+		d := &dirs[i]
+		if len(d.Arguments) == 0 {
+			continue
+		}
+		name := d.Arguments[0]
+		ds := s.lookup(name)
+		if ds == nil {
+			if !s.AllowUnknown {
+				v.errorf(d, d.Span.Start, ErrUnknownDirective, "unknown directive %q", name)
+			}
+			continue
+		}
+		if f := first[name]; f != nil && !ds.Repeatable {
+			v.errorf(d, d.Span.Start, ErrDuplicateDirective, "%s repeated, first at line %d", name, f.Span.Start.Line)
+		} else if f == nil {
+			first[name] = d
+		}
+		v.directive(d, ds)
+	}
+
+	for _, ds := range s.Directives {
+		if !ds.Required || first[ds.Name] != nil {
+			continue
+		}
+		if parent == nil {
+			v.errors = append(v.errors, &ParseError{
+				Line:   1,
+				Column: 1,
+				Msg:    fmt.Sprintf("missing required directive %q", ds.Name),
+				Err:    ErrMissingRequired,
+			})
+			continue
+		}
+		v.errorf(parent, parent.Span.Start, ErrMissingRequired, "missing required directive %q in %s", ds.Name, parent.Arguments[0])
+	}
+}
+
+// directive validates d against ds.
+func (v *validator) directive(d *Directive, ds *DirectiveSchema) {
+	name, args := d.Arguments[0], d.Arguments[1:]
+	if len(args) < ds.MinArgs || (ds.MaxArgs >= 0 && len(args) > ds.MaxArgs) {
+		v.errorf(d, d.Span.Start, ErrArity, "%s takes %s, got %d", name, ds.argCount(), len(args))
+	}
+	for i, arg := range args {
+		if why, ok := ds.Type.check(arg); !ok {
+			pos := d.Span.Start
+			if i+1 < len(d.ArgSpans) {
+				pos = d.ArgSpans[i+1].Start
+			}
+			v.errorf(d, pos, ErrConversion, "%s: %q %s", name, arg, why)
+		}
+	}
+	switch {
+	case ds.Block != nil:
+		v.block(d.Subdirectives, ds.Block, d)
+	case d.HasBlock():
+		v.errorf(d, d.LeftBrace.Start, nil, "%s cannot have a block", name)
+	}
+}
+
+// lookup returns the schema of the directive name, or nil.
+func (s *Schema) lookup(name string) *DirectiveSchema {
+	for _, ds := range s.Directives {
+		if ds.Name == name {
+			return ds
+		}
+	}
+	return nil
+}
+
+// argCount describes the number of arguments ds allows.
+func (ds *DirectiveSchema) argCount() string {
+	plural := func(n int) string {
+		if n == 1 {
+			return "1 argument"
+		}
+		return strconv.Itoa(n) + " arguments"
+	}
+	switch {
+	case ds.MaxArgs < 0:
+		return "at least " + plural(ds.MinArgs)
+	case ds.MinArgs == ds.MaxArgs && ds.MinArgs == 0:
+		return "no arguments"
+	case ds.MinArgs == ds.MaxArgs:
+		return plural(ds.MinArgs)
+	}
+	return fmt.Sprintf("%d to %s", ds.MinArgs, plural(ds.MaxArgs))
+}
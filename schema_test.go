@@ -0,0 +1,175 @@
+package confetti
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const testSchema = `
+directive port {
+    required
+    type int
+    doc "port to listen on"
+    default 8080
+}
+directive mode { type enum debug release }
+directive workers { type uint }
+directive tags { args 0 * }
+directive server {
+    repeatable
+    args 1 2
+    block {
+        directive root { required }
+        directive timeout { type duration }
+        directive name { type regex "^[a-z][a-z0-9-]*$" }
+        directive extra {
+            block { allow-unknown }
+        }
+    }
+}
+`
+
+func TestParseSchema(t *testing.T) {
+	s, err := ParseSchema(testSchema)
+	if err != nil {
+		t.Fatalf("ParseSchema error: %v", err)
+	}
+	port := s.lookup("port")
+	if port == nil || !port.Required || port.Repeatable || port.MinArgs != 1 || port.MaxArgs != 1 ||
+		port.Type.Kind != "int" || port.Doc != "port to listen on" || strings.Join(port.Default, " ") != "8080" || port.Block != nil {
+		t.Errorf("port = %+v", port)
+	}
+	if tags := s.lookup("tags"); tags.MinArgs != 0 || tags.MaxArgs != -1 || tags.Type.Kind != "" {
+		t.Errorf("tags = %+v", tags)
+	}
+	server := s.lookup("server")
+	if !server.Repeatable || server.MinArgs != 1 || server.MaxArgs != 2 || server.Block == nil || len(server.Block.Directives) != 4 {
+		t.Errorf("server = %+v", server)
+	}
+	if extra := server.Block.lookup("extra"); extra.Block == nil || !extra.Block.AllowUnknown {
+		t.Errorf("extra = %+v", extra)
+	}
+}
+
+func TestParseSchema_Errors(t *testing.T) {
+	src := `directive
+directive a { args x }
+directive b { type int 3 }
+directive c { type regex "(" }
+directive d { color red }
+directive e { required yes }
+directive a
+limit 3
+directive f { args 2 1; block }
+directive g { type enum }
+`
+	_, err := ParseSchema(src)
+	var list ErrorList
+	if !errors.As(err, &list) {
+		t.Fatalf("got %v, want an ErrorList", err)
+	}
+	want := []string{
+		"1:1 directive takes a name",
+		`2:20 invalid minimum number of arguments "x"`,
+		"3:24 type int takes no parameters",
+		"4:26 invalid expression: error parsing regexp: missing closing ): `(`",
+		`5:15 unknown property "color" of directive "d"`,
+		"6:15 required takes no arguments",
+		`7:11 directive "a" declared twice`,
+		`8:1 unknown schema statement "limit"`,
+		`9:22 invalid maximum number of arguments "1"`,
+		"9:25 block takes a block and no arguments",
+		"10:15 type enum needs at least one value",
+	}
+	var got []string
+	for _, e := range list {
+		got = append(got, fmt.Sprintf("%d:%d %s", e.Line, e.Column, e.Msg))
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	s, err := ParseSchema(testSchema)
+	if err != nil {
+		t.Fatalf("ParseSchema error: %v", err)
+	}
+
+	valid := `port 8080
+mode debug
+tags
+server web {
+    root /srv
+    timeout 30s
+    name web-1
+    extra { anything goes { here } }
+}
+server api 2 { root /api }
+`
+	cfg, err := Parse(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := Validate(cfg, s); errs != nil {
+		t.Errorf("valid document: %v", errs)
+	}
+	if err := Validate(cfg, s).Err(); err != nil {
+		t.Errorf("valid document: Err() = %v", err)
+	}
+
+	invalid := `mode fast
+port 80 81
+port http
+workers -2
+server {
+    timeout soon
+    name Web
+    color red
+    root /a
+    root /b
+}
+server api; tags a b c
+mode debug { }
+`
+	cfg, err = Parse(invalid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := Validate(cfg, s)
+	want := []struct {
+		pos, msg string
+		err      error
+	}{
+		{"1:6", `mode: "fast" is not one of debug, release`, ErrConversion},
+		{"2:1", "port takes 1 argument, got 2", ErrArity},
+		{"3:1", "port repeated, first at line 2", ErrDuplicateDirective},
+		{"3:6", `port: "http" is not an integer`, ErrConversion},
+		{"4:9", `workers: "-2" is not a non-negative integer`, ErrConversion},
+		{"5:1", "server takes 1 to 2 arguments, got 0", ErrArity},
+		{"6:13", `timeout: "soon" is not a duration`, ErrConversion},
+		{"7:10", `name: "Web" does not match ^[a-z][a-z0-9-]*$`, ErrConversion},
+		{"8:5", `unknown directive "color"`, ErrUnknownDirective},
+		{"10:5", "root repeated, first at line 9", ErrDuplicateDirective},
+		{"12:1", `missing required directive "root" in server`, ErrMissingRequired},
+		{"13:1", "mode repeated, first at line 1", ErrDuplicateDirective},
+		{"13:12", "mode cannot have a block", nil},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("got %d errors, want %d:\n%v", len(errs), len(want), errs)
+	}
+	for i, w := range want {
+		e := errs[i]
+		if pos := fmt.Sprintf("%d:%d", e.Line, e.Column); pos != w.pos || e.Msg != w.msg || e.Err != w.err {
+			t.Errorf("error %d = %s %q (%v), want %s %q (%v)", i, pos, e.Msg, e.Err, w.pos, w.msg, w.err)
+		}
+	}
+
+	empty, _ := Parse("")
+	errs = Validate(empty, s)
+	if len(errs) != 1 || errs[0].Line != 1 || !errors.Is(errs[0], ErrMissingRequired) {
+		t.Errorf("empty document: %v", errs)
+	}
+}
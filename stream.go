@@ -0,0 +1,307 @@
+package confetti
+
+import (
+	"errors"
+	"io"
+)
+
+// EventType identifies the kind of an [Event].
+type EventType int
+
+// Event types.
+const (
+	EventStartDirective EventType = iota + 1 // a directive begins; its arguments follow
+	EventArgument                            // an argument of the current directive
+	EventStartBlock                          // the current directive's '{'
+	EventEndBlock                            // the current directive's '}'
+	EventEndDirective                        // the current directive is complete
+)
+
+// String returns a human-readable name for the event type.
+func (t EventType) String() string {
+	switch t {
+	case EventStartDirective:
+		return "start directive"
+	case EventArgument:
+		return "argument"
+	case EventStartBlock:
+		return "start block"
+	case EventEndBlock:
+		return "end block"
+	case EventEndDirective:
+		return "end directive"
+	}
+	return "unknown event"
+}
+
+// Event is a step in the structure of a document, as returned by
+// [Decoder.Next]. A directive is reported as
+//
+//	EventStartDirective, EventArgument..., [EventStartBlock, subdirectives..., EventEndBlock,] EventEndDirective
+type Event struct {
+	Type  EventType
+	Value string // the argument's value, for EventArgument
+	Depth int    // nesting depth of the directive the event belongs to; 0 at top level
+
+	// Span is the source range of the argument or brace; for
+	// EventEndDirective it covers the whole directive, like Directive.Span,
+	// and for EventStartDirective it is empty, at the first argument.
+	Span Span
+}
+
+// Decoder reads a document as a stream of events, without building the
+// directive tree, so that very large documents can be processed one
+// directive at a time and abandoned early.
+//
+//	dec := confetti.NewDecoder(r)
+//	for {
+//		ev, err := dec.Next()
+//		if err == io.EOF {
+//			break
+//		}
+//		...
+//	}
+type Decoder struct {
+	p       *Parser
+	started bool
+	err     error // sticky: io.EOF or the first error
+	state   decoderState
+
+	depth  int        // number of open blocks
+	args   int        // number of arguments of the current directive so far
+	start  Position   // start of the current directive
+	end    Position   // end of the current directive so far
+	starts []Position // starts of the directives whose blocks are open
+	last   EventType  // type of the event returned last
+}
+
+type decoderState int
+
+const (
+	stateDirectives decoderState = iota // expecting a directive, '}' or end of input
+	stateArguments                      // within a directive's arguments
+	stateBlockEnd                       // just past the '}' of the current directive's block
+)
+
+// NewDecoder returns a decoder reading from r with no extensions enabled.
+func NewDecoder(r io.Reader) *Decoder {
+	return NewDecoderWithOptions(r, Options{})
+}
+
+// NewDecoderWithOptions returns a decoder reading from r with the given
+// extension options and limits. Options.AllErrors is ignored: decoding
+// stops at the first error.
+func NewDecoderWithOptions(r io.Reader, opts Options) *Decoder {
+	return &Decoder{p: &Parser{lexer: NewLexerFromReader(r, opts), limits: opts.Limits}}
+}
+
+// Next returns the next event. At the end of the document it returns io.EOF.
+// Syntax errors are reported as *ParseError, exactly where Parse would
+// report them; after an error, Next keeps returning it.
+func (d *Decoder) Next() (Event, error) {
+	if d.err != nil {
+		return Event{}, d.err
+	}
+	ev, err := d.next()
+	if err != nil {
+		d.err = err
+		return Event{}, err
+	}
+	d.last = ev.Type
+	return ev, nil
+}
+
+func (d *Decoder) next() (Event, error) {
+	p := d.p
+	if !d.started {
+		d.started = true
+		if err := p.advance(); err != nil {
+			return Event{}, err
+		}
+	}
+
+	switch d.state {
+	case stateArguments:
+		for p.current.Type == TokenLineContinuation {
+			if err := p.advance(); err != nil {
+				return Event{}, err
+			}
+		}
+		if p.current.Type == TokenArgument {
+			if max := p.limits.MaxArguments; max > 0 && d.args == max {
+				return Event{}, limitError(p.current.Pos(), ErrTooManyArguments, max)
+			}
+			d.args++
+			ev := Event{Type: EventArgument, Value: p.current.Value, Depth: d.depth, Span: p.current.Span()}
+			d.end = ev.Span.End
+			return ev, p.advance()
+		}
+		return d.endArguments()
+
+	case stateBlockEnd:
+		// optional semicolon after block
+		if p.current.Type == TokenSemicolon {
+			if err := p.advance(); err != nil {
+				return Event{}, err
+			}
+		}
+		d.state = stateDirectives
+		return Event{Type: EventEndDirective, Depth: d.depth, Span: Span{Start: d.start, End: d.end}}, nil
+	}
+
+	// skip empty lines
+	for p.current.Type == TokenNewline {
+		if err := p.advance(); err != nil {
+			return Event{}, err
+		}
+	}
+
+	switch p.current.Type {
+	case TokenEOF:
+		if d.depth > 0 {
+			return Event{}, p.errf("expected '}', got %s", p.current.Type)
+		}
+		return Event{}, io.EOF
+
+	case TokenRightBrace:
+		if d.depth == 0 {
+			return Event{}, p.errf("unexpected '}' without matching '{'")
+		}
+		d.depth--
+		ev := Event{Type: EventEndBlock, Depth: d.depth, Span: p.current.Span()}
+		d.start, d.starts = d.starts[len(d.starts)-1], d.starts[:len(d.starts)-1]
+		d.end = ev.Span.End
+		d.state = stateBlockEnd
+		return ev, p.advance()
+	}
+
+	for p.current.Type == TokenLineContinuation {
+		if err := p.advance(); err != nil {
+			return Event{}, err
+		}
+	}
+	if p.current.Type != TokenArgument {
+		return Event{}, p.errf("directive must have at least one argument")
+	}
+	if max := p.limits.MaxDirectives; max > 0 {
+		if p.directives++; p.directives > max {
+			return Event{}, limitError(p.current.Pos(), ErrTooManyDirectives, max)
+		}
+	}
+	d.start = p.current.Pos()
+	d.args = 0
+	d.state = stateArguments
+	return Event{Type: EventStartDirective, Depth: d.depth, Span: Span{Start: d.start, End: d.start}}, nil
+}
+
+// endArguments handles what follows the arguments of a directive: a block
+// or the end of the directive.
+func (d *Decoder) endArguments() (Event, error) {
+	p := d.p
+	hasNewlines := p.current.Type == TokenNewline
+	for p.current.Type == TokenNewline {
+		if err := p.advance(); err != nil {
+			return Event{}, err
+		}
+	}
+
+	if p.current.Type == TokenLeftBrace {
+		if max := p.limits.MaxDepth; max > 0 && d.depth == max {
+			return Event{}, limitError(p.current.Pos(), ErrMaxDepth, max)
+		}
+		ev := Event{Type: EventStartBlock, Depth: d.depth, Span: p.current.Span()}
+		d.starts = append(d.starts, d.start)
+		d.depth++
+		d.state = stateDirectives
+		return ev, p.advance()
+	}
+
+	if !hasNewlines {
+		switch p.current.Type {
+		case TokenSemicolon:
+			if err := p.advance(); err != nil {
+				return Event{}, err
+			}
+		case TokenRightBrace, TokenEOF:
+		default:
+			return Event{}, p.errf("expected newline, semicolon, or block after directive, got %s", p.current.Type)
+		}
+	}
+	d.state = stateDirectives
+	return Event{Type: EventEndDirective, Depth: d.depth, Span: Span{Start: d.start, End: d.end}}, nil
+}
+
+// errNotAtDirective is returned by Skip and Directive when the last event
+// was not EventStartDirective.
+var errNotAtDirective = errors.New("confetti: Decoder is not at the start of a directive")
+
+// Skip discards the rest of the directive whose EventStartDirective was the
+// last event returned, including its block, up to and including its
+// EventEndDirective.
+func (d *Decoder) Skip() error {
+	if err := d.atDirective(); err != nil {
+		return err
+	}
+	depth := d.depth
+	for {
+		ev, err := d.Next()
+		if err != nil {
+			return err
+		}
+		if ev.Type == EventEndDirective && ev.Depth == depth {
+			return nil
+		}
+	}
+}
+
+// Directive reads the rest of the directive whose EventStartDirective was
+// the last event returned and returns it as a complete [Directive], with
+// its subdirectives and source positions. It lets a document be processed
+// one top-level directive at a time.
+func (d *Decoder) Directive() (Directive, error) {
+	if err := d.atDirective(); err != nil {
+		return Directive{}, err
+	}
+	return d.readDirective()
+}
+
+// atDirective returns an error unless the last event was EventStartDirective.
+func (d *Decoder) atDirective() error {
+	if d.err != nil {
+		return d.err
+	}
+	if d.last != EventStartDirective {
+		return errNotAtDirective
+	}
+	return nil
+}
+
+// readDirective builds a directive from the events following its
+// EventStartDirective.
+func (d *Decoder) readDirective() (Directive, error) {
+	var dir Directive
+	for {
+		ev, err := d.Next()
+		if err != nil {
+			return Directive{}, err
+		}
+		switch ev.Type {
+		case EventArgument:
+			dir.Arguments = append(dir.Arguments, ev.Value)
+			dir.ArgSpans = append(dir.ArgSpans, ev.Span)
+		case EventStartBlock:
+			dir.LeftBrace = ev.Span
+		case EventStartDirective:
+			sub, err := d.readDirective()
+			if err != nil {
+				return Directive{}, err
+			}
+			dir.Subdirectives = append(dir.Subdirectives, sub)
+		case EventEndBlock:
+			dir.RightBrace = ev.Span
+		case EventEndDirective:
+			dir.Span = ev.Span
+			return dir, nil
+		}
+	}
+}
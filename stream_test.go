@@ -0,0 +1,177 @@
+package confetti
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// eventString renders an event compactly for comparison in tests.
+func eventString(ev Event) string {
+	switch ev.Type {
+	case EventStartDirective:
+		return fmt.Sprintf("%d:start", ev.Depth)
+	case EventArgument:
+		return fmt.Sprintf("%d:arg %s", ev.Depth, ev.Value)
+	case EventStartBlock:
+		return fmt.Sprintf("%d:{", ev.Depth)
+	case EventEndBlock:
+		return fmt.Sprintf("%d:}", ev.Depth)
+	case EventEndDirective:
+		return fmt.Sprintf("%d:end", ev.Depth)
+	}
+	return ev.Type.String()
+}
+
+func TestDecoder_Events(t *testing.T) {
+	src := "server web {\n  listen 80; root /srv\n  empty {}\n}\nkey \"a b\"\n"
+	dec := NewDecoder(strings.NewReader(src))
+	var got []string
+	for {
+		ev, err := dec.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next error: %v", err)
+		}
+		got = append(got, eventString(ev))
+	}
+	want := []string{
+		"0:start", "0:arg server", "0:arg web", "0:{",
+		"1:start", "1:arg listen", "1:arg 80", "1:end",
+		"1:start", "1:arg root", "1:arg /srv", "1:end",
+		"1:start", "1:arg empty", "1:{", "1:}", "1:end",
+		"0:}", "0:end",
+		"0:start", "0:arg key", "0:arg a b", "0:end",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("events:\n got: %q\nwant: %q", got, want)
+	}
+	if _, err := dec.Next(); err != io.EOF {
+		t.Fatalf("Next after the end = %v, want io.EOF", err)
+	}
+}
+
+// readAll rebuilds a document from a decoder's events.
+func readAll(dec *Decoder) (*ConfigurationUnit, error) {
+	unit := &ConfigurationUnit{}
+	for {
+		ev, err := dec.Next()
+		if err == io.EOF {
+			return unit, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ev.Type != EventStartDirective {
+			return nil, fmt.Errorf("unexpected %s event at top level", ev.Type)
+		}
+		d, err := dec.Directive()
+		if err != nil {
+			return nil, err
+		}
+		unit.Directives = append(unit.Directives, d)
+	}
+}
+
+func TestDecoder_SameAsParse(t *testing.T) {
+	tests := []struct {
+		src  string
+		opts Options
+	}{
+		{"", Options{}},
+		{"a 1; b 2 ;c 3;\n", Options{}},
+		{"server web {\n    # comment\n    listen 80\n\n    loc / { root /var }\n}\n", Options{}},
+		{"server\n# why not\n{\n  x 1\n}; after 1\n", Options{}},
+		{"a {}\nb {\n\n}\nc {} d 1\n", Options{}},
+		{"a one \\\n    two \\\n  three\n", Options{}},
+		{"text \"\"\"line one\n  line two\"\"\" after\n", Options{}},
+		{"a 1\r\nb {\r\n  c 2\r\n}\r\n", Options{}},
+		{"// head\na 1 /* mid */ 2 // tail\n", Options{CStyleComments: true}},
+		{"if (x > (1)) { y }\nuser:=smith\n", Options{ExpressionArguments: true, PunctuatorArguments: []string{":="}}},
+		// errors
+		{"a {\n", Options{}},
+		{"a\n}\n", Options{}},
+		{"a {\n  b {\n}\n", Options{}},
+		{"; a\n", Options{}},
+		{"\\\n;\n", Options{}},
+		{"a \"open\n", Options{}},
+		{"a {\n  b \x01\n}\n", Options{}},
+		{"a 1\nb \xff\n", Options{}},
+	}
+	for _, tt := range tests {
+		want, wantErr := ParseWithOptions(tt.src, tt.opts)
+		got, err := readAll(NewDecoderWithOptions(strings.NewReader(tt.src), tt.opts))
+		if !reflect.DeepEqual(err, wantErr) {
+			t.Errorf("%q: error = %v, want %v", tt.src, err, wantErr)
+			continue
+		}
+		if wantErr == nil && !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: mismatch:\n got: %#v\nwant: %#v", tt.src, got, want)
+		}
+	}
+}
+
+func TestDecoder_SkipAndStopEarly(t *testing.T) {
+	src := "route a { via 1 { x } }\nroute b { via 2 }\nroute c { via 3 }\n}"
+	dec := NewDecoder(strings.NewReader(src))
+	var names []string
+	for len(names) < 2 {
+		ev, err := dec.Next()
+		if err != nil {
+			t.Fatalf("Next error: %v", err)
+		}
+		if ev.Type != EventStartDirective {
+			t.Fatalf("got %s event, want start directive", ev.Type)
+		}
+		if _, err := dec.Next(); err != nil { // the name
+			t.Fatalf("Next error: %v", err)
+		}
+		arg, err := dec.Next()
+		if err != nil {
+			t.Fatalf("Next error: %v", err)
+		}
+		names = append(names, arg.Value)
+		if err := dec.Skip(); err != errNotAtDirective {
+			t.Fatalf("Skip after an argument = %v, want errNotAtDirective", err)
+		}
+		for ev.Type != EventEndDirective || ev.Depth != 0 {
+			if ev, err = dec.Next(); err != nil {
+				t.Fatalf("Next error: %v", err)
+			}
+		}
+	}
+
+	// the stray '}' at the end is never reached
+	if want := []string{"a", "b"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("names = %q, want %q", names, want)
+	}
+
+	if _, err := dec.Next(); err != nil {
+		t.Fatalf("Next error: %v", err)
+	}
+	if err := dec.Skip(); err != nil {
+		t.Fatalf("Skip error: %v", err)
+	}
+	if _, err := dec.Next(); err == nil || !strings.Contains(err.Error(), "unexpected '}'") {
+		t.Fatalf("got %v, want the stray brace error", err)
+	}
+}
+
+func TestDecoder_Spans(t *testing.T) {
+	src := "a {\n  b 1\n}\n"
+	dec := NewDecoder(strings.NewReader(src))
+	u, err := readAll(dec)
+	if err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if got, want := u.Directives[0].Span, span(1, 1, 0, 3, 2, 11); got != want {
+		t.Errorf("directive span = %v, want %v", got, want)
+	}
+	if got, want := u.Directives[0].Subdirectives[0].Span, span(2, 3, 6, 2, 6, 9); got != want {
+		t.Errorf("subdirective span = %v, want %v", got, want)
+	}
+}
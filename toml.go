@@ -0,0 +1,630 @@
+package confetti
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ParseTOML reads a TOML document into a ConfigurationUnit: tables and
+// arrays of tables become blocks, dotted keys nested blocks, arrays of
+// scalars directives with one argument per element, and arrays of arrays one
+// directive per element. Values become arguments as written, except that
+// integers are converted to decimal and underscores are removed from
+// numbers; strings, numbers, booleans and dates are not told apart.
+//
+// The losses report the comments and the arrays that could not be mapped
+// exactly. A syntax error, a table defined twice or a string holding a
+// forbidden character is reported as a *ParseError. Inline tables must be
+// written on one line, and tables defined by dotted keys or inline may be
+// extended, which TOML forbids.
+func ParseTOML(input string) (*ConfigurationUnit, []Loss, error) {
+	p := &tomlParser{src: strings.ReplaceAll(input, "\r\n", "\n"), line: 1, root: newValueTable(), defined: make(map[*valueTable]bool), im: &importer{}}
+	if err := p.parse(); err != nil {
+		return nil, nil, err
+	}
+	return &ConfigurationUnit{Directives: p.im.directives(p.root)}, p.im.report(), nil
+}
+
+// tomlParser reads a TOML document into a valueTable.
+type tomlParser struct {
+	src       string
+	pos       int
+	line      int
+	lineStart int // offset of the current line
+	root      *valueTable
+	defined   map[*valueTable]bool // tables with a header
+	im        *importer
+}
+
+func (p *tomlParser) errorf(format string, args ...any) error {
+	return errorAt(p.position(), format, args...)
+}
+
+// position returns the position of the next character.
+func (p *tomlParser) position() Position {
+	return Position{Offset: p.pos, Line: p.line, Column: utf8.RuneCountInString(p.src[p.lineStart:p.pos]) + 1}
+}
+
+func errorAt(pos Position, format string, args ...any) error {
+	return &ParseError{Line: pos.Line, Column: pos.Column, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *tomlParser) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *tomlParser) newline() {
+	p.pos++
+	p.line++
+	p.lineStart = p.pos
+}
+
+// space skips spaces and tabs.
+func (p *tomlParser) space() {
+	for p.peek() == ' ' || p.peek() == '\t' {
+		p.pos++
+	}
+}
+
+// blank skips whitespace, newlines and comments.
+func (p *tomlParser) blank() {
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case ' ', '\t':
+			p.pos++
+		case '\n':
+			p.newline()
+		case '#':
+			p.skipComment()
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) skipComment() {
+	p.im.comment(p.line)
+	for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+		p.pos++
+	}
+}
+
+// endLine skips the rest of a line holding a key/value pair or a header.
+func (p *tomlParser) endLine() error {
+	p.space()
+	if p.peek() == '#' {
+		p.skipComment()
+	}
+	switch p.peek() {
+	case 0:
+		return nil
+	case '\n':
+		p.newline()
+		return nil
+	}
+	return p.errorf("expected the end of the line, found %q", p.peek())
+}
+
+func (p *tomlParser) parse() error {
+	cur := p.root
+	for {
+		p.blank()
+		if p.pos >= len(p.src) {
+			return nil
+		}
+		var err error
+		switch {
+		case strings.HasPrefix(p.src[p.pos:], "[["):
+			p.pos += 2
+			at := p.position()
+			var keys []string
+			if keys, err = p.key(); err != nil {
+				return err
+			}
+			p.space()
+			if !strings.HasPrefix(p.src[p.pos:], "]]") {
+				return p.errorf("expected ]] after the table name")
+			}
+			p.pos += 2
+			if cur, err = p.arrayTable(keys, at); err != nil {
+				return err
+			}
+		case p.peek() == '[':
+			p.pos++
+			at := p.position()
+			var keys []string
+			if keys, err = p.key(); err != nil {
+				return err
+			}
+			p.space()
+			if p.peek() != ']' {
+				return p.errorf("expected ] after the table name")
+			}
+			p.pos++
+			if cur, err = p.table(p.root, keys, at); err != nil {
+				return err
+			}
+			if p.defined[cur] {
+				return errorAt(at, "table %q defined twice", strings.Join(keys, "."))
+			}
+			p.defined[cur] = true
+		default:
+			if err := p.keyValue(cur); err != nil {
+				return err
+			}
+		}
+		if err := p.endLine(); err != nil {
+			return err
+		}
+	}
+}
+
+// keyValue reads a key/value pair into t.
+func (p *tomlParser) keyValue(t *valueTable) error {
+	p.space()
+	at := p.position()
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	p.space()
+	if p.peek() != '=' {
+		return p.errorf("expected = after the key")
+	}
+	p.pos++
+	p.space()
+	v, err := p.value()
+	if err != nil {
+		return err
+	}
+	if t, err = p.table(t, keys[:len(keys)-1], at); err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	if _, ok := t.vals[last]; ok {
+		return errorAt(at, "duplicate key %q", last)
+	}
+	t.set(last, v, at.Line)
+	return nil
+}
+
+// table returns the table at the path keys from t, adding the tables that
+// are missing. A key holding an array of tables leads to its last table.
+func (p *tomlParser) table(t *valueTable, keys []string, at Position) (*valueTable, error) {
+	for _, k := range keys {
+		switch v := t.vals[k].(type) {
+		case nil:
+			if _, ok := t.vals[k]; ok {
+				return nil, errorAt(at, "key %q is not a table", k)
+			}
+			nt := newValueTable()
+			t.set(k, nt, at.Line)
+			t = nt
+		case *valueTable:
+			t = v
+		case []any:
+			last, ok := v[len(v)-1].(*valueTable)
+			if !ok {
+				return nil, errorAt(at, "key %q is not a table", k)
+			}
+			t = last
+		default:
+			return nil, errorAt(at, "key %q is not a table", k)
+		}
+	}
+	return t, nil
+}
+
+// arrayTable adds a table to the array of tables at the path keys and
+// returns it.
+func (p *tomlParser) arrayTable(keys []string, at Position) (*valueTable, error) {
+	parent, err := p.table(p.root, keys[:len(keys)-1], at)
+	if err != nil {
+		return nil, err
+	}
+	last := keys[len(keys)-1]
+	nt := newValueTable()
+	switch v := parent.vals[last].(type) {
+	case nil:
+		if _, ok := parent.vals[last]; ok {
+			break
+		}
+		parent.set(last, []any{nt}, at.Line)
+		return nt, nil
+	case []any:
+		if _, ok := v[0].(*valueTable); ok {
+			parent.vals[last] = append(v, nt)
+			return nt, nil
+		}
+	}
+	return nil, errorAt(at, "key %q is not an array of tables", last)
+}
+
+// key reads a possibly dotted key.
+func (p *tomlParser) key() ([]string, error) {
+	var keys []string
+	for {
+		p.space()
+		var k string
+		var err error
+		switch p.peek() {
+		case '"':
+			k, err = p.basicString()
+		case '\'':
+			k, err = p.literalString()
+		default:
+			start := p.pos
+			for p.pos < len(p.src) && isBareKeyChar(p.src[p.pos]) {
+				p.pos++
+			}
+			if p.pos == start {
+				return nil, p.errorf("expected a key")
+			}
+			k = p.src[start:p.pos]
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+		p.space()
+		if p.peek() != '.' {
+			return keys, nil
+		}
+		p.pos++
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_' || c == '-'
+}
+
+var datePattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+// value reads a value: a string, a scalar kept as text, an array or an
+// inline table.
+func (p *tomlParser) value() (any, error) {
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], `"""`):
+		return p.multilineString(`"""`)
+	case strings.HasPrefix(p.src[p.pos:], `'''`):
+		return p.multilineString(`'''`)
+	case p.peek() == '"':
+		return p.basicString()
+	case p.peek() == '\'':
+		return p.literalString()
+	case p.peek() == '[':
+		return p.array()
+	case p.peek() == '{':
+		return p.inlineTable()
+	}
+
+	start := p.pos
+	p.scalarToken()
+	// a date may be separated from its time by a space
+	if datePattern.MatchString(p.src[start:p.pos]) && p.pos+1 < len(p.src) && p.src[p.pos] == ' ' && isDigit(p.src[p.pos+1]) {
+		p.pos++
+		p.scalarToken()
+	}
+	tok := p.src[start:p.pos]
+	switch {
+	case tok == "":
+		return nil, p.errorf("expected a value")
+	case tok == "true" || tok == "false":
+		return tok, nil
+	case isDigit(tok[0]) && (len(tok) > 4 && tok[4] == '-' || len(tok) > 2 && tok[2] == ':'):
+		return tok, nil // date or time
+	}
+	if num, ok := tomlNumber(tok); ok {
+		return num, nil
+	}
+	p.pos = start
+	return nil, p.errorf("invalid value %q", tok)
+}
+
+// tomlNumber returns the number tok as an argument: integers in decimal,
+// floats without underscores.
+func tomlNumber(tok string) (string, bool) {
+	digits := strings.TrimLeft(tok, "+-")
+	if len(digits) > 1 && digits[0] == '0' && isDigit(digits[1]) {
+		return "", false // leading zeros, which ParseInt reads as octal
+	}
+	if n, err := strconv.ParseInt(tok, 0, 64); err == nil {
+		return strconv.FormatInt(n, 10), true
+	}
+	num := strings.ReplaceAll(tok, "_", "")
+	if _, err := strconv.ParseFloat(num, 64); err == nil {
+		return num, true
+	}
+	return "", false
+}
+
+// scalarToken skips the characters of a number, boolean or date.
+func (p *tomlParser) scalarToken() {
+	for p.pos < len(p.src) && !strings.ContainsRune(" \t\n,]}#", rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// basicString reads a string in double quotes.
+func (p *tomlParser) basicString() (string, error) {
+	start := p.position()
+	p.pos++
+	var sb strings.Builder
+	for {
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.src[p.pos]
+		switch c {
+		case '"':
+			p.pos++
+			return tomlString(sb.String(), start)
+		case '\\':
+			r, n, ok := unescape(p.src[p.pos+1:])
+			if !ok {
+				return "", p.errorf("invalid escape sequence")
+			}
+			sb.WriteRune(r)
+			p.pos += 1 + n
+		default:
+			sb.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+// literalString reads a string in single quotes.
+func (p *tomlParser) literalString() (string, error) {
+	start := p.position()
+	p.pos++
+	end := strings.IndexAny(p.src[p.pos:], "'\n")
+	if end < 0 || p.src[p.pos+end] != '\'' {
+		return "", p.errorf("unterminated string")
+	}
+	s := p.src[p.pos : p.pos+end]
+	p.pos += end + 1
+	return tomlString(s, start)
+}
+
+// multilineString reads a string between triple quotes delim, where a
+// newline right after the opening quotes is dropped.
+func (p *tomlParser) multilineString(delim string) (string, error) {
+	start := p.position()
+	p.pos += len(delim)
+	if p.peek() == '\n' {
+		p.newline()
+	}
+	var sb strings.Builder
+	for {
+		if p.pos >= len(p.src) {
+			return "", errorAt(start, "unterminated multi-line string")
+		}
+		if strings.HasPrefix(p.src[p.pos:], delim) {
+			// up to two quotes may precede the closing ones
+			for i := 0; i < 2 && strings.HasPrefix(p.src[p.pos+1:], delim); i++ {
+				sb.WriteByte(delim[0])
+				p.pos++
+			}
+			p.pos += len(delim)
+			return tomlString(sb.String(), start)
+		}
+		c := p.src[p.pos]
+		switch {
+		case c == '\n':
+			sb.WriteByte(c)
+			p.newline()
+		case c == '\\' && delim == `"""`:
+			// a backslash at the end of a line trims the whitespace after it
+			rest := strings.TrimLeft(p.src[p.pos+1:], " \t")
+			if strings.HasPrefix(rest, "\n") {
+				p.pos = len(p.src) - len(rest)
+				for p.pos < len(p.src) && strings.ContainsRune(" \t\n", rune(p.src[p.pos])) {
+					if p.src[p.pos] == '\n' {
+						p.newline()
+					} else {
+						p.pos++
+					}
+				}
+				continue
+			}
+			r, n, ok := unescape(p.src[p.pos+1:])
+			if !ok {
+				return "", p.errorf("invalid escape sequence")
+			}
+			sb.WriteRune(r)
+			p.pos += 1 + n
+		default:
+			sb.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+// tomlString returns s, read from the string starting at start, or a
+// *ParseError if s holds a forbidden character.
+func tomlString(s string, start Position) (string, error) {
+	if msg := forbiddenIn(s); msg != "" {
+		return "", errorAt(start, "%s", msg)
+	}
+	return s, nil
+}
+
+// array reads an array, which may span lines.
+func (p *tomlParser) array() (any, error) {
+	p.pos++
+	elems := []any{}
+	for {
+		p.blank()
+		if p.peek() == ']' {
+			p.pos++
+			return elems, nil
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, v)
+		p.blank()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+			p.pos++
+			return elems, nil
+		default:
+			return nil, p.errorf("expected , or ] in array")
+		}
+	}
+}
+
+// inlineTable reads an inline table.
+func (p *tomlParser) inlineTable() (any, error) {
+	p.pos++
+	t := newValueTable()
+	p.space()
+	if p.peek() == '}' {
+		p.pos++
+		return t, nil
+	}
+	for {
+		if err := p.keyValue(t); err != nil {
+			return nil, err
+		}
+		p.space()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return t, nil
+		default:
+			return nil, p.errorf("expected , or } in inline table")
+		}
+	}
+}
+
+// MarshalTOML returns the TOML encoding of cf. Blocks become tables, nested
+// under their inline arguments, repeated blocks arrays of tables, and
+// directives with several arguments or repeated arrays. Arguments that are
+// decimal numbers or true or false are written as such, the others as
+// strings.
+//
+// The losses report the directives that could not be mapped exactly: inline
+// arguments, repeated directives with one argument each, which read back as
+// a single directive, directives written before the tables of their level
+// and directives whose name also has a block.
+func MarshalTOML(cf *ConfigurationUnit) ([]byte, []Loss, error) {
+	ex := &exporter{}
+	w := &tomlWriter{ex: ex}
+	w.table(nil, ex.tree(cf.Directives), false)
+	return []byte(w.sb.String()), ex.report(), nil
+}
+
+// tomlWriter writes a keyTree as TOML.
+type tomlWriter struct {
+	sb strings.Builder
+	ex *exporter
+}
+
+// table writes the entries of t, the table at path, preceded by its
+// header unless it is the root table.
+func (w *tomlWriter) table(path []string, t *keyTree, array bool) {
+	// a table holding nothing but tables needs no header, unless it is in
+	// an array
+	implicit := !array && len(t.keys) > 0
+	for _, k := range t.keys {
+		if leaves, _ := t.split(k); len(leaves) > 0 {
+			implicit = false
+		}
+	}
+	if len(path) > 0 && !implicit {
+		if w.sb.Len() > 0 {
+			w.sb.WriteByte('\n')
+		}
+		header := tomlPath(path)
+		if array {
+			fmt.Fprintf(&w.sb, "[[%s]]\n", header)
+		} else {
+			fmt.Fprintf(&w.sb, "[%s]\n", header)
+		}
+	}
+	w.ex.movedLeaves(t, "tables")
+	for _, k := range t.keys {
+		leaves, _ := w.ex.entries(t, k)
+		switch len(leaves) {
+		case 0:
+		case 1:
+			fmt.Fprintf(&w.sb, "%s = %s\n", tomlKey(k), tomlValue(leaves[0].args))
+		default:
+			single := singleArgs(leaves)
+			elems := make([]string, len(leaves))
+			for i, l := range leaves {
+				elems[i] = tomlValue(l.args)
+				if !single && len(l.args) == 1 {
+					elems[i] = "[" + elems[i] + "]"
+				}
+			}
+			fmt.Fprintf(&w.sb, "%s = [%s]\n", tomlKey(k), strings.Join(elems, ", "))
+		}
+	}
+	for _, k := range t.keys {
+		_, trees := t.split(k)
+		sub := append(path[:len(path):len(path)], k)
+		for _, st := range trees {
+			w.table(sub, st, len(trees) > 1)
+		}
+	}
+}
+
+// tomlValue returns the TOML value for args: a scalar for a single
+// argument, an array otherwise.
+func tomlValue(args []string) string {
+	if len(args) == 1 {
+		return tomlScalar(args[0])
+	}
+	elems := make([]string, len(args))
+	for i, arg := range args {
+		elems[i] = tomlScalar(arg)
+	}
+	return "[" + strings.Join(elems, ", ") + "]"
+}
+
+// tomlScalar returns s as a TOML number or boolean if it reads as one, and
+// as a string otherwise.
+func tomlScalar(s string) string {
+	if isNumber(s) || s == "true" || s == "false" {
+		return s
+	}
+	return quoteEscaped(s)
+}
+
+// tomlKey returns k as a bare key if possible, and quoted otherwise.
+func tomlKey(k string) string {
+	for i := 0; i < len(k); i++ {
+		if !isBareKeyChar(k[i]) {
+			return quoteEscaped(k)
+		}
+	}
+	if k == "" {
+		return `""`
+	}
+	return k
+}
+
+func tomlPath(path []string) string {
+	keys := make([]string, len(path))
+	for i, k := range path {
+		keys[i] = tomlKey(k)
+	}
+	return strings.Join(keys, ".")
+}
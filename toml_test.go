@@ -0,0 +1,206 @@
+package confetti
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	src := `# service
+title = "TOML \"example\" \u00e9"
+port = 8_080
+mask = 0o755
+ratio = 1e3
+enabled = true
+born = 1979-05-27 07:32:00Z
+tags = ["a", "b c"]  # inline comment
+matrix = [
+  [1, 2],
+  [3],
+]
+mixed = [1, { a = 1 }]
+none = []
+point = { x = 1, y.z = 2 }
+text = """
+one
+two \
+   three"""
+path = '''C:\dir'''
+
+[server.api]
+timeout = "30s"
+
+[[plugin]]
+name = "a"
+
+[[plugin]]
+name = "b"
+
+[plugin.opts]
+level = 2
+`
+	cf, losses, err := ParseTOML(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Marshal(cf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `title "TOML \"example\" é"
+port 8080
+mask 493
+ratio 1e3
+enabled true
+born "1979-05-27 07:32:00Z"
+tags a "b c"
+matrix 1 2
+matrix 3
+mixed 1
+mixed {
+    a 1
+}
+none
+point {
+    x 1
+    y {
+        z 2
+    }
+}
+text """one
+two three"""
+path "C:\\dir"
+server {
+    api {
+        timeout 30s
+    }
+}
+plugin {
+    name a
+}
+plugin {
+    name b
+    opts {
+        level 2
+    }
+}
+`
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	wantLosses := []Loss{
+		{Line: 1, Msg: "2 comments dropped"},
+		{Line: 13, Msg: "mixed: array mixing values of different kinds written as repeated directives"},
+	}
+	if !reflect.DeepEqual(losses, wantLosses) {
+		t.Errorf("losses %v, want %v", losses, wantLosses)
+	}
+}
+
+func TestParseTOML_Errors(t *testing.T) {
+	tests := []struct {
+		src       string
+		line, col int
+	}{
+		{"a = 1\na = 2\n", 2, 1},
+		{"a = \"open\n", 1, 10},
+		{"a = 1 2\n", 1, 7},
+		{"a = 1\n[a.b]\n", 2, 2},
+		{"[t\n", 1, 3},
+		{"a = [1, 2\n", 2, 1},
+		{"a = 017\n", 1, 5},
+		{"a = x\n", 1, 5},
+		{"[a]\nb = 1\n[a]\n", 3, 2},
+		{"[a.b]\n[a]\n[a.b]\n", 3, 2},
+		{"a = 1\nb = \"x\\u0000\"\n", 2, 5},
+		{"a = ['x', '\x01']\n", 1, 11},
+		{"\"k\\u0001\" = 1\n", 1, 1},
+		{"a = \"\"\"\nx\\u007F\"\"\"\n", 1, 5},
+	}
+	for _, tt := range tests {
+		_, _, err := ParseTOML(tt.src)
+		var perr *ParseError
+		if !errors.As(err, &perr) || perr.Line != tt.line || perr.Column != tt.col {
+			t.Errorf("%q: got %v, want an error at %d:%d", tt.src, err, tt.line, tt.col)
+		}
+	}
+}
+
+func TestMarshalTOML(t *testing.T) {
+	cf, err := Parse(`name "my app"
+port 8080
+ratio 0.5
+debug true
+hosts a b
+flag
+plugin a
+plugin b
+route 1 2
+route 3
+log {
+    level info
+}
+server api {
+    port 80
+}
+server web {
+    port 81
+}
+worker { id 1 }
+worker { id 2 }
+late x
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, losses, err := MarshalTOML(cf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `name = "my app"
+port = 8080
+ratio = 0.5
+debug = true
+hosts = ["a", "b"]
+flag = []
+plugin = ["a", "b"]
+route = [[1, 2], [3]]
+late = "x"
+
+[log]
+level = "info"
+
+[server.api]
+port = 80
+
+[server.web]
+port = 81
+
+[[worker]]
+id = 1
+
+[[worker]]
+id = 2
+`
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	wantLosses := []Loss{
+		{Line: 8, Msg: "plugin: repeated directive written as an array"},
+		{Line: 14, Msg: "server: inline arguments written as nested keys"},
+		{Line: 17, Msg: "server: inline arguments written as nested keys"},
+		{Line: 22, Msg: "late: moved before the tables"},
+	}
+	if !reflect.DeepEqual(losses, wantLosses) {
+		t.Errorf("losses %v, want %v", losses, wantLosses)
+	}
+
+	back, _, err := ParseTOML(string(got))
+	if err != nil {
+		t.Fatalf("output does not parse: %v", err)
+	}
+	if d := back.Find("route"); d == nil || len(back.FindAll("route")) != 2 {
+		t.Errorf("route did not read back as two directives:\n%s", back)
+	}
+}
@@ -1,6 +1,7 @@
 package confetti
 
 import (
+	"fmt"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -53,6 +54,44 @@ func printDirectives(sb *strings.Builder, directives []Directive, indent int) {
 type Directive struct {
 	Arguments     []string
 	Subdirectives []Directive
+
+	// Source positions, set by the parser. They are zero for directives
+	// constructed by hand.
+	Span       Span   // from the first argument through the last argument or closing brace
+	ArgSpans   []Span // source range of each argument, parallel to Arguments
+	LeftBrace  Span   // the block's '{', zero if the directive has no block
+	RightBrace Span   // the block's '}', zero if the directive has no block
+
+	// File is the name of the file the directive was read from, set by
+	// ParseFS. Its Span positions refer to that file.
+	File string
+}
+
+// HasBlock reports whether the directive has a block, including an empty one.
+func (d *Directive) HasBlock() bool {
+	return len(d.Subdirectives) > 0 || d.LeftBrace.Start.IsValid()
+}
+
+// Position describes a location in the source text.
+type Position struct {
+	Offset int // 0-based byte offset
+	Line   int // 1-based line
+	Column int // 1-based column, counted in runes
+}
+
+// IsValid reports whether the position has been set.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Span is the half-open source range [Start, End) of a syntax element.
+type Span struct {
+	Start Position // first character of the element
+	End   Position // position just past the last character of the element
 }
 
 // TokenType represents the type of token
@@ -99,6 +138,18 @@ type Token struct {
 	Value  string
 	Line   int
 	Column int
+	Offset int      // 0-based byte offset of the token's first character
+	End    Position // position just past the token's last character
+}
+
+// Pos returns the position of the token's first character.
+func (t Token) Pos() Position {
+	return Position{Offset: t.Offset, Line: t.Line, Column: t.Column}
+}
+
+// Span returns the source range covered by the token.
+func (t Token) Span() Span {
+	return Span{Start: t.Pos(), End: t.End}
 }
 
 // ValidateUTF8 checks if the input string is valid UTF-8
@@ -0,0 +1,683 @@
+package confetti
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ParseYAML reads the first document of a YAML stream into a
+// ConfigurationUnit. The document must be a mapping: mappings become
+// blocks, sequences of scalars directives with one argument per element,
+// sequences of mappings or sequences one directive per element, and null
+// values directives without arguments. Scalars become arguments as written;
+// strings, numbers and booleans are not told apart.
+//
+// The subset read is the block style with flow collections on one line,
+// quoted and plain scalars on one line, and literal and folded block
+// scalars. The losses report the comments, the anchors, aliases and tags,
+// which are ignored, the documents after the first and the sequences that
+// could not be mapped exactly. A syntax error, an unsupported construct or
+// a scalar holding a forbidden character is reported as a *ParseError.
+func ParseYAML(input string) (*ConfigurationUnit, []Loss, error) {
+	p := &yamlParser{lines: strings.Split(strings.ReplaceAll(input, "\r\n", "\n"), "\n"), im: &importer{}}
+	root, err := p.block(0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if l, ok := p.cur(); ok {
+		return nil, nil, &ParseError{Line: l.num, Column: l.indent + 1, Msg: "unexpected content"}
+	}
+	switch root := root.(type) {
+	case nil:
+		return &ConfigurationUnit{Directives: []Directive{}}, p.im.report(), nil
+	case *valueTable:
+		return &ConfigurationUnit{Directives: p.im.directives(root)}, p.im.report(), nil
+	}
+	return nil, nil, &ParseError{Line: p.first, Column: 1, Msg: "the document must be a mapping"}
+}
+
+// yamlLine is a line of a YAML document with content.
+type yamlLine struct {
+	num    int    // 1-based line number
+	indent int    // number of spaces before text
+	text   string // the line without indentation
+}
+
+// yamlParser reads a YAML document line by line.
+type yamlParser struct {
+	lines    []string
+	i        int       // index of the next line
+	override *yamlLine // rest of the current line, after "- "
+	first    int       // line of the first content
+	started  bool      // whether the document has content
+	end      bool      // whether the end of the document has been reached
+	im       *importer
+}
+
+// cur returns the current line with content, skipping blank lines and
+// comments.
+func (p *yamlParser) cur() (yamlLine, bool) {
+	if p.override != nil {
+		return *p.override, true
+	}
+	for !p.end && p.i < len(p.lines) {
+		raw := p.lines[p.i]
+		text := strings.TrimLeft(raw, " ")
+		num := p.i + 1
+		switch {
+		case strings.TrimSpace(text) == "":
+		case text[0] == '#':
+			p.im.comment(num)
+		case text[0] == '%' && !p.started:
+			// directive such as %YAML 1.2
+		case raw == "---" || strings.HasPrefix(raw, "--- ") || strings.HasPrefix(raw, "---\t"):
+			if p.started {
+				p.im.lose(num, "documents after the first dropped")
+				p.end = true
+				return yamlLine{}, false
+			}
+			p.started = true
+			rest := strings.TrimSpace(raw[3:])
+			if rest != "" && rest[0] != '#' {
+				p.first = num
+				line := yamlLine{num: num, indent: len(raw) - len(strings.TrimLeft(raw[3:], " \t")), text: rest}
+				p.override = &line
+				p.i++
+				return line, true
+			}
+		case raw == "..." || strings.HasPrefix(raw, "... "):
+			p.end = true
+			return yamlLine{}, false
+		default:
+			if !p.started {
+				p.started, p.first = true, num
+			}
+			return yamlLine{num: num, indent: len(raw) - len(text), text: strings.TrimRight(text, " \t")}, true
+		}
+		p.i++
+	}
+	return yamlLine{}, false
+}
+
+// advance moves past the current line.
+func (p *yamlParser) advance() {
+	if p.override != nil {
+		p.override = nil
+		return
+	}
+	p.i++
+}
+
+func yamlError(l yamlLine, format string, args ...any) error {
+	return &ParseError{Line: l.num, Column: l.indent + 1, Msg: fmt.Sprintf(format, args...)}
+}
+
+// block reads the node starting at the current line, if it is indented by
+// at least indent.
+func (p *yamlParser) block(indent int) (any, error) {
+	l, ok := p.cur()
+	if !ok || l.indent < indent {
+		return nil, nil
+	}
+	if strings.HasPrefix(l.text, "\t") {
+		return nil, yamlError(l, "tabs cannot be used for indentation")
+	}
+	if isSequenceItem(l.text) {
+		return p.sequence(l.indent)
+	}
+	if _, _, ok := splitYAMLKey(l.text); ok {
+		return p.mapping(l.indent)
+	}
+	p.advance()
+	return p.inline(l.text, l)
+}
+
+func isSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// mapping reads the entries of a block mapping indented by indent.
+func (p *yamlParser) mapping(indent int) (*valueTable, error) {
+	t := newValueTable()
+	for {
+		l, ok := p.cur()
+		if !ok || l.indent < indent {
+			return t, nil
+		}
+		if l.indent > indent {
+			return nil, yamlError(l, "unexpected indentation")
+		}
+		key, rest, ok := splitYAMLKey(l.text)
+		if !ok {
+			if isSequenceItem(l.text) {
+				return nil, yamlError(l, "expected a mapping key, found a sequence item")
+			}
+			return nil, yamlError(l, "expected key: value")
+		}
+		if _, dup := t.vals[key]; dup {
+			return nil, yamlError(l, "duplicate key %q", key)
+		}
+		if msg := forbiddenIn(key); msg != "" {
+			return nil, yamlError(l, "%s", msg)
+		}
+		p.advance()
+		v, err := p.value(rest, indent, l, true)
+		if err != nil {
+			return nil, err
+		}
+		t.set(key, v, l.num)
+	}
+}
+
+// sequence reads the items of a block sequence indented by indent.
+func (p *yamlParser) sequence(indent int) ([]any, error) {
+	items := []any{}
+	for {
+		l, ok := p.cur()
+		if !ok || l.indent < indent || l.indent == indent && !isSequenceItem(l.text) {
+			return items, nil
+		}
+		if l.indent > indent {
+			return nil, yamlError(l, "unexpected indentation")
+		}
+		p.advance()
+		rest := strings.TrimLeft(l.text[1:], " ")
+		item := yamlLine{num: l.num, indent: indent + len(l.text) - len(rest), text: rest}
+
+		var v any
+		var err error
+		_, _, isKey := splitYAMLKey(rest)
+		switch {
+		case isSequenceItem(rest):
+			p.override = &item
+			v, err = p.sequence(item.indent)
+		case isKey && rest[0] != '[' && rest[0] != '{':
+			p.override = &item
+			v, err = p.mapping(item.indent)
+		default:
+			v, err = p.value(rest, indent, item, false)
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+}
+
+// value reads the value rest found after a key or a sequence item on l,
+// whose node is indented by indent, and the lines nested under it. In a
+// mapping, a sequence may be nested at the same indentation as the key.
+func (p *yamlParser) value(rest string, indent int, l yamlLine, inMapping bool) (any, error) {
+	// properties, which do not map to directives
+	for rest != "" && (rest[0] == '&' || rest[0] == '!') {
+		prop, after, _ := strings.Cut(rest, " ")
+		what := "anchor"
+		if prop[0] == '!' {
+			what = "tag"
+		}
+		p.im.lose(l.num, "%s %s ignored", what, prop)
+		rest = strings.TrimLeft(after, " ")
+	}
+	if rest != "" && rest[0] == '*' {
+		alias, _, _ := strings.Cut(rest, " ")
+		p.im.lose(l.num, "alias %s not resolved, written as null", alias)
+		return nil, nil
+	}
+
+	if rest == "" || rest[0] == '#' {
+		if rest != "" {
+			p.im.comment(l.num)
+		}
+		next, ok := p.cur()
+		if ok && (next.indent > indent || inMapping && next.indent == indent && isSequenceItem(next.text)) {
+			return p.block(next.indent)
+		}
+		return nil, nil
+	}
+	if rest[0] == '|' || rest[0] == '>' {
+		return p.blockScalar(rest, indent, l)
+	}
+	return p.inline(rest, l)
+}
+
+// inline reads the value text, which ends on its line: a flow collection,
+// a quoted scalar or a plain scalar.
+func (p *yamlParser) inline(text string, l yamlLine) (any, error) {
+	f := &yamlFlow{s: text, l: l}
+	v, err := f.value(false)
+	if err != nil {
+		return nil, err
+	}
+	if msg := forbiddenIn(v); msg != "" {
+		return nil, yamlError(l, "%s", msg)
+	}
+	f.space()
+	if f.i < len(f.s) {
+		if f.s[f.i] != '#' {
+			return nil, f.errorf("unexpected %q after the value", f.s[f.i:])
+		}
+		p.im.comment(l.num)
+	}
+	return v, nil
+}
+
+// blockScalar reads a literal (|) or folded (>) block scalar with the
+// given header, nested under a node indented by indent.
+func (p *yamlParser) blockScalar(header string, indent int, l yamlLine) (any, error) {
+	style, chomp := header[0], byte(0)
+	content := 0
+	h, _, comment := strings.Cut(header[1:], "#")
+	if comment {
+		p.im.comment(l.num)
+	}
+	for _, c := range []byte(strings.TrimSpace(h)) {
+		switch {
+		case c == '-' || c == '+':
+			chomp = c
+		case '1' <= c && c <= '9':
+			content = indent + int(c-'0')
+		default:
+			return nil, yamlError(l, "invalid block scalar header %q", header)
+		}
+	}
+
+	var lines []string
+	for ; p.i < len(p.lines); p.i++ {
+		raw := strings.TrimRight(p.lines[p.i], " \t")
+		n := len(raw) - len(strings.TrimLeft(raw, " "))
+		if raw == "" {
+			lines = append(lines, "")
+			continue
+		}
+		if content == 0 {
+			if n <= indent {
+				break
+			}
+			content = n
+		}
+		if n < content {
+			break
+		}
+		line := p.lines[p.i][content:]
+		if msg := forbiddenIn(line); msg != "" {
+			return nil, yamlError(yamlLine{num: p.i + 1, indent: content}, "%s", msg)
+		}
+		lines = append(lines, line)
+	}
+
+	// trailing blank lines belong to the chomping
+	body := len(lines)
+	for body > 0 && lines[body-1] == "" {
+		body--
+	}
+	var sb strings.Builder
+	for i, line := range lines[:body] {
+		switch {
+		case i == 0:
+		case style == '|' || line == "" || strings.HasPrefix(line, " ") || strings.HasPrefix(lines[i-1], " "):
+			sb.WriteByte('\n')
+		case lines[i-1] != "":
+			// folded: lines join with spaces, blank lines give the newlines
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(line)
+	}
+	s := sb.String()
+	switch {
+	case chomp == '+':
+		s += strings.Repeat("\n", len(lines)-body+1)
+	case chomp == 0 && s != "":
+		s += "\n"
+	}
+	return s, nil
+}
+
+// splitYAMLKey splits the mapping entry text into its key and the rest of
+// the line after the colon.
+func splitYAMLKey(text string) (key, rest string, ok bool) {
+	if text == "" || strings.ContainsRune("[{#&*!|>%@`", rune(text[0])) || isSequenceItem(text) {
+		return "", "", false
+	}
+	i := 0
+	if text[0] == '"' || text[0] == '\'' {
+		f := &yamlFlow{s: text}
+		k, err := f.quoted()
+		if err != nil {
+			return "", "", false
+		}
+		f.space()
+		if !strings.HasPrefix(f.s[f.i:], ":") {
+			return "", "", false
+		}
+		key, i = k, f.i
+	} else {
+		for i = 0; i < len(text); i++ {
+			if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ' || text[i+1] == '\t') {
+				break
+			}
+			if text[i] == '#' && i > 0 && text[i-1] == ' ' {
+				return "", "", false
+			}
+		}
+		if i == len(text) {
+			return "", "", false
+		}
+		key = strings.TrimRight(text[:i], " \t")
+	}
+	return key, strings.TrimLeft(text[i+1:], " \t"), true
+}
+
+// yamlFlow reads a value that ends on its line.
+type yamlFlow struct {
+	s string
+	i int
+	l yamlLine
+}
+
+func (f *yamlFlow) errorf(format string, args ...any) error {
+	return &ParseError{Line: f.l.num, Column: f.l.indent + 1, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (f *yamlFlow) space() {
+	for f.i < len(f.s) && (f.s[f.i] == ' ' || f.s[f.i] == '\t') {
+		f.i++
+	}
+}
+
+// value reads a flow collection or a scalar; in a collection, plain
+// scalars end at the characters delimiting its entries.
+func (f *yamlFlow) value(inFlow bool) (any, error) {
+	f.space()
+	if f.i >= len(f.s) {
+		if inFlow {
+			return nil, f.errorf("flow collection must end on its line")
+		}
+		return nil, nil
+	}
+	switch f.s[f.i] {
+	case '[':
+		return f.sequence()
+	case '{':
+		return f.mapping()
+	case '"', '\'':
+		return f.quoted()
+	case '&', '!', '*':
+		return nil, f.errorf("anchors, aliases and tags are only supported before block values")
+	}
+	start := f.i
+	for f.i < len(f.s) {
+		c := f.s[f.i]
+		if c == '#' && f.i > start && (f.s[f.i-1] == ' ' || f.s[f.i-1] == '\t') {
+			break
+		}
+		if inFlow && (c == ',' || c == ']' || c == '}' || c == ':' && (f.i+1 == len(f.s) || strings.ContainsRune(" ,]}", rune(f.s[f.i+1])))) {
+			break
+		}
+		f.i++
+	}
+	s := strings.TrimRight(f.s[start:f.i], " \t")
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil, nil
+	}
+	return s, nil
+}
+
+func (f *yamlFlow) sequence() (any, error) {
+	f.i++
+	items := []any{}
+	for {
+		f.space()
+		if f.i < len(f.s) && f.s[f.i] == ']' {
+			f.i++
+			return items, nil
+		}
+		v, err := f.value(true)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+		f.space()
+		if f.i >= len(f.s) {
+			return nil, f.errorf("flow collection must end on its line")
+		}
+		switch f.s[f.i] {
+		case ',':
+			f.i++
+		case ']':
+			f.i++
+			return items, nil
+		default:
+			return nil, f.errorf("expected , or ] in flow sequence")
+		}
+	}
+}
+
+func (f *yamlFlow) mapping() (any, error) {
+	f.i++
+	t := newValueTable()
+	for {
+		f.space()
+		if f.i < len(f.s) && f.s[f.i] == '}' {
+			f.i++
+			return t, nil
+		}
+		k, err := f.value(true)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok && k != nil {
+			return nil, f.errorf("flow mapping keys must be scalars")
+		}
+		var v any
+		f.space()
+		if f.i < len(f.s) && f.s[f.i] == ':' {
+			f.i++
+			if v, err = f.value(true); err != nil {
+				return nil, err
+			}
+		}
+		if _, dup := t.vals[key]; dup {
+			return nil, f.errorf("duplicate key %q", key)
+		}
+		t.set(key, v, f.l.num)
+		f.space()
+		if f.i >= len(f.s) {
+			return nil, f.errorf("flow collection must end on its line")
+		}
+		switch f.s[f.i] {
+		case ',':
+			f.i++
+		case '}':
+			f.i++
+			return t, nil
+		default:
+			return nil, f.errorf("expected , or } in flow mapping")
+		}
+	}
+}
+
+// quoted reads a single- or double-quoted scalar.
+func (f *yamlFlow) quoted() (string, error) {
+	q := f.s[f.i]
+	f.i++
+	var sb strings.Builder
+	for f.i < len(f.s) {
+		c := f.s[f.i]
+		switch {
+		case c == q && q == '\'' && f.i+1 < len(f.s) && f.s[f.i+1] == '\'':
+			sb.WriteByte('\'')
+			f.i += 2
+		case c == q:
+			f.i++
+			return sb.String(), nil
+		case c == '\\' && q == '"':
+			r, n, ok := yamlUnescape(f.s[f.i+1:])
+			if !ok {
+				return "", f.errorf("invalid escape sequence in %s", f.s)
+			}
+			sb.WriteRune(r)
+			f.i += 1 + n
+		default:
+			sb.WriteByte(c)
+			f.i++
+		}
+	}
+	return "", f.errorf("quoted scalars must end on their line")
+}
+
+// yamlUnescape is unescape with the escapes specific to YAML.
+func yamlUnescape(s string) (rune, int, bool) {
+	if s == "" {
+		return 0, 0, false
+	}
+	switch s[0] {
+	case '0':
+		return 0, 1, true
+	case 'a':
+		return '\a', 1, true
+	case 'v':
+		return '\v', 1, true
+	case 'e':
+		return 0x1b, 1, true
+	case ' ', '/':
+		return rune(s[0]), 1, true
+	case 'x':
+		if r, n, ok := unescape("u00" + s[1:min(len(s), 3)]); ok && n == 5 {
+			return r, 3, true
+		}
+		return 0, 0, false
+	}
+	return unescape(s)
+}
+
+// MarshalYAML returns the YAML encoding of cf. Blocks become mappings,
+// nested under their inline arguments, repeated blocks sequences of
+// mappings, directives with several arguments flow sequences, repeated
+// directives block sequences, and directives without arguments null.
+// Arguments are written as plain scalars when YAML reads them back as the
+// same text, or a number or boolean, and in double quotes otherwise.
+//
+// The losses report the directives that could not be mapped exactly: inline
+// arguments, repeated directives with one argument each, which read back as
+// a single directive, and directives whose name also has a block.
+func MarshalYAML(cf *ConfigurationUnit) ([]byte, []Loss, error) {
+	ex := &exporter{}
+	w := &yamlWriter{ex: ex}
+	t := ex.tree(cf.Directives)
+	if len(t.keys) == 0 {
+		return []byte("{}\n"), ex.report(), nil
+	}
+	w.mapping(t, 0)
+	return []byte(w.sb.String()), ex.report(), nil
+}
+
+// yamlWriter writes a keyTree as YAML.
+type yamlWriter struct {
+	sb strings.Builder
+	ex *exporter
+}
+
+func (w *yamlWriter) indent(n int) {
+	w.sb.WriteString(strings.Repeat(" ", n))
+}
+
+// mapping writes the entries of t indented by indent; the first line is
+// expected to be indented by the caller.
+func (w *yamlWriter) mapping(t *keyTree, indent int) {
+	for i, k := range t.keys {
+		if i > 0 {
+			w.indent(indent)
+		}
+		w.sb.WriteString(yamlScalar(k))
+		w.sb.WriteByte(':')
+		leaves, trees := w.ex.entries(t, k)
+		switch {
+		case len(trees) == 1:
+			w.nested(trees[0], indent+2)
+		case len(trees) > 1:
+			w.sb.WriteByte('\n')
+			for _, st := range trees {
+				w.indent(indent + 2)
+				w.sb.WriteString("-")
+				if len(st.keys) == 0 {
+					w.sb.WriteString(" {}\n")
+					continue
+				}
+				w.sb.WriteByte(' ')
+				w.mapping(st, indent+4)
+			}
+		case len(leaves) == 1:
+			fmt.Fprintf(&w.sb, " %s\n", yamlValue(leaves[0].args))
+		default:
+			w.sb.WriteByte('\n')
+			single := singleArgs(leaves)
+			for _, l := range leaves {
+				w.indent(indent + 2)
+				v := yamlValue(l.args)
+				switch {
+				case len(l.args) == 0:
+					v = "[]"
+				case !single && len(l.args) == 1:
+					v = "[" + v + "]"
+				}
+				fmt.Fprintf(&w.sb, "- %s\n", v)
+			}
+		}
+	}
+}
+
+// nested writes the mapping t after its key.
+func (w *yamlWriter) nested(t *keyTree, indent int) {
+	if len(t.keys) == 0 {
+		w.sb.WriteString(" {}\n")
+		return
+	}
+	w.sb.WriteByte('\n')
+	w.indent(indent)
+	w.mapping(t, indent)
+}
+
+// yamlValue returns the YAML value for args: null without arguments, a
+// scalar for one argument and a flow sequence for more.
+func yamlValue(args []string) string {
+	switch len(args) {
+	case 0:
+		return "null"
+	case 1:
+		return yamlScalar(args[0])
+	}
+	elems := make([]string, len(args))
+	for i, arg := range args {
+		elems[i] = yamlScalar(arg)
+	}
+	return "[" + strings.Join(elems, ", ") + "]"
+}
+
+// yamlSpecial holds the plain scalars that YAML 1.1 or 1.2 reads as null or
+// booleans other than true and false.
+var yamlSpecial = map[string]bool{
+	"~": true, "null": true, "y": true, "n": true, "yes": true, "no": true,
+	"on": true, "off": true,
+}
+
+// yamlScalar returns s as a plain scalar if YAML reads it back as the same
+// text, or as a number or boolean, and in double quotes otherwise.
+func yamlScalar(s string) string {
+	if s == "" || yamlSpecial[strings.ToLower(s)] || s != strings.TrimSpace(s) {
+		return quoteEscaped(s)
+	}
+	for i, r := range s {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_./$()+=^", r):
+		case i > 0 && strings.ContainsRune(" -@~%;<>", r):
+		case r == '-' && len(s) > 1 && s[1] != ' ':
+		case r == ':' && i > 0 && i+1 < len(s) && s[i+1] != ' ':
+		default:
+			return quoteEscaped(s)
+		}
+	}
+	return s
+}
@@ -0,0 +1,218 @@
+package confetti
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	src := `%YAML 1.2
+---
+# service
+title: "YAML \"example\" \u00e9"
+port: 8080   # the port
+url: http://example.com/x
+empty:
+none: ~
+tags: [a, "b c", 'it''s']
+list:
+  - a
+  - b
+flat:
+- x
+- y
+servers:
+  - name: api
+    port: 80
+  - name: web
+    tls:
+      cert: a.pem
+matrix:
+  - [1, 2]
+  - - 3
+    - 4
+mixed: [1, {a: 1}]
+point: {x: 1, y: {z: 2}}
+base: &base
+  k: v
+ref: *base
+text: |
+  one
+    indented
+  two
+
+folded: >-
+  one
+  two
+
+  three
+typed: !!str 123
+---
+other: document
+`
+	cf, losses, err := ParseYAML(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Marshal(cf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `title "YAML \"example\" é"
+port 8080
+url http://example.com/x
+empty
+none
+tags a "b c" it's
+list a b
+flat x y
+servers {
+    name api
+    port 80
+}
+servers {
+    name web
+    tls {
+        cert a.pem
+    }
+}
+matrix 1 2
+matrix 3 4
+mixed 1
+mixed {
+    a 1
+}
+point {
+    x 1
+    y {
+        z 2
+    }
+}
+base {
+    k v
+}
+ref
+text """one
+  indented
+two
+"""
+folded """one two
+three"""
+typed 123
+`
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	wantLosses := []Loss{
+		{Line: 3, Msg: "2 comments dropped"},
+		{Line: 26, Msg: "mixed: array mixing values of different kinds written as repeated directives"},
+		{Line: 28, Msg: "anchor &base ignored"},
+		{Line: 30, Msg: "alias *base not resolved, written as null"},
+		{Line: 41, Msg: "tag !!str ignored"},
+		{Line: 42, Msg: "documents after the first dropped"},
+	}
+	if !reflect.DeepEqual(losses, wantLosses) {
+		t.Errorf("losses %v, want %v", losses, wantLosses)
+	}
+}
+
+func TestParseYAML_Errors(t *testing.T) {
+	tests := []struct {
+		src       string
+		line, col int
+	}{
+		{"a: 1\n  b: 2\n", 2, 3},
+		{"a: 1\na: 2\n", 2, 1},
+		{"- a\n- b\n", 1, 1},
+		{"a: [1, 2\n", 1, 1},
+		{"a: \"open\n", 1, 1},
+		{"a:\n  - x\n  y: 1\n", 3, 3},
+		{"a: 1\n- b\n", 2, 1},
+		{"a: 1\nb: \"x\\u0001\"\n", 2, 1},
+		{"a:\n  - x\n  - [y, \"\\u0000\"]\n", 3, 5},
+		{"\"k\x01\": 1\n", 1, 1},
+		{"a: |\n  x\n  y\x01\n", 3, 3},
+	}
+	for _, tt := range tests {
+		_, _, err := ParseYAML(tt.src)
+		var perr *ParseError
+		if !errors.As(err, &perr) || perr.Line != tt.line || perr.Column != tt.col {
+			t.Errorf("%q: got %v, want an error at %d:%d", tt.src, err, tt.line, tt.col)
+		}
+	}
+}
+
+func TestMarshalYAML(t *testing.T) {
+	cf, err := Parse(`name "my app"
+port 8080
+debug true
+answer yes
+note "a: b # c"
+hosts a "b, c"
+flag
+plugin a
+plugin b
+route 1 2
+route 3
+log {
+    level info
+}
+server api {
+    port 80
+}
+worker { id 1 }
+worker {}
+empty {}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, losses, err := MarshalYAML(cf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `name: my app
+port: 8080
+debug: true
+answer: "yes"
+note: "a: b # c"
+hosts: [a, "b, c"]
+flag: null
+plugin:
+  - a
+  - b
+route:
+  - [1, 2]
+  - [3]
+log:
+  level: info
+server:
+  api:
+    port: 80
+worker:
+  - id: 1
+  - {}
+empty: {}
+`
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	wantLosses := []Loss{
+		{Line: 9, Msg: "plugin: repeated directive written as an array"},
+		{Line: 15, Msg: "server: inline arguments written as nested keys"},
+	}
+	if !reflect.DeepEqual(losses, wantLosses) {
+		t.Errorf("losses %v, want %v", losses, wantLosses)
+	}
+
+	back, _, err := ParseYAML(string(got))
+	if err != nil {
+		t.Fatalf("output does not parse: %v", err)
+	}
+	for _, name := range []string{"name", "note", "hosts", "answer"} {
+		if a, b := back.Find(name), cf.Find(name); a == nil || !reflect.DeepEqual(a.Arguments, b.Arguments) {
+			t.Errorf("%s read back as %v, want %v", name, a, b.Arguments)
+		}
+	}
+}